@@ -5,14 +5,14 @@ import (
 	"os"
 
 	"github.com/ak-ansari/mytube/internal/api"
+	"github.com/ak-ansari/mytube/internal/app"
 	redisCache "github.com/ak-ansari/mytube/internal/cache/redis"
 	"github.com/ak-ansari/mytube/internal/config"
 	"github.com/ak-ansari/mytube/internal/db"
+	redisEvents "github.com/ak-ansari/mytube/internal/events/redis"
 	"github.com/ak-ansari/mytube/internal/pkg/logger"
 	client "github.com/ak-ansari/mytube/internal/pkg/redis"
-	redisQueue "github.com/ak-ansari/mytube/internal/queue/redis"
-	"github.com/ak-ansari/mytube/internal/repository/postgres"
-	"github.com/ak-ansari/mytube/internal/services"
+	"github.com/ak-ansari/mytube/internal/queue/provider"
 	"github.com/ak-ansari/mytube/internal/storage"
 )
 
@@ -40,22 +40,37 @@ func main() {
 
 	// Redis client
 	client := client.NewRedisClient(&conf.Redis)
-	queue := redisQueue.NewRedisQ(client)
 	cache := redisCache.NewRedisCache(client)
 
+	// Queue
+	queue, err := provider.New(conf, dbPool, client)
+	if err != nil {
+		logr.Fatal("failed to init queue", logger.Error(err))
+	}
+
 	// Object store
-	objStore, err := storage.NewS3Store(logr)
+	objStore, err := storage.NewObjectStore(conf, logr)
 	if err != nil {
-		logr.Error("failed to init s3 store", logger.Any("error", err))
+		logr.Error("failed to init object store", logger.Any("error", err))
 		os.Exit(1)
 	}
 
-	// Repository + Service
-	repo := postgres.NewVideoRepo(dbPool)
-	service := services.NewVideoService(objStore, repo, queue, cache, conf.Redis.RedisQueueName)
+	// Service
+	service, err := app.NewVideoService(app.Backends{
+		Conf:   conf,
+		Log:    logr,
+		Pool:   dbPool,
+		Store:  objStore,
+		Queue:  queue,
+		Cache:  cache,
+		Events: redisEvents.NewRedisBus(client),
+	})
+	if err != nil {
+		logr.Fatal("failed to init video service", logger.Error(err))
+	}
 
 	// Setup router
-	r := api.SetupRouter(service)
+	r := api.SetupRouter(service, objStore)
 	logr.Info("starting server", logger.String("port", conf.Server.HttpPort))
 	logr.Info("Application is Running in ", logger.String("env", conf.Env))
 	if err := r.Run(":" + conf.Server.HttpPort); err != nil {
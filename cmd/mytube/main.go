@@ -0,0 +1,100 @@
+// mytube runs the api and the workers in one process. Jobs, cache and objects
+// stay in process and on local disk, postgres is the only outside dependency.
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/api"
+	"github.com/ak-ansari/mytube/internal/app"
+	memoryCache "github.com/ak-ansari/mytube/internal/cache/memory"
+	"github.com/ak-ansari/mytube/internal/config"
+	"github.com/ak-ansari/mytube/internal/db"
+	memoryEvents "github.com/ak-ansari/mytube/internal/events/memory"
+	"github.com/ak-ansari/mytube/internal/pkg/logger"
+	memoryQueue "github.com/ak-ansari/mytube/internal/queue/memory"
+	"github.com/ak-ansari/mytube/internal/storage"
+)
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conf, err := config.GetConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	// --- Initialize logger ---
+	log, err := logger.NewZapLogger(conf.Env)
+	if err != nil {
+		panic(err)
+	}
+	defer log.Flush()
+
+	// --- Database ---
+	pool, err := db.NewPool(conf, log)
+	if err != nil {
+		log.Fatal("Failed to init db pool", logger.Error(err))
+	}
+
+	// --- Storage ---
+	store, err := storage.NewLocalStore(conf.Storage, log)
+	if err != nil {
+		log.Fatal("Failed to init object store", logger.Error(err))
+	}
+
+	// --- Services + Workers ---
+	backends := app.Backends{
+		Conf:   conf,
+		Log:    log,
+		Pool:   pool,
+		Store:  store,
+		Queue:  memoryQueue.NewMemoryQ(conf.Queue.VisibilityTimeout),
+		Cache:  memoryCache.NewMemoryCache(memoryCache.DefaultCapacity),
+		Events: memoryEvents.NewMemoryBus(),
+	}
+	service, err := app.NewVideoService(backends)
+	if err != nil {
+		log.Fatal("Failed to init video service", logger.Error(err))
+	}
+	runner, err := app.NewRunner(backends, service)
+	if err != nil {
+		log.Fatal("Failed to init workers", logger.Error(err))
+	}
+	runner.Start(ctx)
+	app.NewWebhookSender(backends, service).Start(ctx)
+	app.NewOutboxRelay(backends, service).Start(ctx)
+
+	// --- API ---
+	srv := &http.Server{
+		Addr:    ":" + conf.Server.HttpPort,
+		Handler: api.SetupRouter(service, store),
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("server exited with error", logger.Error(err))
+		}
+	}()
+	log.Info("starting server", logger.String("port", conf.Server.HttpPort))
+	log.Info("Application is Running in ", logger.String("env", conf.Env))
+
+	// --- Graceful shutdown ---
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+	log.Info("Shutting down gracefully...")
+
+	shutdownCtx, stop := context.WithTimeout(context.Background(), 30*time.Second)
+	defer stop()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error("failed to shut down server", logger.Error(err))
+	}
+	cancel()
+}
@@ -0,0 +1,62 @@
+// webhook-receiver is a stand-in webhook endpoint for trying deliveries out
+// locally. It checks the signature of every delivery and prints it; -fail makes
+// it answer 500 so retries and replays can be watched too. The api only sends
+// to it with WEBHOOKS.ALLOW_PRIVATE set, it listens on a private address.
+//
+//	go run ./cmd/webhook-receiver -addr :9090 -secret whsec_...
+//	curl -X POST localhost:8080/webhooks -d '{"url":"http://localhost:9090/hook","secret":"whsec_..."}'
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/webhooks"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "address to listen on")
+	secret := flag.String("secret", "", "secret the webhook was registered with, signatures aren't checked without it")
+	fail := flag.Int("fail", 0, "answer 500 to the first n deliveries")
+	flag.Parse()
+
+	http.Handle("/", receiver(*secret, *fail))
+
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+// receiver checks and prints deliveries, answering 500 to the first fail of them
+func receiver(secret string, fail int) http.Handler {
+	var failures atomic.Int64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		delivery, event := r.Header.Get(webhooks.HeaderDelivery), r.Header.Get(webhooks.HeaderEvent)
+		if secret != "" {
+			if err := webhooks.Verify(secret, r.Header.Get(webhooks.HeaderSignature), body, 5*time.Minute); err != nil {
+				log.Printf("rejected delivery %s (%s): %v", delivery, event, err)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+		if n := failures.Add(1); n <= int64(fail) {
+			log.Printf("failing delivery %s (%s) on purpose, %d/%d", delivery, event, n, fail)
+			http.Error(w, "failing on purpose", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("delivery %s (%s): %s", delivery, event, body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
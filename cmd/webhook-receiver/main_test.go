@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/webhooks"
+)
+
+const secret = "whsec_test"
+
+func post(t *testing.T, url, body, signature string) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(webhooks.HeaderSignature, signature)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestReceiver(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	srv := httptest.NewServer(receiver(secret, 1))
+	defer srv.Close()
+
+	body := `{"id":"1","type":"video.ready"}`
+	signed := webhooks.Sign(secret, time.Now(), []byte(body))
+
+	if code := post(t, srv.URL, body, webhooks.Sign("whsec_other", time.Now(), []byte(body))); code != http.StatusUnauthorized {
+		t.Errorf("wrong secret answered %d, want 401", code)
+	}
+	if code := post(t, srv.URL, body, webhooks.Sign(secret, time.Now().Add(-time.Hour), []byte(body))); code != http.StatusUnauthorized {
+		t.Errorf("stale signature answered %d, want 401", code)
+	}
+	// rejected deliveries don't count towards -fail
+	if code := post(t, srv.URL, body, signed); code != http.StatusInternalServerError {
+		t.Errorf("first delivery answered %d, want 500", code)
+	}
+	if code := post(t, srv.URL, body, signed); code != http.StatusNoContent {
+		t.Errorf("second delivery answered %d, want 204", code)
+	}
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET answered %d, want 405", resp.StatusCode)
+	}
+}
+
+func TestReceiverWithoutSecret(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	srv := httptest.NewServer(receiver("", 0))
+	defer srv.Close()
+
+	if code := post(t, srv.URL, "{}", "garbage"); code != http.StatusNoContent {
+		t.Errorf("unchecked delivery answered %d, want 204", code)
+	}
+}
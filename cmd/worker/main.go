@@ -6,17 +6,15 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/ak-ansari/mytube/internal/app"
 	redisCache "github.com/ak-ansari/mytube/internal/cache/redis"
 	"github.com/ak-ansari/mytube/internal/config"
 	"github.com/ak-ansari/mytube/internal/db"
-	"github.com/ak-ansari/mytube/internal/media"
+	redisEvents "github.com/ak-ansari/mytube/internal/events/redis"
 	"github.com/ak-ansari/mytube/internal/pkg/logger"
 	client "github.com/ak-ansari/mytube/internal/pkg/redis"
-	redisQueue "github.com/ak-ansari/mytube/internal/queue/redis"
-	"github.com/ak-ansari/mytube/internal/repository/postgres"
-	"github.com/ak-ansari/mytube/internal/services"
+	"github.com/ak-ansari/mytube/internal/queue/provider"
 	"github.com/ak-ansari/mytube/internal/storage"
-	"github.com/ak-ansari/mytube/internal/workers"
 )
 
 func main() {
@@ -42,45 +40,44 @@ func main() {
 	}
 
 	// --- Storage ---
-	store, err := storage.NewS3Store(log)
+	store, err := storage.NewObjectStore(conf, log)
 	if err != nil {
 		log.Fatal("Failed to init object store", logger.Error(err))
 	}
 
 	// --- Redis + Queue + Cache ---
 	redisClient := client.NewRedisClient(&conf.Redis)
-	queue := redisQueue.NewRedisQ(redisClient)
 	cache := redisCache.NewRedisCache(redisClient)
+	queue, err := provider.New(conf, pool, redisClient)
+	if err != nil {
+		log.Fatal("Failed to init queue", logger.Error(err))
+	}
 
-	// --- Media + Services ---
-	ffm := media.NewFFM()
-	repo := postgres.NewVideoRepo(pool)
-	service := services.NewVideoService(store, repo, queue, cache, conf.Redis.RedisQueueName)
-
-	// --- Workers ---
-	validate := workers.NewValidate(service, store, ffm, log)
-	transcode := workers.NewTranscoder(service, store, ffm, log)
-	segment := workers.NewSegment(service, store, ffm, log)
-	checksum := workers.NewChecksum(log)
-	publish := workers.NewPublish(service, log)
-	thumbnail := workers.NewThumbnail(service, ffm, store, log)
-
-	runner := workers.NewRunner(
-		queue,
-		conf.Redis.RedisQueueName,
-		validate,
-		transcode,
-		segment,
-		checksum,
-		publish,
-		thumbnail,
-		log,
-	)
+	// --- Services + Workers ---
+	backends := app.Backends{
+		Conf:   conf,
+		Log:    log,
+		Pool:   pool,
+		Store:  store,
+		Queue:  queue,
+		Cache:  cache,
+		Events: redisEvents.NewRedisBus(redisClient),
+	}
+	service, err := app.NewVideoService(backends)
+	if err != nil {
+		log.Fatal("Failed to init video service", logger.Error(err))
+	}
+	runner, err := app.NewRunner(backends, service)
+	if err != nil {
+		log.Fatal("Failed to init workers", logger.Error(err))
+	}
 
 	// --- Start worker runner ---
 	go func() {
 		runner.Start(ctx)
 	}()
+	app.NewWebhookSender(backends, service).Start(ctx)
+	app.NewOutboxRelay(backends, service).Start(ctx)
 	log.Info("Application is Running in ", logger.String("env", conf.Env))
 
 	// --- Graceful shutdown ---
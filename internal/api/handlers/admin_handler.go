@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/services"
+	"github.com/ak-ansari/mytube/internal/util"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler serves the operator endpoints
+type AdminHandler struct {
+	service *services.VideoService
+}
+
+func NewAdminHandler(service *services.VideoService) *AdminHandler {
+	return &AdminHandler{
+		service: service,
+	}
+}
+
+func (ah *AdminHandler) ListDeadJobs(c *gin.Context) {
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	result, err := ah.service.ListDeadJobs(ctx, offset, limit)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, util.NewResponse(200, "get dead jobs successfully", result, nil))
+}
+
+func (ah *AdminHandler) GetDeadJob(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	result, err := ah.service.GetDeadJob(ctx, c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, util.NewResponse(200, "get dead job successfully", result, nil))
+}
+
+func (ah *AdminHandler) RequeueDeadJob(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	if err := ah.service.RequeueDeadJob(ctx, c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, util.NewResponse(202, "dead job requeued successfully", nil, nil))
+}
+
+func (ah *AdminHandler) DeleteDeadJob(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	if err := ah.service.DeleteDeadJob(ctx, c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
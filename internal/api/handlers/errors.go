@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/ak-ansari/mytube/internal/encoding"
+	"github.com/ak-ansari/mytube/internal/queue"
+	"github.com/ak-ansari/mytube/internal/repository"
+	"github.com/ak-ansari/mytube/internal/services"
+	"github.com/ak-ansari/mytube/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// respondError maps service errors to http status codes
+func respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUploadNotFound),
+		errors.Is(err, queue.ErrNotFound),
+		errors.Is(err, repository.ErrNotFound),
+		errors.Is(err, os.ErrNotExist):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOffsetMismatch),
+		errors.Is(err, services.ErrVideoBusy):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUploadTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidLength),
+		errors.Is(err, services.ErrInvalidChecksum),
+		errors.Is(err, services.ErrMissingParts),
+		errors.Is(err, services.ErrSizeMismatch),
+		errors.Is(err, storage.ErrInvalidKey),
+		errors.Is(err, encoding.ErrUnknownProfile),
+		errors.Is(err, services.ErrInvalidWebhook),
+		errors.Is(err, services.ErrInvalidListQuery),
+		errors.Is(err, services.ErrInvalidMetadata),
+		errors.Is(err, services.ErrInvalidSearch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
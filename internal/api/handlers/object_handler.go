@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ak-ansari/mytube/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// content types the mime package doesn't know about but players care for
+var objectContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".mpd":  "application/dash+xml",
+	".ts":   "video/mp2t",
+	".m4s":  "video/iso.segment",
+}
+
+// ObjectHandler serves the local object store through the signed urls it hands out
+type ObjectHandler struct {
+	store  *storage.FSStore
+	signer *storage.URLSigner
+}
+
+func NewObjectHandler(store *storage.FSStore) *ObjectHandler {
+	return &ObjectHandler{
+		store:  store,
+		signer: store.Signer(),
+	}
+}
+
+// Get serves GET and HEAD, http.ServeContent takes care of Range and conditional requests
+func (oh *ObjectHandler) Get(c *gin.Context) {
+	key, ok := oh.verify(c)
+	if !ok {
+		return
+	}
+	st, err := oh.store.Stat(c, key)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	f, err := oh.store.Open(key)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer f.Close()
+
+	if ct, ok := objectContentTypes[path.Ext(key)]; ok {
+		c.Header("Content-Type", ct)
+	} else if st.ContentType != "" {
+		c.Header("Content-Type", st.ContentType)
+	}
+	c.Header("ETag", strconv.Quote(st.ETag))
+	c.Header("Cache-Control", "private, max-age=3600")
+	http.ServeContent(c.Writer, c.Request, path.Base(key), st.LastModified, f)
+}
+
+// Put takes the uploads made through PresignPut and PresignPart
+func (oh *ObjectHandler) Put(c *gin.Context) {
+	key, ok := oh.verify(c)
+	if !ok {
+		return
+	}
+
+	if uploadID := c.Query("uploadId"); uploadID != "" {
+		number, err := strconv.Atoi(c.Query("partNumber"))
+		if err != nil || number < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid partNumber"})
+			return
+		}
+		part, err := oh.store.PutPart(c, key, uploadID, number, c.Request.Body, c.Request.ContentLength)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Header("ETag", strconv.Quote(part.ETag))
+		c.Status(http.StatusOK)
+		return
+	}
+
+	if _, err := oh.store.Put(c, key, c.Request.Body, c.Request.ContentLength); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// verify checks the signature in the url and returns the key it grants access to
+func (oh *ObjectHandler) verify(c *gin.Context) (string, bool) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	err := oh.signer.Verify(c.Request.Method, key, c.Param("expires"), c.Param("signature"), c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return key, true
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// TusHandler implements the tus 1.0 resumable upload protocol (core, creation,
+// expiration and termination extensions) on top of VideoService.
+type TusHandler struct {
+	service *services.VideoService
+}
+
+func NewTusHandler(service *services.VideoService) *TusHandler {
+	return &TusHandler{
+		service: service,
+	}
+}
+
+func (th *TusHandler) Options(c *gin.Context) {
+	c.Header("Tus-Resumable", services.TusVersion)
+	c.Header("Tus-Version", services.TusVersion)
+	c.Header("Tus-Extension", "creation,expiration,termination")
+	c.Header("Tus-Max-Size", strconv.FormatInt(services.TusMaxSize, 10))
+	c.Status(http.StatusNoContent)
+}
+
+func (th *TusHandler) Create(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Length is required"})
+		return
+	}
+	meta := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	up, err := th.service.CreateTusUpload(ctx, length, meta["filename"], meta["profile"], meta["force"] == "true", models.VideoMetadata{
+		Title:       meta["title"],
+		Description: meta["description"],
+		Tags:        services.ParseTags(meta["tags"]),
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+up.ID)
+	c.Header("Upload-Expires", up.ExpiresAt.Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+func (th *TusHandler) Head(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	up, err := th.service.GetTusUpload(ctx, c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(up.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(up.Length, 10))
+	c.Header("Upload-Expires", up.ExpiresAt.Format(http.TimeFormat))
+	if up.Completed() {
+		c.Header("Video-Id", up.Result.VideoId)
+	}
+	c.Status(http.StatusOK)
+}
+
+func (th *TusHandler) Patch(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/offset+octet-stream"})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset is required"})
+		return
+	}
+
+	// no timeout here, a chunk can take as long as the client needs to send it
+	up, err := th.service.WriteTusChunk(c, c.Param("id"), offset, c.Request.Body)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(up.Offset, 10))
+	c.Header("Upload-Expires", up.ExpiresAt.Format(http.TimeFormat))
+	if up.Completed() {
+		c.Header("Video-Id", up.Result.VideoId)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (th *TusHandler) Terminate(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	if err := th.service.TerminateTusUpload(ctx, c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// checkTusResumable sets the protocol header and rejects clients speaking another version
+func checkTusResumable(c *gin.Context) bool {
+	c.Header("Tus-Resumable", services.TusVersion)
+	if c.GetHeader("Tus-Resumable") != services.TusVersion {
+		c.Header("Tus-Version", services.TusVersion)
+		c.AbortWithStatus(http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata decodes "key base64value,key2 base64value2"
+func parseUploadMetadata(header string) map[string]string {
+	meta := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), " ", 2)
+		if kv[0] == "" {
+			continue
+		}
+		if len(kv) == 1 {
+			meta[kv[0]] = ""
+			continue
+		}
+		if val, err := base64.StdEncoding.DecodeString(kv[1]); err == nil {
+			meta[kv[0]] = string(val)
+		}
+	}
+	return meta
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	memoryCache "github.com/ak-ansari/mytube/internal/cache/memory"
+	"github.com/ak-ansari/mytube/internal/config"
+	"github.com/ak-ansari/mytube/internal/encoding"
+	"github.com/ak-ansari/mytube/internal/jobs"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/pkg/logger"
+	"github.com/ak-ansari/mytube/internal/repository"
+	"github.com/ak-ansari/mytube/internal/services"
+	"github.com/ak-ansari/mytube/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...logger.Field)   {}
+func (nopLogger) Info(string, ...logger.Field)    {}
+func (nopLogger) Success(string, ...logger.Field) {}
+func (nopLogger) Warn(string, ...logger.Field)    {}
+func (nopLogger) Error(string, ...logger.Field)   {}
+func (nopLogger) Fatal(string, ...logger.Field)   {}
+func (nopLogger) Flush()                          {}
+
+// locks hands every lease to whoever asks first, as the postgres table would
+type locks struct {
+	mu      sync.Mutex
+	holders map[string]string
+}
+
+func (l *locks) Acquire(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if h, ok := l.holders[key]; ok && h != holder {
+		return false, nil
+	}
+	l.holders[key] = holder
+	return true, nil
+}
+
+func (l *locks) Release(ctx context.Context, key, holder string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holders[key] == holder {
+		delete(l.holders, key)
+	}
+	return nil
+}
+
+type transactor struct{}
+
+func (transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// videoRepo keeps the videos registered, none of them is a duplicate
+type videoRepo struct {
+	repository.VideoRepository
+	mu       sync.Mutex
+	inserted []models.Video
+}
+
+func (r *videoRepo) FindSource(ctx context.Context, sha256 string, profile encoding.Profile) (*models.Video, error) {
+	return nil, repository.ErrNotFound
+}
+
+func (r *videoRepo) InsertBasic(ctx context.Context, v models.Video) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inserted = append(r.inserted, v)
+	return nil
+}
+
+type webhookRepo struct{ repository.WebhookRepository }
+
+func (webhookRepo) Subscribed(ctx context.Context, eventType string) ([]models.Webhook, error) {
+	return nil, nil
+}
+
+type jobRepo struct{ repository.JobRepository }
+
+func (jobRepo) Queued(ctx context.Context, videoId string, step, variant string) error {
+	return nil
+}
+
+type outboxRepo struct{ repository.OutboxRepository }
+
+func (outboxRepo) Add(ctx context.Context, kind models.OutboxKind, topic string, payload []byte) error {
+	return nil
+}
+
+func newTusServer(t *testing.T) (*httptest.Server, *videoRepo) {
+	t.Helper()
+	store, err := storage.NewFSStore(t.TempDir(), nil, nopLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiles, err := encoding.NewProfiles(config.Encoding{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline, err := jobs.NewPipeline(config.Pipeline{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &videoRepo{}
+	service := services.NewVideoService(store, repo, jobRepo{}, webhookRepo{}, outboxRepo{}, nil, nil,
+		&locks{holders: map[string]string{}}, transactor{}, nil, nil, memoryCache.NewMemoryCache(0),
+		"jobs", pipeline, profiles, nil, false)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	th := NewTusHandler(service)
+	r.OPTIONS("/videos/uploads", th.Options)
+	r.POST("/videos/uploads", th.Create)
+	r.HEAD("/videos/uploads/:id", th.Head)
+	r.PATCH("/videos/uploads/:id", th.Patch)
+	r.DELETE("/videos/uploads/:id", th.Terminate)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv, repo
+}
+
+// tus sends a tus request, headers are given as name, value pairs
+func tus(t *testing.T, method, url, body string, headers ...string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Tus-Resumable", services.TusVersion)
+	for i := 0; i+1 < len(headers); i += 2 {
+		if headers[i+1] == "" {
+			req.Header.Del(headers[i])
+			continue
+		}
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	return res
+}
+
+func createUpload(t *testing.T, srv *httptest.Server, length string) string {
+	t.Helper()
+	res := tus(t, http.MethodPost, srv.URL+"/videos/uploads", "", "Upload-Length", length,
+		"Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("trip.mp4")))
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("create = %d, want 201", res.StatusCode)
+	}
+	return srv.URL + res.Header.Get("Location")
+}
+
+const octets = "application/offset+octet-stream"
+
+func TestTusHeaderValidation(t *testing.T) {
+	srv, _ := newTusServer(t)
+	upload := createUpload(t, srv, "10")
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		body    string
+		headers []string
+		status  int
+	}{
+		{"create without Tus-Resumable", http.MethodPost, srv.URL + "/videos/uploads", "", []string{"Tus-Resumable", "", "Upload-Length", "10"}, http.StatusPreconditionFailed},
+		{"create speaking another version", http.MethodPost, srv.URL + "/videos/uploads", "", []string{"Tus-Resumable", "0.2.2", "Upload-Length", "10"}, http.StatusPreconditionFailed},
+		{"create without Upload-Length", http.MethodPost, srv.URL + "/videos/uploads", "", nil, http.StatusBadRequest},
+		{"create with a bad Upload-Length", http.MethodPost, srv.URL + "/videos/uploads", "", []string{"Upload-Length", "ten"}, http.StatusBadRequest},
+		{"create with an empty upload", http.MethodPost, srv.URL + "/videos/uploads", "", []string{"Upload-Length", "0"}, http.StatusBadRequest},
+		{"create over the maximum size", http.MethodPost, srv.URL + "/videos/uploads", "", []string{"Upload-Length", "10737418241"}, http.StatusRequestEntityTooLarge},
+		{"create with an unknown profile", http.MethodPost, srv.URL + "/videos/uploads", "", []string{"Upload-Length", "10", "Upload-Metadata", "profile " + base64.StdEncoding.EncodeToString([]byte("nope"))}, http.StatusBadRequest},
+		{"patch without Tus-Resumable", http.MethodPatch, upload, "abc", []string{"Tus-Resumable", "", "Content-Type", octets, "Upload-Offset", "0"}, http.StatusPreconditionFailed},
+		{"patch without Content-Type", http.MethodPatch, upload, "abc", []string{"Upload-Offset", "0"}, http.StatusUnsupportedMediaType},
+		{"patch with another Content-Type", http.MethodPatch, upload, "abc", []string{"Content-Type", "application/octet-stream", "Upload-Offset", "0"}, http.StatusUnsupportedMediaType},
+		{"patch without Upload-Offset", http.MethodPatch, upload, "abc", []string{"Content-Type", octets}, http.StatusBadRequest},
+		{"patch with a bad Upload-Offset", http.MethodPatch, upload, "abc", []string{"Content-Type", octets, "Upload-Offset", "zero"}, http.StatusBadRequest},
+		{"patch with a negative Upload-Offset", http.MethodPatch, upload, "abc", []string{"Content-Type", octets, "Upload-Offset", "-1"}, http.StatusBadRequest},
+		{"patch ahead of the upload", http.MethodPatch, upload, "abc", []string{"Content-Type", octets, "Upload-Offset", "3"}, http.StatusConflict},
+		{"patch an unknown upload", http.MethodPatch, srv.URL + "/videos/uploads/nope", "abc", []string{"Content-Type", octets, "Upload-Offset", "0"}, http.StatusNotFound},
+		{"head without Tus-Resumable", http.MethodHead, upload, "", []string{"Tus-Resumable", ""}, http.StatusPreconditionFailed},
+		{"head an unknown upload", http.MethodHead, srv.URL + "/videos/uploads/nope", "", nil, http.StatusNotFound},
+		{"terminate without Tus-Resumable", http.MethodDelete, upload, "", []string{"Tus-Resumable", ""}, http.StatusPreconditionFailed},
+		{"terminate an unknown upload", http.MethodDelete, srv.URL + "/videos/uploads/nope", "", nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := tus(t, tt.method, tt.url, tt.body, tt.headers...)
+			if res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+			if res.Header.Get("Tus-Resumable") != services.TusVersion {
+				t.Errorf("Tus-Resumable = %q, want %s", res.Header.Get("Tus-Resumable"), services.TusVersion)
+			}
+		})
+	}
+
+	// none of the rejected requests moved the upload
+	res := tus(t, http.MethodHead, upload, "")
+	if res.Header.Get("Upload-Offset") != "0" {
+		t.Errorf("Upload-Offset after rejected patches = %q, want 0", res.Header.Get("Upload-Offset"))
+	}
+}
+
+func TestTusOptions(t *testing.T) {
+	srv, _ := newTusServer(t)
+	// the client discovers the version here, so it need not send one
+	res := tus(t, http.MethodOptions, srv.URL+"/videos/uploads", "", "Tus-Resumable", "")
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", res.StatusCode)
+	}
+	if res.Header.Get("Tus-Version") != services.TusVersion || !strings.Contains(res.Header.Get("Tus-Extension"), "termination") {
+		t.Errorf("headers = %v", res.Header)
+	}
+}
+
+func TestTusUpload(t *testing.T) {
+	srv, repo := newTusServer(t)
+	content := "some video bytes"
+	upload := createUpload(t, srv, "16")
+
+	patches := []struct {
+		offset string
+		body   string
+		status int
+		after  string
+	}{
+		{"0", content[:5], http.StatusNoContent, "5"},
+		// a retry of the chunk that already landed
+		{"0", content[:5], http.StatusConflict, "5"},
+		{"9", content[9:], http.StatusConflict, "5"},
+		{"5", content[5:12], http.StatusNoContent, "12"},
+		// more than is left is cut at the length
+		{"12", content[12:] + "trailing", http.StatusNoContent, "16"},
+	}
+	for _, p := range patches {
+		res := tus(t, http.MethodPatch, upload, p.body, "Content-Type", octets, "Upload-Offset", p.offset)
+		if res.StatusCode != p.status {
+			t.Fatalf("patch at %s = %d, want %d", p.offset, res.StatusCode, p.status)
+		}
+		head := tus(t, http.MethodHead, upload, "")
+		if head.StatusCode != http.StatusOK || head.Header.Get("Upload-Offset") != p.after {
+			t.Fatalf("head after patch at %s = %d offset %q, want offset %s", p.offset, head.StatusCode, head.Header.Get("Upload-Offset"), p.after)
+		}
+		if head.Header.Get("Upload-Length") != "16" || head.Header.Get("Cache-Control") != "no-store" {
+			t.Errorf("head headers = %v", head.Header)
+		}
+	}
+
+	head := tus(t, http.MethodHead, upload, "")
+	if len(repo.inserted) != 1 {
+		t.Fatalf("%d videos registered, want 1", len(repo.inserted))
+	}
+	video := repo.inserted[0]
+	if head.Header.Get("Video-Id") != video.ID.String() {
+		t.Errorf("Video-Id = %q, want %s", head.Header.Get("Video-Id"), video.ID)
+	}
+	sum := sha256.Sum256([]byte(content))
+	if video.SHA256 == nil || *video.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("checksum = %v, want the sha256 of every chunk", video.SHA256)
+	}
+	if video.SizeBytes == nil || *video.SizeBytes != 16 || video.Filename != "trip.mp4" {
+		t.Errorf("video = %+v", video)
+	}
+}
+
+func TestTusTerminate(t *testing.T) {
+	srv, repo := newTusServer(t)
+	upload := createUpload(t, srv, "10")
+	if res := tus(t, http.MethodPatch, upload, "abc", "Content-Type", octets, "Upload-Offset", "0"); res.StatusCode != http.StatusNoContent {
+		t.Fatalf("patch = %d, want 204", res.StatusCode)
+	}
+
+	if res := tus(t, http.MethodDelete, upload, ""); res.StatusCode != http.StatusNoContent {
+		t.Fatalf("terminate = %d, want 204", res.StatusCode)
+	}
+	if res := tus(t, http.MethodHead, upload, ""); res.StatusCode != http.StatusNotFound {
+		t.Errorf("head after terminate = %d, want 404", res.StatusCode)
+	}
+	if res := tus(t, http.MethodPatch, upload, "defg", "Content-Type", octets, "Upload-Offset", "3"); res.StatusCode != http.StatusNotFound {
+		t.Errorf("patch after terminate = %d, want 404", res.StatusCode)
+	}
+	if res := tus(t, http.MethodDelete, upload, ""); res.StatusCode != http.StatusNotFound {
+		t.Errorf("terminate twice = %d, want 404", res.StatusCode)
+	}
+	if len(repo.inserted) != 0 {
+		t.Errorf("a terminated upload registered %d videos", len(repo.inserted))
+	}
+}
+
+func TestParseUploadMetadata(t *testing.T) {
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		header string
+		want   map[string]string
+	}{
+		{"", map[string]string{}},
+		{"filename " + b64("trip.mp4"), map[string]string{"filename": "trip.mp4"}},
+		{"filename " + b64("trip.mp4") + ", title " + b64("My trip, day 1"), map[string]string{"filename": "trip.mp4", "title": "My trip, day 1"}},
+		// a key without a value is set, empty
+		{"force", map[string]string{"force": ""}},
+		{"force,,tags " + b64("a,b"), map[string]string{"force": "", "tags": "a,b"}},
+		// a value that isn't base64 is dropped
+		{"title not-base64!", map[string]string{}},
+	}
+	for _, tt := range tests {
+		got := parseUploadMetadata(tt.header)
+		if len(got) != len(tt.want) {
+			t.Errorf("parseUploadMetadata(%q) = %q, want %q", tt.header, got, tt.want)
+			continue
+		}
+		for k, v := range tt.want {
+			if g, ok := got[k]; !ok || g != v {
+				t.Errorf("parseUploadMetadata(%q) = %q, want %q", tt.header, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -2,14 +2,49 @@ package handlers
 
 import (
 	"context"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ak-ansari/mytube/internal/events"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/repository"
 	"github.com/ak-ansari/mytube/internal/services"
+	"github.com/ak-ansari/mytube/internal/storage"
 	"github.com/ak-ansari/mytube/internal/util"
 	"github.com/gin-gonic/gin"
 )
 
+type createUploadSessionRequest struct {
+	Filename string `json:"filename" binding:"required"`
+	Size     int64  `json:"size" binding:"required,gt=0"`
+	Sha256   string `json:"sha256"`
+	// Profile is the encoding profile to use, the default one when empty
+	Profile string `json:"profile"`
+	models.VideoMetadata
+}
+
+type listVideosQuery struct {
+	// Status is a comma separated list of statuses
+	Status        string     `form:"status"`
+	CreatedAfter  *time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore *time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	MinDuration   *int       `form:"min_duration" binding:"omitempty,gte=0"`
+	MaxDuration   *int       `form:"max_duration" binding:"omitempty,gte=0"`
+	MinHeight     *int       `form:"min_height" binding:"omitempty,gte=0"`
+	MaxHeight     *int       `form:"max_height" binding:"omitempty,gte=0"`
+	Sort          string     `form:"sort" binding:"omitempty,oneof=created_at duration size"`
+	Order         string     `form:"order" binding:"omitempty,oneof=asc desc"`
+	Limit         int        `form:"limit" binding:"omitempty,gte=1"`
+	Cursor        string     `form:"cursor"`
+}
+
+type completeUploadSessionRequest struct {
+	Parts []storage.Part `json:"parts"`
+}
+
 type VideoHandler struct {
 	service *services.VideoService
 }
@@ -28,28 +63,234 @@ func (vh *VideoHandler) UploadVideo(c *gin.Context) {
 	}
 	ctx, cancel := context.WithTimeout(c, 120*time.Second)
 	defer cancel()
-	result, err := vh.service.UploadVideo(ctx, file)
+	// force processes the file again even if the same one was uploaded before
+	result, err := vh.service.UploadVideo(ctx, file, c.PostForm("profile"), c.PostForm("force") == "true", models.VideoMetadata{
+		Title:       c.PostForm("title"),
+		Description: c.PostForm("description"),
+		Tags:        services.ParseTags(c.PostForm("tags")),
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err.Error())
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, util.NewResponse(201, "file uploaded successfully", result, nil))
 
 }
+
+// ListVideos pages through videos, newest first unless sort and order say
+// otherwise. The next_cursor of a page is passed as cursor to get the next one,
+// with the same filters and sort.
+func (vh *VideoHandler) ListVideos(c *gin.Context) {
+	var req listVideosQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	q := repository.VideoQuery{
+		CreatedAfter:  req.CreatedAfter,
+		CreatedBefore: req.CreatedBefore,
+		MinDuration:   req.MinDuration,
+		MaxDuration:   req.MaxDuration,
+		MinHeight:     req.MinHeight,
+		MaxHeight:     req.MaxHeight,
+		Sort:          repository.VideoSort(req.Sort),
+		Limit:         req.Limit,
+	}
+	if q.Sort == "" {
+		q.Sort = repository.SortCreatedAt
+	}
+	// newest, longest and largest first by default
+	q.Desc = req.Order != "asc"
+	q.Statuses = parseStatuses(req.Status)
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	result, err := vh.service.ListVideos(ctx, q, req.Cursor)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, util.NewResponse(200, "get videos successfully", result, nil))
+}
+
+type searchVideosQuery struct {
+	Q string `form:"q" binding:"required"`
+	// Status is a comma separated list of statuses
+	Status string `form:"status"`
+	Offset int    `form:"offset" binding:"omitempty,gte=0"`
+	Limit  int    `form:"limit" binding:"omitempty,gte=1,lte=100"`
+}
+
+// SearchVideos searches the titles, tags and descriptions of videos
+func (vh *VideoHandler) SearchVideos(c *gin.Context) {
+	var req searchVideosQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 20
+	}
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	result, err := vh.service.SearchVideos(ctx, req.Q, parseStatuses(req.Status), req.Offset, req.Limit)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, util.NewResponse(200, "search videos successfully", result, nil))
+}
+
+// UpdateMetadata changes the title, description or tags of a video, the
+// fields left out keep their value
+func (vh *VideoHandler) UpdateMetadata(c *gin.Context) {
+	var req services.MetadataPatch
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	result, err := vh.service.UpdateMetadata(ctx, c.Param("id"), req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, util.NewResponse(200, "video updated successfully", result, nil))
+}
+
 func (vh *VideoHandler) GetVideo(c *gin.Context) {
 	id := c.Param("id")
 	ctx, cancel := context.WithTimeout(c, 120*time.Second)
 	defer cancel()
-	result, err := vh.service.GetVideo(ctx, id)
+	result, err := vh.service.GetVideoDetails(ctx, id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err.Error())
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, util.NewResponse(201, "get video successfully", result, nil))
 
 }
+
+// GetVideosByHash finds the videos uploaded with the content of a sha256
+func (vh *VideoHandler) GetVideosByHash(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	result, err := vh.service.GetVideosByHash(ctx, c.Param("sha256"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, util.NewResponse(200, "get videos successfully", result, nil))
+}
+
+// GetSimilarVideos lists near-duplicates of a video, re-encoded or trimmed
+// copies, scoring at least min_score (0 to 1)
+func (vh *VideoHandler) GetSimilarVideos(c *gin.Context) {
+	minScore, err := strconv.ParseFloat(c.DefaultQuery("min_score", "0.5"), 64)
+	if err != nil || minScore < 0 || minScore > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_score must be a number from 0 to 1"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	result, err := vh.service.SimilarVideos(ctx, c.Param("id"), minScore, limit)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, util.NewResponse(200, "get similar videos successfully", result, nil))
+}
+
+func (vh *VideoHandler) DeleteVideo(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	if err := vh.service.DeleteVideo(ctx, c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// eventsHeartbeat keeps proxies from closing an events stream that is quiet
+const eventsHeartbeat = 15 * time.Second
+
+// StreamEvents sends the details of a video, then every event published for it
+// while it is processed, ffmpeg progress included, until it is ready or failed
+func (vh *VideoHandler) StreamEvents(c *gin.Context) {
+	vh.streamEvents(c, func(events.Event) bool { return true })
+}
+
+// StreamProgress is StreamEvents narrowed to the ffmpeg progress of the steps
+// and the status changes of the video
+func (vh *VideoHandler) StreamProgress(c *gin.Context) {
+	vh.streamEvents(c, func(e events.Event) bool {
+		return e.Type == events.TypeProgress || e.Type == events.TypeStatus
+	})
+}
+
+// streamEvents sends the details of a video, then the events published for it
+// that pass keep, until it is ready or failed
+func (vh *VideoHandler) streamEvents(c *gin.Context, keep func(events.Event) bool) {
+	id := c.Param("id")
+	ctx := c.Request.Context()
+	// subscribe before the snapshot so nothing falls between the two
+	evs, err := vh.service.Subscribe(ctx, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	details, err := vh.service.GetVideoDetails(ctx, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("snapshot", details)
+	c.Writer.Flush()
+	if done(details.Status) {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-heartbeat.C:
+			// a comment line, EventSource ignores it
+			_, err := io.WriteString(w, ": heartbeat\n\n")
+			return err == nil
+		case e, ok := <-evs:
+			if !ok {
+				return false
+			}
+			if !keep(e) {
+				return true
+			}
+			c.SSEvent(e.Type, e)
+			return e.Type != events.TypeStatus || !done(models.VideoStatus(e.Status))
+		}
+	})
+}
+
+func done(status models.VideoStatus) bool {
+	return status == models.StatusReady || status == models.StatusFailed
+}
+
 func (vh *VideoHandler) GetDownloadUrl(c *gin.Context) {
 	key := c.Query("key")
 	ctx, cancel := context.WithTimeout(c, 120*time.Second)
@@ -63,3 +304,60 @@ func (vh *VideoHandler) GetDownloadUrl(c *gin.Context) {
 	c.JSON(http.StatusOK, util.NewResponse(201, "get video successfully", result, nil))
 
 }
+
+func (vh *VideoHandler) CreateUploadSession(c *gin.Context) {
+	var req createUploadSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	result, err := vh.service.CreateUploadSession(ctx, req.Filename, req.Size, req.Sha256, req.Profile, req.VideoMetadata)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, util.NewResponse(201, "upload session created successfully", result, nil))
+}
+
+func (vh *VideoHandler) CompleteUploadSession(c *gin.Context) {
+	var req completeUploadSessionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	result, err := vh.service.CompleteUploadSession(ctx, c.Param("id"), req.Parts)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, util.NewResponse(201, "file uploaded successfully", result, nil))
+}
+
+func (vh *VideoHandler) AbortUploadSession(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	if err := vh.service.AbortUploadSession(ctx, c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// parseStatuses splits a comma separated list of statuses
+func parseStatuses(s string) []models.VideoStatus {
+	var statuses []models.VideoStatus
+	for _, st := range strings.Split(s, ",") {
+		if st = strings.TrimSpace(st); st != "" {
+			statuses = append(statuses, models.VideoStatus(st))
+		}
+	}
+	return statuses
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/services"
+	"github.com/ak-ansari/mytube/internal/util"
+	"github.com/gin-gonic/gin"
+)
+
+type createWebhookRequest struct {
+	URL string `json:"url" binding:"required"`
+	// Events to send, every event when empty
+	Events []string `json:"events"`
+	// Secret signs the deliveries, one is generated when empty
+	Secret string `json:"secret"`
+}
+
+type WebhookHandler struct {
+	service *services.VideoService
+}
+
+func NewWebhookHandler(service *services.VideoService) *WebhookHandler {
+	return &WebhookHandler{
+		service: service,
+	}
+}
+
+func (wh *WebhookHandler) Create(c *gin.Context) {
+	var req createWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	result, err := wh.service.CreateWebhook(ctx, req.URL, req.Events, req.Secret)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, util.NewResponse(201, "webhook created successfully", result, nil))
+}
+
+func (wh *WebhookHandler) List(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	result, err := wh.service.ListWebhooks(ctx)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, util.NewResponse(200, "get webhooks successfully", result, nil))
+}
+
+func (wh *WebhookHandler) Get(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	result, err := wh.service.GetWebhook(ctx, c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, util.NewResponse(200, "get webhook successfully", result, nil))
+}
+
+func (wh *WebhookHandler) Delete(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	if err := wh.service.DeleteWebhook(ctx, c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (wh *WebhookHandler) ListDeliveries(c *gin.Context) {
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	result, err := wh.service.ListWebhookDeliveries(ctx, c.Param("id"), offset, limit)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, util.NewResponse(200, "get webhook deliveries successfully", result, nil))
+}
+
+func (wh *WebhookHandler) GetDelivery(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	result, err := wh.service.GetWebhookDelivery(ctx, c.Param("id"), c.Param("deliveryId"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, util.NewResponse(200, "get webhook delivery successfully", result, nil))
+}
+
+func (wh *WebhookHandler) ReplayDelivery(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 120*time.Second)
+	defer cancel()
+	result, err := wh.service.ReplayWebhookDelivery(ctx, c.Param("id"), c.Param("deliveryId"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, util.NewResponse(202, "webhook delivery replayed successfully", result, nil))
+}
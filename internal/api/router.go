@@ -3,16 +3,64 @@ package api
 import (
 	"github.com/ak-ansari/mytube/internal/api/handlers"
 	"github.com/ak-ansari/mytube/internal/services"
+	"github.com/ak-ansari/mytube/internal/storage"
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter(service *services.VideoService) *gin.Engine {
+func SetupRouter(service *services.VideoService, store storage.ObjectStore) *gin.Engine {
 	r := gin.Default()
 	vh := handlers.NewVideoHandler(service)
+	th := handlers.NewTusHandler(service)
+	ah := handlers.NewAdminHandler(service)
+	wh := handlers.NewWebhookHandler(service)
 
 	r.POST("/videos/upload", vh.UploadVideo)
+	r.GET("/videos", vh.ListVideos)
+	r.GET("/videos/search", vh.SearchVideos)
 	r.GET("/videos/:id", vh.GetVideo)
+	r.PATCH("/videos/:id", vh.UpdateMetadata)
+	r.DELETE("/videos/:id", vh.DeleteVideo)
+	r.GET("/videos/by-hash/:sha256", vh.GetVideosByHash)
+	r.GET("/videos/:id/progress", vh.StreamProgress)
+	r.GET("/videos/:id/events", vh.StreamEvents)
+	r.GET("/videos/:id/similar", vh.GetSimilarVideos)
 	r.GET("/videos/url", vh.GetDownloadUrl)
 
+	// direct-to-bucket uploads through presigned urls
+	r.POST("/videos/upload-sessions", vh.CreateUploadSession)
+	r.POST("/videos/upload-sessions/:id/complete", vh.CompleteUploadSession)
+	r.DELETE("/videos/upload-sessions/:id", vh.AbortUploadSession)
+
+	// resumable uploads (tus 1.0)
+	r.OPTIONS("/videos/uploads", th.Options)
+	r.POST("/videos/uploads", th.Create)
+	r.HEAD("/videos/uploads/:id", th.Head)
+	r.PATCH("/videos/uploads/:id", th.Patch)
+	r.DELETE("/videos/uploads/:id", th.Terminate)
+
+	// dead-lettered pipeline jobs
+	r.GET("/admin/dead-jobs", ah.ListDeadJobs)
+	r.GET("/admin/dead-jobs/:id", ah.GetDeadJob)
+	r.POST("/admin/dead-jobs/:id/requeue", ah.RequeueDeadJob)
+	r.DELETE("/admin/dead-jobs/:id", ah.DeleteDeadJob)
+
+	// webhooks and their deliveries
+	r.POST("/webhooks", wh.Create)
+	r.GET("/webhooks", wh.List)
+	r.GET("/webhooks/:id", wh.Get)
+	r.DELETE("/webhooks/:id", wh.Delete)
+	r.GET("/webhooks/:id/deliveries", wh.ListDeliveries)
+	r.GET("/webhooks/:id/deliveries/:deliveryId", wh.GetDelivery)
+	r.POST("/webhooks/:id/deliveries/:deliveryId/replay", wh.ReplayDelivery)
+
+	// signed urls of the local object store
+	if fs, ok := store.(*storage.FSStore); ok && fs.Signer() != nil {
+		oh := handlers.NewObjectHandler(fs)
+		objects := storage.ObjectsPath + "/:expires/:signature/*key"
+		r.GET(objects, oh.Get)
+		r.HEAD(objects, oh.Get)
+		r.PUT(objects, oh.Put)
+	}
+
 	return r
 }
@@ -0,0 +1,96 @@
+// Package app wires the service and the workers on top of whatever backends a
+// binary picked, so cmd/api, cmd/worker and cmd/mytube build them the same way.
+package app
+
+import (
+	"github.com/ak-ansari/mytube/internal/cache"
+	"github.com/ak-ansari/mytube/internal/config"
+	"github.com/ak-ansari/mytube/internal/db"
+	"github.com/ak-ansari/mytube/internal/encoding"
+	"github.com/ak-ansari/mytube/internal/events"
+	"github.com/ak-ansari/mytube/internal/jobs"
+	"github.com/ak-ansari/mytube/internal/media"
+	"github.com/ak-ansari/mytube/internal/pkg/logger"
+	"github.com/ak-ansari/mytube/internal/queue/provider"
+	"github.com/ak-ansari/mytube/internal/repository/postgres"
+	"github.com/ak-ansari/mytube/internal/services"
+	"github.com/ak-ansari/mytube/internal/storage"
+	"github.com/ak-ansari/mytube/internal/workers"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Backends are the external pieces the app runs on
+type Backends struct {
+	Conf  *config.Config
+	Log   logger.Logger
+	Pool  *pgxpool.Pool
+	Store storage.ObjectStore
+	Queue provider.Queue
+	Cache cache.Cache
+	// Events carries progress from the workers to the api
+	Events events.Bus
+}
+
+func NewVideoService(b Backends) (*services.VideoService, error) {
+	pipeline, err := jobs.NewPipeline(b.Conf.Pipeline)
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := encoding.NewProfiles(b.Conf.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	repo := postgres.NewVideoRepo(b.Pool)
+	jobRepo := postgres.NewJobRepo(b.Pool)
+	webhookRepo := postgres.NewWebhookRepo(b.Pool)
+	outboxRepo := postgres.NewOutboxRepo(b.Pool)
+	objectRepo := postgres.NewObjectRepo(b.Pool)
+	fingerprintRepo := postgres.NewFingerprintRepo(b.Pool)
+	lockRepo := postgres.NewLockRepo(b.Pool)
+	tx := db.NewTransactor(b.Pool)
+	return services.NewVideoService(b.Store, repo, jobRepo, webhookRepo, outboxRepo, objectRepo, fingerprintRepo, lockRepo, tx, b.Queue, b.Queue, b.Cache, b.Conf.Redis.RedisQueueName, pipeline, profiles, b.Events, b.Conf.Webhooks.AllowPrivate), nil
+}
+
+// NewRegistry registers the handler of every step a pipeline can use, new
+// steps are added here and to the PIPELINE config
+func NewRegistry(b Backends, service *services.VideoService) *workers.Registry {
+	ffm := media.NewFFM()
+	return workers.NewRegistry().
+		Register(jobs.StepValidate, workers.NewValidate(service, b.Store, ffm, b.Log)).
+		Register(jobs.StepTranscode, workers.NewTranscoder(service, b.Store, ffm, b.Log)).
+		Register(jobs.StepSegment, workers.NewSegment(service, b.Store, ffm, b.Log)).
+		Register(jobs.StepDash, workers.NewDash(service, b.Store, ffm, b.Log)).
+		Register(jobs.StepChecksum, workers.NewChecksum(service, b.Store, b.Log)).
+		Register(jobs.StepThumbs, workers.NewThumbnail(service, ffm, b.Store, b.Log)).
+		Register(jobs.StepFingerprint, workers.NewFingerprint(service, ffm, b.Log)).
+		Register(jobs.StepPublish, workers.NewPublish(service, b.Log))
+}
+
+func NewRunner(b Backends, service *services.VideoService) (*workers.Runner, error) {
+	registry := NewRegistry(b, service)
+	if err := registry.Check(service.Pipeline()); err != nil {
+		return nil, err
+	}
+	return workers.NewRunner(
+		b.Queue,
+		b.Conf.Redis.RedisQueueName,
+		b.Queue,
+		b.Conf.Queue.VisibilityTimeout,
+		jobs.NewRetryPolicies(b.Conf.Retry),
+		registry,
+		service,
+		b.Log,
+	), nil
+}
+
+// NewWebhookSender sends the deliveries the service queues for the webhooks
+func NewWebhookSender(b Backends, service *services.VideoService) *workers.WebhookSender {
+	retry := jobs.NewRetryPolicy(b.Conf.Webhooks.Retry, workers.DefaultWebhookRetry)
+	return workers.NewWebhookSender(service, b.Conf.Webhooks.Timeout, retry, b.Conf.Webhooks.AllowPrivate, b.Log)
+}
+
+// NewOutboxRelay sends what the service writes to the outbox on to the queue
+// and the event bus, nothing reaches either without one running
+func NewOutboxRelay(b Backends, service *services.VideoService) *workers.OutboxRelay {
+	return workers.NewOutboxRelay(service, b.Log)
+}
@@ -3,19 +3,33 @@ package cache
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 )
 
 const (
-	VIDEO_INFO string = "video_info"
-	URL        string = "url"
-	KEY        string = "key"
+	VIDEO_INFO     string = "video_info"
+	URL            string = "url"
+	KEY            string = "key"
+	UPLOAD         string = "upload"
+	UPLOAD_SESSION string = "upload_session"
 )
 
+// durable are the kinds of keys that hold state rather than copies of it,
+// in-flight uploads, a cache may only drop them once they expire
+var durable = []string{UPLOAD, UPLOAD_SESSION}
+
 func GetKey(key string, id string) string {
 	return fmt.Sprintf("%s:%s", key, id)
 }
 
+// IsDurable tells whether key must not be evicted before it expires
+func IsDurable(key string) bool {
+	kind, _, ok := strings.Cut(key, ":")
+	return ok && slices.Contains(durable, kind)
+}
+
 type Cache interface {
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
 	Get(ctx context.Context, key string, target any) error
@@ -0,0 +1,140 @@
+package memoryCache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/cache"
+)
+
+const DefaultCapacity = 10000
+
+type item struct {
+	key       string
+	data      []byte
+	expiresAt time.Time // zero means no expiry
+}
+
+func (i *item) expired(now time.Time) bool {
+	return !i.expiresAt.IsZero() && now.After(i.expiresAt)
+}
+
+// memoryCache is an in-process LRU cache that honours expirations. Values are
+// stored JSON encoded so Get behaves exactly like the redis cache. Durable keys
+// are kept apart from the LRU and its capacity, they only go when they expire.
+type memoryCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List // front is the most recently used
+	durable  map[string]*item
+}
+
+func NewMemoryCache(capacity int) *memoryCache {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &memoryCache{
+		capacity: capacity,
+		items:    map[string]*list.Element{},
+		order:    list.New(),
+		durable:  map[string]*item{},
+	}
+}
+
+func (m *memoryCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	it := &item{key: key, data: data}
+	if expiration > 0 {
+		it.expiresAt = time.Now().Add(expiration)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cache.IsDurable(key) {
+		m.sweep()
+		m.durable[key] = it
+		return nil
+	}
+	if el, ok := m.items[key]; ok {
+		el.Value = it
+		m.order.MoveToFront(el)
+		return nil
+	}
+	m.items[key] = m.order.PushFront(it)
+	for m.order.Len() > m.capacity {
+		m.remove(m.order.Back())
+	}
+	return nil
+}
+
+// Get retrieves value into target (must pass pointer), target is left alone on a miss
+func (m *memoryCache) Get(ctx context.Context, key string, target any) error {
+	m.mu.Lock()
+	it := m.lookup(key)
+	m.mu.Unlock()
+	if it == nil {
+		return nil // key does not exist
+	}
+	return json.Unmarshal(it.data, target)
+}
+
+func (m *memoryCache) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.items[key]; ok {
+		m.remove(el)
+	}
+	delete(m.durable, key)
+	return nil
+}
+
+func (m *memoryCache) Exists(ctx context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lookup(key) != nil, nil
+}
+
+// lookup returns the live item for key, dropping it when it has expired. callers hold m.mu
+func (m *memoryCache) lookup(key string) *item {
+	if it, ok := m.durable[key]; ok {
+		if it.expired(time.Now()) {
+			delete(m.durable, key)
+			return nil
+		}
+		return it
+	}
+	el, ok := m.items[key]
+	if !ok {
+		return nil
+	}
+	it := el.Value.(*item)
+	if it.expired(time.Now()) {
+		m.remove(el)
+		return nil
+	}
+	m.order.MoveToFront(el)
+	return it
+}
+
+func (m *memoryCache) remove(el *list.Element) {
+	m.order.Remove(el)
+	delete(m.items, el.Value.(*item).key)
+}
+
+// sweep drops the durable items that have expired, nothing evicts them
+// otherwise. callers hold m.mu
+func (m *memoryCache) sweep() {
+	now := time.Now()
+	for key, it := range m.durable {
+		if it.expired(now) {
+			delete(m.durable, key)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package memoryCache
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/cache"
+)
+
+type value struct {
+	Name string `json:"name"`
+	N    int    `json:"n"`
+}
+
+func TestSetGetDelete(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(10)
+
+	if err := c.Set(ctx, "k", value{Name: "a", N: 1}, 0); err != nil {
+		t.Fatal(err)
+	}
+	var got value
+	if err := c.Get(ctx, "k", &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != (value{Name: "a", N: 1}) {
+		t.Fatalf("Get = %+v", got)
+	}
+
+	if err := c.Delete(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	// a miss leaves the target alone, like the redis cache
+	miss := value{Name: "untouched"}
+	if err := c.Get(ctx, "k", &miss); err != nil {
+		t.Fatal(err)
+	}
+	if miss.Name != "untouched" {
+		t.Fatalf("Get on a miss changed the target to %+v", miss)
+	}
+	if ok, _ := c.Exists(ctx, "k"); ok {
+		t.Fatal("Exists after Delete = true")
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(10)
+
+	c.Set(ctx, "short", "v", 20*time.Millisecond)
+	c.Set(ctx, "forever", "v", 0)
+	if ok, _ := c.Exists(ctx, "short"); !ok {
+		t.Fatal("Exists before expiry = false")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if ok, _ := c.Exists(ctx, "short"); ok {
+		t.Fatal("Exists after expiry = true")
+	}
+	if ok, _ := c.Exists(ctx, "forever"); !ok {
+		t.Fatal("an item without expiry expired")
+	}
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(2)
+
+	c.Set(ctx, "a", 1, 0)
+	c.Set(ctx, "b", 2, 0)
+	var n int
+	c.Get(ctx, "a", &n) // a is now more recent than b
+	c.Set(ctx, "c", 3, 0)
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if ok, _ := c.Exists(ctx, key); ok != want {
+			t.Errorf("Exists(%s) = %v, want %v", key, ok, want)
+		}
+	}
+}
+
+func TestKeepsUploadsPastCapacity(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(2)
+
+	upload, session := cache.GetKey(cache.UPLOAD, "u1"), cache.GetKey(cache.UPLOAD_SESSION, "s1")
+	c.Set(ctx, upload, value{Name: "tus", N: 1024}, time.Hour)
+	c.Set(ctx, session, value{Name: "session"}, time.Hour)
+	for i := 0; i < 10; i++ {
+		c.Set(ctx, cache.GetKey(cache.URL, strconv.Itoa(i)), i, time.Hour)
+	}
+
+	var got value
+	if err := c.Get(ctx, upload, &got); err != nil || got.N != 1024 {
+		t.Fatalf("upload after filling the cache = %+v, %v", got, err)
+	}
+	if ok, _ := c.Exists(ctx, session); !ok {
+		t.Fatal("upload session was evicted")
+	}
+	if ok, _ := c.Exists(ctx, cache.GetKey(cache.URL, "0")); ok {
+		t.Fatal("the oldest url was kept past capacity")
+	}
+
+	c.Delete(ctx, upload)
+	if ok, _ := c.Exists(ctx, upload); ok {
+		t.Fatal("Exists after Delete = true")
+	}
+}
+
+func TestUploadsStillExpire(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(2)
+
+	short := cache.GetKey(cache.UPLOAD, "short")
+	c.Set(ctx, short, "v", 20*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	// setting another upload sweeps the expired one out
+	c.Set(ctx, cache.GetKey(cache.UPLOAD, "next"), "v", time.Hour)
+	if _, ok := c.durable[short]; ok {
+		t.Fatal("an expired upload was kept")
+	}
+	if ok, _ := c.Exists(ctx, short); ok {
+		t.Fatal("Exists after expiry = true")
+	}
+}
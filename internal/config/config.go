@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -32,15 +33,106 @@ type S3 struct {
 	MinioEndpoint  string `yaml:"MINIO_ENDPOINT"`
 	MinioBucket    string `yaml:"MINIO_BUCKET"`
 }
+type Queue struct {
+	Backend           string        `yaml:"BACKEND"`
+	ConsumerGroup     string        `yaml:"CONSUMER_GROUP"`
+	VisibilityTimeout time.Duration `yaml:"VISIBILITY_TIMEOUT"`
+}
+type RetryPolicy struct {
+	MaxAttempts    int           `yaml:"MAX_ATTEMPTS"`
+	InitialBackoff time.Duration `yaml:"INITIAL_BACKOFF"`
+	MaxBackoff     time.Duration `yaml:"MAX_BACKOFF"`
+	Multiplier     float64       `yaml:"MULTIPLIER"`
+	// Jitter is a pointer so that 0 turns jitter off rather than meaning unset
+	Jitter *float64 `yaml:"JITTER"`
+}
+type Retry struct {
+	Default RetryPolicy            `yaml:"DEFAULT"`
+	Steps   map[string]RetryPolicy `yaml:"STEPS"`
+}
+type PipelineStep struct {
+	Name      string   `yaml:"NAME"`
+	DependsOn []string `yaml:"DEPENDS_ON"`
+	// FanOut is empty or renditions
+	FanOut string `yaml:"FAN_OUT"`
+}
+type Pipeline struct {
+	Steps []PipelineStep `yaml:"STEPS"`
+}
+type EncodingRung struct {
+	Label      string `yaml:"LABEL"`
+	Width      int    `yaml:"WIDTH"`
+	Height     int    `yaml:"HEIGHT"`
+	Bitrate    int    `yaml:"BITRATE"`
+	MaxBitrate int    `yaml:"MAX_BITRATE"`
+	BufSize    int    `yaml:"BUFSIZE"`
+}
+type EncodingAudio struct {
+	Codec    string `yaml:"CODEC"`
+	Bitrate  string `yaml:"BITRATE"`
+	Channels int    `yaml:"CHANNELS"`
+}
+type EncodingCodec struct {
+	Codec   string `yaml:"CODEC"`
+	Encoder string `yaml:"ENCODER"`
+	Preset  string `yaml:"PRESET"`
+	CRF     int    `yaml:"CRF"`
+}
+type EncodingProfile struct {
+	// VideoCodec is h264, hevc, vp9 or av1
+	VideoCodec string `yaml:"VIDEO_CODEC"`
+	Encoder    string `yaml:"ENCODER"`
+	Preset     string `yaml:"PRESET"`
+	// RateControl is crf or vbr
+	RateControl string `yaml:"RATE_CONTROL"`
+	CRF         int    `yaml:"CRF"`
+	// GOPSeconds is the keyframe interval of every rendition, 2 when unset
+	GOPSeconds int `yaml:"GOP_SECONDS"`
+	// Packaging is ts or cmaf
+	Packaging string `yaml:"PACKAGING"`
+	// AltCodecs are encoded next to VideoCodec, they need cmaf packaging
+	AltCodecs []EncodingCodec `yaml:"ALT_CODECS"`
+	Rungs     []EncodingRung  `yaml:"RUNGS"`
+	Audio     EncodingAudio   `yaml:"AUDIO"`
+}
+type Encoding struct {
+	DefaultProfile string                     `yaml:"DEFAULT_PROFILE"`
+	Profiles       map[string]EncodingProfile `yaml:"PROFILES"`
+}
+type Storage struct {
+	// Backend is s3 or local
+	Backend string `yaml:"BACKEND"`
+	// Root is where the local object store keeps its files
+	Root string `yaml:"ROOT"`
+	// PublicUrl is where the api serving the local store is reached, signed urls point there
+	PublicUrl  string        `yaml:"PUBLIC_URL"`
+	SigningKey string        `yaml:"SIGNING_KEY"`
+	UrlExpiry  time.Duration `yaml:"URL_EXPIRY"`
+}
+type Webhooks struct {
+	// Timeout bounds each delivery request
+	Timeout time.Duration `yaml:"TIMEOUT"`
+	// Retry is how failed deliveries are tried again before they are given up
+	Retry RetryPolicy `yaml:"RETRY"`
+	// AllowPrivate lets webhooks point at loopback and private addresses, for
+	// trying them out locally. Left off, nothing inside the network can be reached.
+	AllowPrivate bool `yaml:"ALLOW_PRIVATE"`
+}
 type Server struct {
 	HttpPort string `yaml:"HTTP_PORT"`
 }
 type Config struct {
-	DB     DB     `yaml:"DB"`
-	Redis  Redis  `yaml:"REDIS"`
-	S3     S3     `yaml:"S3"`
-	Server Server `yaml:"SERVER"`
-	Env    string `yaml:"ENV"`
+	DB       DB       `yaml:"DB"`
+	Redis    Redis    `yaml:"REDIS"`
+	Queue    Queue    `yaml:"QUEUE"`
+	Retry    Retry    `yaml:"RETRY"`
+	Pipeline Pipeline `yaml:"PIPELINE"`
+	Encoding Encoding `yaml:"ENCODING"`
+	S3       S3       `yaml:"S3"`
+	Storage  Storage  `yaml:"STORAGE"`
+	Webhooks Webhooks `yaml:"WEBHOOKS"`
+	Server   Server   `yaml:"SERVER"`
+	Env      string   `yaml:"ENV"`
 }
 
 func validateConfigPath(path string) error {
@@ -0,0 +1,297 @@
+package encoding
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/ak-ansari/mytube/internal/config"
+	"github.com/ak-ansari/mytube/internal/util"
+)
+
+const (
+	DefaultProfileName = "default"
+
+	CodecH264 = "h264"
+	CodecHEVC = "hevc"
+	CodecVP9  = "vp9"
+	CodecAV1  = "av1"
+
+	// RateCRF keeps a constant quality, capped by the rung's max bitrate when it has one
+	RateCRF = "crf"
+	// RateVBR targets the rung's bitrate
+	RateVBR = "vbr"
+
+	// PackagingTS gives HLS MPEG-TS segments and DASH its own fMP4 ones
+	PackagingTS = "ts"
+	// PackagingCMAF gives one set of fMP4 segments that HLS and DASH share
+	PackagingCMAF = "cmaf"
+)
+
+var ErrUnknownProfile = errors.New("unknown encoding profile")
+
+// encoders used for a codec unless the profile names another one
+var defaultEncoders = map[string]string{
+	CodecH264: "libx264",
+	CodecHEVC: "libx265",
+	CodecVP9:  "libvpx-vp9",
+	CodecAV1:  "libsvtav1",
+}
+
+// encoders a codec can be encoded with
+var encoders = map[string][]string{
+	CodecH264: {"libx264"},
+	CodecHEVC: {"libx265"},
+	CodecVP9:  {"libvpx-vp9"},
+	CodecAV1:  {"libsvtav1", "libaom-av1"},
+}
+
+// presets and crf that give about the quality of libx264 veryfast crf 22, the
+// preset is the -preset of x264, x265 and SVT-AV1 and the -cpu-used of libvpx and libaom
+var defaultPresets = map[string]string{
+	"libx264":    "veryfast",
+	"libx265":    "fast",
+	"libvpx-vp9": "4",
+	"libsvtav1":  "8",
+	"libaom-av1": "6",
+}
+var defaultCRF = map[string]int{
+	"libx264":    22,
+	"libx265":    26,
+	"libvpx-vp9": 33,
+	"libsvtav1":  35,
+	"libaom-av1": 32,
+}
+
+// VideoCodec is how the rungs of a profile are encoded with one codec
+type VideoCodec struct {
+	Codec   string `json:"codec"`
+	Encoder string `json:"encoder,omitempty"`
+	Preset  string `json:"preset"`
+	CRF     int    `json:"crf,omitempty"`
+}
+
+type Audio struct {
+	Codec    string `json:"codec"`
+	Bitrate  string `json:"bitrate"`
+	Channels int    `json:"channels"`
+}
+
+// Profile is everything that decides how a video is encoded and packaged. It is stored on
+// the video when it is uploaded, so reprocessing it later gives the same output
+// whatever the config says by then.
+type Profile struct {
+	Name        string `json:"name"`
+	Codec       string `json:"codec"`
+	Encoder     string `json:"encoder,omitempty"`
+	Preset      string `json:"preset"`
+	RateControl string `json:"rateControl"`
+	CRF         int    `json:"crf,omitempty"`
+	// AltCodecs are encoded over the same rungs next to Codec, players pick
+	// the ones they can decode
+	AltCodecs  []VideoCodec   `json:"altCodecs,omitempty"`
+	GOPSeconds int            `json:"gopSeconds,omitempty"`
+	Packaging  string         `json:"packaging,omitempty"`
+	Rungs      []util.Quality `json:"rungs"`
+	Audio      Audio          `json:"audio"`
+}
+
+// DefaultProfile is what videos are encoded with when nothing else is asked for.
+// Every rendition is packaged for DASH with -c copy, so keyframes are forced on
+// the same clock in all of them or players could not switch at segment boundaries.
+var DefaultProfile = Profile{
+	Name:        DefaultProfileName,
+	Codec:       CodecH264,
+	Encoder:     "libx264",
+	Preset:      "veryfast",
+	RateControl: RateCRF,
+	CRF:         22,
+	GOPSeconds:  2,
+	Packaging:   PackagingTS,
+	Rungs:       util.Sizes,
+	Audio:       Audio{Codec: "aac", Bitrate: "128k", Channels: 2},
+}
+
+// Profiles are the named profiles uploads can pick from
+type Profiles struct {
+	def      string
+	profiles map[string]Profile
+}
+
+func NewProfiles(conf config.Encoding) (*Profiles, error) {
+	p := &Profiles{def: conf.DefaultProfile, profiles: map[string]Profile{}}
+	for name, c := range conf.Profiles {
+		prof, err := fromConfig(name, c)
+		if err != nil {
+			return nil, err
+		}
+		p.profiles[name] = prof
+	}
+	if _, ok := p.profiles[DefaultProfileName]; !ok {
+		p.profiles[DefaultProfileName] = DefaultProfile
+	}
+	if p.def == "" {
+		p.def = DefaultProfileName
+	}
+	if _, ok := p.profiles[p.def]; !ok {
+		return nil, fmt.Errorf("encoding: default profile %s is not defined", p.def)
+	}
+	return p, nil
+}
+
+// Get returns the profile called name, the default one when name is empty
+func (p *Profiles) Get(name string) (Profile, error) {
+	if name == "" {
+		name = p.def
+	}
+	prof, ok := p.profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+	return prof, nil
+}
+
+func fromConfig(name string, c config.EncodingProfile) (Profile, error) {
+	prof := Profile{
+		Name:        name,
+		Codec:       c.VideoCodec,
+		Encoder:     c.Encoder,
+		Preset:      c.Preset,
+		RateControl: c.RateControl,
+		CRF:         c.CRF,
+		GOPSeconds:  c.GOPSeconds,
+		Packaging:   c.Packaging,
+		Audio:       Audio{Codec: c.Audio.Codec, Bitrate: c.Audio.Bitrate, Channels: c.Audio.Channels},
+	}
+	for _, alt := range c.AltCodecs {
+		prof.AltCodecs = append(prof.AltCodecs, VideoCodec{Codec: alt.Codec, Encoder: alt.Encoder, Preset: alt.Preset, CRF: alt.CRF})
+	}
+	for _, r := range c.Rungs {
+		prof.Rungs = append(prof.Rungs, util.Quality{
+			Label:      r.Label,
+			Width:      r.Width,
+			Height:     r.Height,
+			Bandwidth:  r.Bitrate,
+			MaxBitrate: r.MaxBitrate,
+			BufSize:    r.BufSize,
+		})
+	}
+	prof = prof.withDefaults()
+	return prof, prof.validate()
+}
+
+// withDefaults fills what the config left out from DefaultProfile
+func (p Profile) withDefaults() Profile {
+	d := DefaultProfile
+	if p.Codec == "" {
+		p.Codec = d.Codec
+	}
+	if p.RateControl == "" {
+		p.RateControl = d.RateControl
+	}
+	primary := p.withCodecDefaults(VideoCodec{Codec: p.Codec, Encoder: p.Encoder, Preset: p.Preset, CRF: p.CRF})
+	p.Encoder, p.Preset, p.CRF = primary.Encoder, primary.Preset, primary.CRF
+	for i, alt := range p.AltCodecs {
+		p.AltCodecs[i] = p.withCodecDefaults(alt)
+	}
+	if p.GOPSeconds == 0 {
+		p.GOPSeconds = d.GOPSeconds
+	}
+	if p.Packaging == "" {
+		p.Packaging = d.Packaging
+	}
+	if len(p.Rungs) == 0 {
+		p.Rungs = append([]util.Quality(nil), d.Rungs...)
+	}
+	if p.Audio.Codec == "" {
+		p.Audio.Codec = d.Audio.Codec
+	}
+	if p.Audio.Bitrate == "" {
+		p.Audio.Bitrate = d.Audio.Bitrate
+	}
+	if p.Audio.Channels == 0 {
+		p.Audio.Channels = d.Audio.Channels
+	}
+	// the ladder walks the rungs from the bottom up
+	sort.SliceStable(p.Rungs, func(i, j int) bool { return p.Rungs[i].Height < p.Rungs[j].Height })
+	return p
+}
+
+func (p Profile) withCodecDefaults(c VideoCodec) VideoCodec {
+	if c.Encoder == "" {
+		c.Encoder = defaultEncoders[c.Codec]
+	}
+	if c.Preset == "" {
+		c.Preset = defaultPresets[c.Encoder]
+	}
+	if p.RateControl == RateCRF && c.CRF == 0 {
+		c.CRF = defaultCRF[c.Encoder]
+	}
+	return c
+}
+
+// VideoCodecs are the codecs every rung is encoded with, the primary one first
+func (p Profile) VideoCodecs() []VideoCodec {
+	primary := VideoCodec{Codec: p.Codec, Encoder: p.Encoder, Preset: p.Preset, CRF: p.CRF}
+	if primary.Encoder == "" {
+		// snapshots from before encoders could be picked
+		primary.Encoder = defaultEncoders[primary.Codec]
+	}
+	return append([]VideoCodec{primary}, p.AltCodecs...)
+}
+
+// VideoCodec returns the settings of codec, the primary codec for an empty one
+func (p Profile) VideoCodec(codec string) (VideoCodec, bool) {
+	for _, c := range p.VideoCodecs() {
+		if c.Codec == codec || codec == "" {
+			return c, true
+		}
+	}
+	return VideoCodec{}, false
+}
+
+func (p Profile) validate() error {
+	seen := map[string]bool{}
+	for _, c := range p.VideoCodecs() {
+		if !slices.Contains(encoders[c.Codec], c.Encoder) {
+			return fmt.Errorf("encoding: profile %s has unsupported codec %s (encoder %s)", p.Name, c.Codec, c.Encoder)
+		}
+		if seen[c.Codec] {
+			return fmt.Errorf("encoding: profile %s lists codec %s twice", p.Name, c.Codec)
+		}
+		seen[c.Codec] = true
+		// only fMP4 carries them in both HLS and DASH
+		if c.Codec != CodecH264 && p.Packaging != PackagingCMAF {
+			return fmt.Errorf("encoding: profile %s needs cmaf packaging for codec %s", p.Name, c.Codec)
+		}
+	}
+	switch p.RateControl {
+	case RateCRF:
+	case RateVBR:
+		for _, r := range p.Rungs {
+			if r.Bandwidth <= 0 {
+				return fmt.Errorf("encoding: profile %s uses vbr but rung %s has no bitrate", p.Name, r.Label)
+			}
+		}
+	default:
+		return fmt.Errorf("encoding: profile %s has unknown rate control %s", p.Name, p.RateControl)
+	}
+	// an unset gop is defaulted before this, what is left is a negative one.
+	// DASH and CMAF cut every rendition at the same times, which only works
+	// with their keyframes forced there.
+	if p.GOPSeconds <= 0 {
+		return fmt.Errorf("encoding: profile %s has a gop of %d seconds, it must be positive", p.Name, p.GOPSeconds)
+	}
+	switch p.Packaging {
+	case PackagingTS, PackagingCMAF:
+	default:
+		return fmt.Errorf("encoding: profile %s has unknown packaging %s", p.Name, p.Packaging)
+	}
+	for _, r := range p.Rungs {
+		if r.Label == "" || r.Height <= 0 {
+			return fmt.Errorf("encoding: profile %s has a rung without a label or height", p.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package encoding
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ak-ansari/mytube/internal/config"
+)
+
+func TestFromConfigDefaults(t *testing.T) {
+	prof, err := fromConfig("plain", config.EncodingProfile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prof.Codec != CodecH264 || prof.Encoder != "libx264" || prof.Packaging != PackagingTS {
+		t.Fatalf("defaults = %s/%s/%s", prof.Codec, prof.Encoder, prof.Packaging)
+	}
+	// DASH is packaged from every profile, it needs aligned keyframes
+	if prof.GOPSeconds != DefaultProfile.GOPSeconds || prof.GOPSeconds <= 0 {
+		t.Fatalf("GOPSeconds = %d, want %d", prof.GOPSeconds, DefaultProfile.GOPSeconds)
+	}
+}
+
+func TestFromConfigValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.EncodingProfile
+		err  string // empty when the profile is valid
+	}{
+		{
+			name: "cmaf with gop",
+			conf: config.EncodingProfile{Packaging: PackagingCMAF, GOPSeconds: 2,
+				AltCodecs: []config.EncodingCodec{{Codec: CodecHEVC}}},
+		},
+		{
+			name: "ts with negative gop",
+			conf: config.EncodingProfile{Packaging: PackagingTS, GOPSeconds: -1},
+			err:  "must be positive",
+		},
+		{
+			name: "cmaf with negative gop",
+			conf: config.EncodingProfile{Packaging: PackagingCMAF, GOPSeconds: -1},
+			err:  "must be positive",
+		},
+		{
+			name: "alt codecs with negative gop",
+			conf: config.EncodingProfile{Packaging: PackagingCMAF, GOPSeconds: -1,
+				AltCodecs: []config.EncodingCodec{{Codec: CodecAV1}}},
+			err: "must be positive",
+		},
+		{
+			name: "hevc over ts",
+			conf: config.EncodingProfile{VideoCodec: CodecHEVC},
+			err:  "needs cmaf packaging",
+		},
+		{
+			name: "vbr without bitrates",
+			conf: config.EncodingProfile{RateControl: RateVBR, Rungs: []config.EncodingRung{{Label: "360p", Height: 360}}},
+			err:  "has no bitrate",
+		},
+		{
+			name: "codec twice",
+			conf: config.EncodingProfile{Packaging: PackagingCMAF, AltCodecs: []config.EncodingCodec{{Codec: CodecH264}}},
+			err:  "twice",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fromConfig(tt.name, tt.conf)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("err = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDefaultProfileIsValid(t *testing.T) {
+	if err := DefaultProfile.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
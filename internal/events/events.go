@@ -0,0 +1,47 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	TypeStatus       = "status"
+	TypeStepStarted  = "step_started"
+	TypeStepFinished = "step_finished"
+	TypeStepRetrying = "step_retrying"
+	TypeStepFailed   = "step_failed"
+	TypeProgress     = "progress"
+)
+
+// Event is something that happened to a video while it is processed
+type Event struct {
+	Type    string    `json:"type"`
+	VideoID string    `json:"videoId"`
+	Status  string    `json:"status,omitempty"`
+	Step    string    `json:"step,omitempty"`
+	Variant string    `json:"variant,omitempty"`
+	Attempt int       `json:"attempt,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	At      time.Time `json:"at"`
+
+	// set on progress events
+	Progress float64 `json:"progress,omitempty"`
+	Speed    float64 `json:"speed,omitempty"`
+	FPS      float64 `json:"fps,omitempty"`
+}
+
+// Channel is the pub/sub channel of the events of a video
+func Channel(videoId string) string {
+	return fmt.Sprintf("video_events:%s", videoId)
+}
+
+// Bus carries events from the workers to whoever watches the video. Delivery
+// is best effort: a subscriber only sees what is published while it listens.
+type Bus interface {
+	Publish(ctx context.Context, e Event) error
+	// Subscribe returns the events of videoId until ctx is done, when the
+	// channel is closed. Events published after it returns are delivered.
+	Subscribe(ctx context.Context, videoId string) (<-chan Event, error)
+}
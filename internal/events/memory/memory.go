@@ -0,0 +1,57 @@
+package memoryEvents
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ak-ansari/mytube/internal/events"
+)
+
+// subscriberBuffer is how many events a slow subscriber can fall behind,
+// past it events are dropped rather than blocking the workers
+const subscriberBuffer = 64
+
+// memoryBus delivers events inside the process, for when the api and the
+// workers run together
+type memoryBus struct {
+	mu   sync.Mutex
+	subs map[string]map[chan events.Event]struct{}
+}
+
+func NewMemoryBus() *memoryBus {
+	return &memoryBus{subs: map[string]map[chan events.Event]struct{}{}}
+}
+
+func (m *memoryBus) Publish(ctx context.Context, e events.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ch := range m.subs[e.VideoID] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+	return nil
+}
+
+func (m *memoryBus) Subscribe(ctx context.Context, videoId string) (<-chan events.Event, error) {
+	ch := make(chan events.Event, subscriberBuffer)
+	m.mu.Lock()
+	if m.subs[videoId] == nil {
+		m.subs[videoId] = map[chan events.Event]struct{}{}
+	}
+	m.subs[videoId][ch] = struct{}{}
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		delete(m.subs[videoId], ch)
+		if len(m.subs[videoId]) == 0 {
+			delete(m.subs, videoId)
+		}
+		m.mu.Unlock()
+		close(ch)
+	}()
+	return ch, nil
+}
@@ -0,0 +1,66 @@
+package redisEvents
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ak-ansari/mytube/internal/events"
+	"github.com/redis/go-redis/v9"
+)
+
+// subscriberBuffer is how many events a slow subscriber can fall behind
+const subscriberBuffer = 64
+
+// redisBus publishes events over redis pub/sub, so the api sees what the
+// workers do wherever they run
+type redisBus struct {
+	client *redis.Client
+}
+
+func NewRedisBus(c *redis.Client) *redisBus {
+	return &redisBus{client: c}
+}
+
+func (r *redisBus) Publish(ctx context.Context, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, events.Channel(e.VideoID), data).Err()
+}
+
+func (r *redisBus) Subscribe(ctx context.Context, videoId string) (<-chan events.Event, error) {
+	ps := r.client.Subscribe(ctx, events.Channel(videoId))
+	// wait for the confirmation, events published before it would be lost
+	if _, err := ps.Receive(ctx); err != nil {
+		ps.Close()
+		return nil, err
+	}
+
+	out := make(chan events.Event, subscriberBuffer)
+	go func() {
+		defer close(out)
+		defer ps.Close()
+		msgs := ps.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				var e events.Event
+				if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+					continue
+				}
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
@@ -3,15 +3,19 @@ package jobs
 type Step string
 
 const (
-	StepValidate  Step = "validate"
-	StepTranscode Step = "transcode"
-	StepSegment   Step = "segment"
-	StepChecksum  Step = "checksum"
-	StepThumbs    Step = "thumbnail"
-	StepPublish   Step = "publish"
+	StepValidate    Step = "validate"
+	StepTranscode   Step = "transcode"
+	StepSegment     Step = "segment"
+	StepDash        Step = "dash"
+	StepChecksum    Step = "checksum"
+	StepThumbs      Step = "thumbnail"
+	StepFingerprint Step = "fingerprint"
+	StepPublish     Step = "publish"
 )
 
 type JobPayload struct {
 	VideoID string `json:"videoId"`
 	Step    Step   `json:"step"`
+	// Variant tells apart the jobs of a fanned out step, e.g. the rendition to transcode
+	Variant string `json:"variant,omitempty"`
 }
@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"fmt"
+
+	"github.com/ak-ansari/mytube/internal/config"
+)
+
+// FanOutRenditions runs a step as one job per rendition of the ladder
+const FanOutRenditions = "renditions"
+
+// PipelineStep is a step and the steps that have to succeed before it runs
+type PipelineStep struct {
+	Step      Step
+	DependsOn []Step
+	// FanOut splits the step into one job per variant, the step is done once
+	// all of them are
+	FanOut string
+}
+
+// DefaultPipeline is used when the config doesn't define one. The thumbnail
+// and the fingerprint only need the original, so they run alongside transcoding.
+var DefaultPipeline = []PipelineStep{
+	{Step: StepValidate},
+	{Step: StepTranscode, DependsOn: []Step{StepValidate}, FanOut: FanOutRenditions},
+	{Step: StepThumbs, DependsOn: []Step{StepValidate}},
+	{Step: StepFingerprint, DependsOn: []Step{StepValidate}},
+	{Step: StepSegment, DependsOn: []Step{StepTranscode}},
+	{Step: StepDash, DependsOn: []Step{StepTranscode}},
+	{Step: StepChecksum, DependsOn: []Step{StepSegment, StepDash}},
+	{Step: StepPublish, DependsOn: []Step{StepChecksum, StepThumbs, StepFingerprint}},
+}
+
+// Pipeline is the DAG of steps every uploaded video goes through
+type Pipeline struct {
+	order      []Step // topological
+	dependsOn  map[Step][]Step
+	dependents map[Step][]Step
+	fanOut     map[Step]string
+}
+
+func NewPipeline(conf config.Pipeline) (*Pipeline, error) {
+	if len(conf.Steps) == 0 {
+		return BuildPipeline(DefaultPipeline)
+	}
+	steps := make([]PipelineStep, 0, len(conf.Steps))
+	for _, s := range conf.Steps {
+		ps := PipelineStep{Step: Step(s.Name), FanOut: s.FanOut}
+		for _, dep := range s.DependsOn {
+			ps.DependsOn = append(ps.DependsOn, Step(dep))
+		}
+		steps = append(steps, ps)
+	}
+	return BuildPipeline(steps)
+}
+
+// BuildPipeline checks that steps form a DAG: no duplicates, no unknown
+// dependencies and no cycles
+func BuildPipeline(steps []PipelineStep) (*Pipeline, error) {
+	p := &Pipeline{
+		dependsOn:  map[Step][]Step{},
+		dependents: map[Step][]Step{},
+		fanOut:     map[Step]string{},
+	}
+	for _, s := range steps {
+		if s.Step == "" {
+			return nil, fmt.Errorf("pipeline: step without a name")
+		}
+		if _, ok := p.dependsOn[s.Step]; ok {
+			return nil, fmt.Errorf("pipeline: step %s is defined twice", s.Step)
+		}
+		switch s.FanOut {
+		case "", FanOutRenditions:
+		default:
+			return nil, fmt.Errorf("pipeline: step %s has unknown fan out %q", s.Step, s.FanOut)
+		}
+		p.dependsOn[s.Step] = s.DependsOn
+		if s.FanOut != "" {
+			p.fanOut[s.Step] = s.FanOut
+		}
+	}
+	for _, s := range steps {
+		for _, dep := range s.DependsOn {
+			if _, ok := p.dependsOn[dep]; !ok {
+				return nil, fmt.Errorf("pipeline: step %s depends on unknown step %s", s.Step, dep)
+			}
+			p.dependents[dep] = append(p.dependents[dep], s.Step)
+		}
+	}
+
+	// Kahn's algorithm, keeping the config order among steps that are ready together
+	pending := map[Step]int{}
+	for _, s := range steps {
+		pending[s.Step] = len(s.DependsOn)
+	}
+	for len(p.order) < len(steps) {
+		progressed := false
+		for _, s := range steps {
+			if pending[s.Step] != 0 {
+				continue
+			}
+			pending[s.Step] = -1
+			p.order = append(p.order, s.Step)
+			for _, next := range p.dependents[s.Step] {
+				pending[next]--
+			}
+			progressed = true
+		}
+		if !progressed {
+			return nil, fmt.Errorf("pipeline: steps have a dependency cycle")
+		}
+	}
+	return p, nil
+}
+
+// Steps returns every step, each one after the steps it depends on
+func (p *Pipeline) Steps() []Step {
+	return p.order
+}
+
+// Roots are the steps enqueued when a video is uploaded
+func (p *Pipeline) Roots() []Step {
+	var roots []Step
+	for _, s := range p.order {
+		if len(p.dependsOn[s]) == 0 {
+			roots = append(roots, s)
+		}
+	}
+	return roots
+}
+
+func (p *Pipeline) DependsOn(step Step) []Step {
+	return p.dependsOn[step]
+}
+
+// Dependents are the steps that wait on step
+func (p *Pipeline) Dependents(step Step) []Step {
+	return p.dependents[step]
+}
+
+// Downstream are the steps that wait on step directly or through other steps,
+// in pipeline order
+func (p *Pipeline) Downstream(step Step) []Step {
+	down := map[Step]bool{step: true}
+	var out []Step
+	for _, s := range p.order {
+		for _, dep := range p.dependsOn[s] {
+			if down[dep] {
+				down[s] = true
+				out = append(out, s)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func (p *Pipeline) Has(step Step) bool {
+	_, ok := p.dependsOn[step]
+	return ok
+}
+
+// FanOut is how step is split into jobs, empty when it runs as a single one
+func (p *Pipeline) FanOut(step Step) string {
+	return p.fanOut[step]
+}
@@ -0,0 +1,37 @@
+package jobs
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDownstream(t *testing.T) {
+	p, err := BuildPipeline(DefaultPipeline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		step Step
+		want []Step
+	}{
+		{StepValidate, []Step{StepTranscode, StepThumbs, StepFingerprint, StepSegment, StepDash, StepChecksum, StepPublish}},
+		{StepTranscode, []Step{StepSegment, StepDash, StepChecksum, StepPublish}},
+		{StepThumbs, []Step{StepPublish}},
+		{StepPublish, nil},
+	}
+	for _, tt := range tests {
+		if got := p.Downstream(tt.step); !slices.Equal(got, tt.want) {
+			t.Errorf("Downstream(%s) = %v, want %v", tt.step, got, tt.want)
+		}
+	}
+}
+
+func TestBuildPipelineRejectsCycles(t *testing.T) {
+	_, err := BuildPipeline([]PipelineStep{
+		{Step: "a", DependsOn: []Step{"b"}},
+		{Step: "b", DependsOn: []Step{"a"}},
+	})
+	if err == nil {
+		t.Fatal("BuildPipeline of a cycle: want an error")
+	}
+}
@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/config"
+)
+
+// RetryPolicy decides how often and how fast a failed step is tried again
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the fraction of the backoff that is randomized, 0.2 means ±20%
+	Jitter float64
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 10 * time.Second,
+	MaxBackoff:     10 * time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// Backoff returns the delay before the next try, after attempt tries have failed
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// Exhausted reports whether attempt was the last try allowed
+func (p RetryPolicy) Exhausted(attempt int) bool {
+	return attempt >= p.MaxAttempts
+}
+
+// RetryPolicies holds the policy of each step
+type RetryPolicies struct {
+	Default RetryPolicy
+	Steps   map[Step]RetryPolicy
+}
+
+func NewRetryPolicies(conf config.Retry) RetryPolicies {
+	rp := RetryPolicies{
+		Default: fromConfig(conf.Default, DefaultRetryPolicy),
+		Steps:   map[Step]RetryPolicy{},
+	}
+	for step, p := range conf.Steps {
+		rp.Steps[Step(step)] = fromConfig(p, rp.Default)
+	}
+	return rp
+}
+
+func (rp RetryPolicies) For(step Step) RetryPolicy {
+	if p, ok := rp.Steps[step]; ok {
+		return p
+	}
+	if rp.Default.MaxAttempts == 0 {
+		return DefaultRetryPolicy
+	}
+	return rp.Default
+}
+
+// NewRetryPolicy is the policy in c, what it leaves out comes from base
+func NewRetryPolicy(c config.RetryPolicy, base RetryPolicy) RetryPolicy {
+	return fromConfig(c, base)
+}
+
+// fromConfig is the policy in c with the fields it leaves empty taken from base.
+// A jitter set to 0 stays 0, only a missing one is inherited.
+func fromConfig(c config.RetryPolicy, base RetryPolicy) RetryPolicy {
+	p := base
+	if c.MaxAttempts > 0 {
+		p.MaxAttempts = c.MaxAttempts
+	}
+	if c.InitialBackoff > 0 {
+		p.InitialBackoff = c.InitialBackoff
+	}
+	if c.MaxBackoff > 0 {
+		p.MaxBackoff = c.MaxBackoff
+	}
+	if c.Multiplier >= 1 {
+		p.Multiplier = c.Multiplier
+	}
+	if c.Jitter != nil && *c.Jitter >= 0 {
+		p.Jitter = *c.Jitter
+	}
+	return p
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one that retrying won't fix, the job goes straight to the dead letters
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
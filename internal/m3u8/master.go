@@ -0,0 +1,186 @@
+package m3u8
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Media is an EXT-X-MEDIA rendition. Without a URI the rendition is muxed into
+// the variants of its group.
+type Media struct {
+	Type       string // AUDIO, VIDEO, SUBTITLES
+	GroupID    string
+	Name       string
+	Language   string
+	Default    bool
+	AutoSelect bool
+	Channels   int
+	URI        string
+}
+
+// Variant is an EXT-X-STREAM-INF entry
+type Variant struct {
+	URI              string
+	Bandwidth        int
+	AverageBandwidth int
+	Width, Height    int
+	Codecs           []string
+	FrameRate        float64
+	Audio            string // GROUP-ID of the audio renditions
+}
+
+// IFrameVariant is an EXT-X-I-FRAME-STREAM-INF entry
+type IFrameVariant struct {
+	URI           string
+	Bandwidth     int
+	Width, Height int
+	Codecs        []string
+}
+
+// Master is a master (multivariant) playlist
+type Master struct {
+	Version             int
+	IndependentSegments bool
+	Media               []Media
+	Variants            []Variant
+	IFrames             []IFrameVariant
+}
+
+func (m *Master) Encode() string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	if m.Version > 0 {
+		fmt.Fprintf(&b, "#EXT-X-VERSION:%d\n", m.Version)
+	}
+	if m.IndependentSegments {
+		b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	}
+	for _, media := range m.Media {
+		attrs := attrList{}
+		attrs.enum("TYPE", media.Type)
+		attrs.quoted("GROUP-ID", media.GroupID)
+		attrs.quoted("NAME", media.Name)
+		attrs.quoted("LANGUAGE", media.Language)
+		attrs.enum("DEFAULT", yesNo(media.Default))
+		attrs.enum("AUTOSELECT", yesNo(media.AutoSelect))
+		if media.Channels > 0 {
+			attrs.quoted("CHANNELS", strconv.Itoa(media.Channels))
+		}
+		attrs.quoted("URI", media.URI)
+		fmt.Fprintf(&b, "#EXT-X-MEDIA:%s\n", attrs)
+	}
+	for _, v := range m.Variants {
+		attrs := attrList{}
+		attrs.int("BANDWIDTH", v.Bandwidth)
+		attrs.int("AVERAGE-BANDWIDTH", v.AverageBandwidth)
+		attrs.quoted("CODECS", strings.Join(v.Codecs, ","))
+		attrs.resolution(v.Width, v.Height)
+		if v.FrameRate > 0 {
+			attrs.enum("FRAME-RATE", strconv.FormatFloat(math.Round(v.FrameRate*1000)/1000, 'f', 3, 64))
+		}
+		attrs.quoted("AUDIO", v.Audio)
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:%s\n%s\n", attrs, v.URI)
+	}
+	for _, f := range m.IFrames {
+		attrs := attrList{}
+		attrs.int("BANDWIDTH", f.Bandwidth)
+		attrs.quoted("CODECS", strings.Join(f.Codecs, ","))
+		attrs.resolution(f.Width, f.Height)
+		attrs.quoted("URI", f.URI)
+		fmt.Fprintf(&b, "#EXT-X-I-FRAME-STREAM-INF:%s\n", attrs)
+	}
+	return b.String()
+}
+
+// IFrame is one I-frame, a byte range of a media segment
+type IFrame struct {
+	URI      string
+	Duration float64
+	Offset   int64
+	Length   int64
+}
+
+// IFramePlaylist lists the I-frames of a rendition for trick play and scrubbing
+type IFramePlaylist struct {
+	// Map is the init segment of fMP4 renditions
+	Map    string
+	Frames []IFrame
+}
+
+func (p *IFramePlaylist) Encode() string {
+	target := 1.0
+	for _, f := range p.Frames {
+		target = math.Max(target, f.Duration)
+	}
+	// byte ranges and I-frames only need 4, an init segment with them 5
+	version := 4
+	if p.Map != "" {
+		version = 5
+	}
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&b, "#EXT-X-VERSION:%d\n", version)
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(target)))
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	b.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	b.WriteString("#EXT-X-I-FRAMES-ONLY\n")
+	if p.Map != "" {
+		fmt.Fprintf(&b, "#EXT-X-MAP:URI=%q\n", p.Map)
+	}
+	for _, f := range p.Frames {
+		fmt.Fprintf(&b, "#EXTINF:%.6f,\n#EXT-X-BYTERANGE:%d@%d\n%s\n", f.Duration, f.Length, f.Offset, f.URI)
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.String()
+}
+
+// Bandwidth is the peak bit rate of the I-frames
+func (p *IFramePlaylist) Bandwidth() int {
+	peak := 0
+	for _, f := range p.Frames {
+		if f.Duration > 0 {
+			peak = max(peak, int(math.Ceil(float64(f.Length*8)/f.Duration)))
+		}
+	}
+	return peak
+}
+
+// attrList writes an attribute list, skipping empty values
+type attrList []string
+
+func (a *attrList) quoted(key, value string) {
+	if value != "" {
+		*a = append(*a, fmt.Sprintf("%s=%q", key, value))
+	}
+}
+
+func (a *attrList) enum(key, value string) {
+	if value != "" {
+		*a = append(*a, key+"="+value)
+	}
+}
+
+func (a *attrList) int(key string, value int) {
+	if value > 0 {
+		*a = append(*a, fmt.Sprintf("%s=%d", key, value))
+	}
+}
+
+func (a *attrList) resolution(w, h int) {
+	if w > 0 && h > 0 {
+		*a = append(*a, fmt.Sprintf("RESOLUTION=%dx%d", w, h))
+	}
+}
+
+func (a attrList) String() string {
+	return strings.Join(a, ",")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
@@ -0,0 +1,88 @@
+package m3u8
+
+import "testing"
+
+func TestMasterEncode(t *testing.T) {
+	m := &Master{
+		Version:             6,
+		IndependentSegments: true,
+		Media: []Media{{
+			Type: "AUDIO", GroupID: "audio", Name: "default", Language: "en",
+			Default: true, AutoSelect: true, Channels: 2, URI: "media_2.m3u8",
+		}},
+		Variants: []Variant{
+			{
+				URI: "media_0.m3u8", Bandwidth: 1_200_000, AverageBandwidth: 900_000,
+				Width: 640, Height: 360, Codecs: []string{"avc1.64001e", "mp4a.40.2"},
+				FrameRate: 29.97002997, Audio: "audio",
+			},
+			// what isn't known is left out
+			{URI: "media_1.m3u8", Bandwidth: 3_000_000},
+		},
+		IFrames: []IFrameVariant{{
+			URI: "media_0_iframes.m3u8", Bandwidth: 150_000, Width: 640, Height: 360, Codecs: []string{"avc1.64001e"},
+		}},
+	}
+	want := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="default",LANGUAGE="en",DEFAULT=YES,AUTOSELECT=YES,CHANNELS="2",URI="media_2.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1200000,AVERAGE-BANDWIDTH=900000,CODECS="avc1.64001e,mp4a.40.2",RESOLUTION=640x360,FRAME-RATE=29.970,AUDIO="audio"
+media_0.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=3000000
+media_1.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=150000,CODECS="avc1.64001e",RESOLUTION=640x360,URI="media_0_iframes.m3u8"
+`
+	if got := m.Encode(); got != want {
+		t.Fatalf("Encode =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestIFramePlaylist(t *testing.T) {
+	p := &IFramePlaylist{Frames: []IFrame{
+		{URI: "360p_000.ts", Duration: 4, Length: 50_000},
+		{URI: "360p_001.ts", Duration: 2.5, Length: 60_000},
+	}}
+	want := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-I-FRAMES-ONLY
+#EXTINF:4.000000,
+#EXT-X-BYTERANGE:50000@0
+360p_000.ts
+#EXTINF:2.500000,
+#EXT-X-BYTERANGE:60000@0
+360p_001.ts
+#EXT-X-ENDLIST
+`
+	if got := p.Encode(); got != want {
+		t.Fatalf("Encode =\n%s\nwant\n%s", got, want)
+	}
+	// 60000 bytes shown for 2.5 s
+	if bw := p.Bandwidth(); bw != 192_000 {
+		t.Fatalf("Bandwidth = %d, want 192000", bw)
+	}
+}
+
+func TestIFramePlaylistWithInitSegment(t *testing.T) {
+	p := &IFramePlaylist{Map: "init_0.m4s", Frames: []IFrame{
+		{URI: "chunk_0_00001.m4s", Duration: 0.5, Length: 1000},
+	}}
+	want := `#EXTM3U
+#EXT-X-VERSION:5
+#EXT-X-TARGETDURATION:1
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-I-FRAMES-ONLY
+#EXT-X-MAP:URI="init_0.m4s"
+#EXTINF:0.500000,
+#EXT-X-BYTERANGE:1000@0
+chunk_0_00001.m4s
+#EXT-X-ENDLIST
+`
+	if got := p.Encode(); got != want {
+		t.Fatalf("Encode =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,115 @@
+// Package m3u8 reads the media playlists ffmpeg writes and writes the master
+// and I-frame playlists that describe them (RFC 8216).
+package m3u8
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Segment is one media segment of a playlist
+type Segment struct {
+	URI      string
+	Duration float64
+}
+
+// MediaPlaylist is the part of a media playlist the master playlist needs
+type MediaPlaylist struct {
+	TargetDuration int
+	// Map is the URI of the init segment of fMP4 playlists
+	Map      string
+	Segments []Segment
+}
+
+func ParseMedia(r io.Reader) (*MediaPlaylist, error) {
+	sc := bufio.NewScanner(r)
+	if !sc.Scan() || strings.TrimSpace(sc.Text()) != "#EXTM3U" {
+		return nil, fmt.Errorf("m3u8: missing #EXTM3U header")
+	}
+	p := &MediaPlaylist{}
+	duration := -1.0
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			d, err := strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"))
+			if err != nil {
+				return nil, fmt.Errorf("m3u8: bad target duration: %w", err)
+			}
+			p.TargetDuration = d
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			p.Map = attributes(strings.TrimPrefix(line, "#EXT-X-MAP:"))["URI"]
+		case strings.HasPrefix(line, "#EXTINF:"):
+			v, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			d, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("m3u8: bad segment duration: %w", err)
+			}
+			duration = d
+		case strings.HasPrefix(line, "#"):
+		default:
+			if duration < 0 {
+				return nil, fmt.Errorf("m3u8: segment %s without #EXTINF", line)
+			}
+			p.Segments = append(p.Segments, Segment{URI: line, Duration: duration})
+			duration = -1
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Bandwidth measures the peak and average bit rate of the playlist from the
+// sizes of its segments, as BANDWIDTH and AVERAGE-BANDWIDTH ask for
+func (p *MediaPlaylist) Bandwidth(size func(uri string) (int64, error)) (peak, average int, err error) {
+	var total int64
+	var duration float64
+	for _, s := range p.Segments {
+		n, err := size(s.URI)
+		if err != nil {
+			return 0, 0, err
+		}
+		total += n
+		duration += s.Duration
+		if s.Duration > 0 {
+			peak = max(peak, int(math.Ceil(float64(n*8)/s.Duration)))
+		}
+	}
+	if duration > 0 {
+		average = int(math.Ceil(float64(total*8) / duration))
+	}
+	return peak, average, nil
+}
+
+// attributes parses an attribute list, KEY=VALUE,KEY="VALUE"
+func attributes(s string) map[string]string {
+	attrs := map[string]string{}
+	for s != "" {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else if i := strings.Index(rest, ","); i >= 0 {
+			value, rest = rest[:i], rest[i:]
+		} else {
+			value, rest = rest, ""
+		}
+		attrs[strings.TrimSpace(key)] = value
+		s = strings.TrimPrefix(rest, ",")
+	}
+	return attrs
+}
@@ -0,0 +1,86 @@
+package m3u8
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMedia(t *testing.T) {
+	const playlist = `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:1
+#EXT-X-MAP:URI="init_0.m4s"
+#EXTINF:4.000000,
+chunk_0_00001.m4s
+#EXTINF:3.500,
+chunk_0_00002.m4s
+
+#EXTINF:1.25,title
+chunk_0_00003.m4s
+#EXT-X-ENDLIST
+`
+	p, err := ParseMedia(strings.NewReader(playlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.TargetDuration != 4 || p.Map != "init_0.m4s" {
+		t.Fatalf("TargetDuration = %d, Map = %q", p.TargetDuration, p.Map)
+	}
+	want := []Segment{
+		{URI: "chunk_0_00001.m4s", Duration: 4},
+		{URI: "chunk_0_00002.m4s", Duration: 3.5},
+		{URI: "chunk_0_00003.m4s", Duration: 1.25},
+	}
+	if len(p.Segments) != len(want) {
+		t.Fatalf("got %d segments, want %d", len(p.Segments), len(want))
+	}
+	for i, s := range p.Segments {
+		if s != want[i] {
+			t.Errorf("segment %d = %+v, want %+v", i, s, want[i])
+		}
+	}
+}
+
+func TestParseMediaErrors(t *testing.T) {
+	tests := map[string]string{
+		"no header":           "#EXTINF:4,\na.ts\n",
+		"segment without inf": "#EXTM3U\na.ts\n",
+		"bad duration":        "#EXTM3U\n#EXTINF:four,\na.ts\n",
+		"bad target duration": "#EXTM3U\n#EXT-X-TARGETDURATION:x\n",
+	}
+	for name, playlist := range tests {
+		if _, err := ParseMedia(strings.NewReader(playlist)); err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
+
+func TestBandwidth(t *testing.T) {
+	p := &MediaPlaylist{Segments: []Segment{
+		{URI: "a.ts", Duration: 4},
+		{URI: "b.ts", Duration: 2},
+	}}
+	sizes := map[string]int64{"a.ts": 400_000, "b.ts": 300_000}
+	peak, average, err := p.Bandwidth(func(uri string) (int64, error) { return sizes[uri], nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a.ts is 800 kbit/s, b.ts 1200 kbit/s, both together 700 kB in 6 s
+	if peak != 1_200_000 || average != 933_334 {
+		t.Fatalf("Bandwidth = %d, %d, want 1200000, 933334", peak, average)
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	got := attributes(`URI="init.mp4",BYTERANGE="720@0",TYPE=AUDIO,NAME="a,b"`)
+	want := map[string]string{"URI": "init.mp4", "BYTERANGE": "720@0", "TYPE": "AUDIO", "NAME": "a,b"}
+	if len(got) != len(want) {
+		t.Fatalf("attributes = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// avc profile_idc and constraint flags by the profile names ffprobe reports
+var avcProfiles = map[string][2]byte{
+	"Constrained Baseline":  {0x42, 0xE0},
+	"Baseline":              {0x42, 0x00},
+	"Main":                  {0x4D, 0x40},
+	"Extended":              {0x58, 0x00},
+	"High":                  {0x64, 0x00},
+	"High 10":               {0x6E, 0x00},
+	"High 4:2:2":            {0x7A, 0x00},
+	"High 4:4:4 Predictive": {0xF4, 0x00},
+}
+
+// levels by the largest picture they allow, ffprobe doesn't report the level of vp9
+var vp9Levels = []struct{ samples, level int }{
+	{36864, 10}, {73728, 11}, {122880, 20}, {245760, 21}, {552960, 30},
+	{983040, 31}, {2228224, 40}, {8912896, 50}, {35651584, 60},
+}
+
+// seq_level_idx of av1 by the largest picture, for streams without one
+var av1Levels = []struct{ samples, level int }{
+	{147456, 0}, {278784, 1}, {665856, 4}, {1065024, 5}, {2359296, 8},
+	{8912896, 12}, {35651584, 16},
+}
+
+func levelFor(levels []struct{ samples, level int }, samples int) int {
+	for _, l := range levels {
+		if samples <= l.samples {
+			return l.level
+		}
+	}
+	return levels[len(levels)-1].level
+}
+
+// CodecString is the RFC 6381 codecs parameter of the stream, as the CODECS
+// attribute of HLS and the codecs attribute of DASH want it. It is empty for
+// codecs it doesn't know.
+func (s ProbeStream) CodecString() string {
+	switch s.CodecName {
+	case "h264":
+		p, ok := avcProfiles[s.Profile]
+		if !ok || s.Level <= 0 {
+			return ""
+		}
+		return fmt.Sprintf("avc1.%02X%02X%02X", p[0], p[1], s.Level)
+	case "hevc":
+		// general profile space 0, main tier, no constraint flags but progressive source
+		switch s.Profile {
+		case "Main":
+			return fmt.Sprintf("hvc1.1.6.L%d.B0", max(s.Level, 0))
+		case "Main 10":
+			return fmt.Sprintf("hvc1.2.4.L%d.B0", max(s.Level, 0))
+		}
+		return ""
+	case "vp9":
+		profile := 0
+		depth := 8
+		switch s.Profile {
+		case "Profile 1":
+			profile = 1
+		case "Profile 2":
+			profile, depth = 2, 10
+		case "Profile 3":
+			profile, depth = 3, 10
+		}
+		return fmt.Sprintf("vp09.%02d.%02d.%02d", profile, levelFor(vp9Levels, s.Width*s.Height), depth)
+	case "av1":
+		level := s.Level
+		if level < 0 {
+			level = levelFor(av1Levels, s.Width*s.Height)
+		}
+		depth := 8
+		if strings.Contains(s.PixFmt, "10") {
+			depth = 10
+		}
+		return fmt.Sprintf("av01.0.%02dM.%02d", level, depth)
+	case "aac":
+		switch s.Profile {
+		case "HE-AAC":
+			return "mp4a.40.5"
+		case "HE-AACv2":
+			return "mp4a.40.29"
+		default:
+			return "mp4a.40.2"
+		}
+	case "mp3":
+		return "mp4a.40.34"
+	case "ac3":
+		return "ac-3"
+	case "eac3":
+		return "ec-3"
+	}
+	return ""
+}
+
+// FrameRate is the average frame rate of a video stream, 0 when unknown
+func (s ProbeStream) FrameRate() float64 {
+	if r := parseRate(s.AvgFrameRate); r > 0 {
+		return r
+	}
+	return parseRate(s.RFrameRate)
+}
+
+func parseRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !ok {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// Stream returns the first stream of type codecType (video, audio)
+func (pr *ProbeResult) Stream(codecType string) (ProbeStream, bool) {
+	for _, s := range pr.Streams {
+		if s.CodecType == codecType {
+			return s, true
+		}
+	}
+	return ProbeStream{}, false
+}
+
+type probePacket struct {
+	Pos   string `json:"pos"`
+	Size  string `json:"size"`
+	Flags string `json:"flags"`
+}
+
+// FirstKeyframe returns where the keyframe a segment starts with ends, so the
+// byte range 0 to end holds everything a player needs to decode it: the
+// PAT/PMT of a TS segment or the moof of an fMP4 fragment, and the frame.
+// ok is false when the segment doesn't start with a keyframe. An fMP4 fragment
+// has no moov of its own, it is probed behind init, its init segment, and end
+// is still counted from the start of the fragment.
+func (f *FFM) FirstKeyframe(ctx context.Context, path, init string) (end int64, ok bool, err error) {
+	input := path
+	var offset int64
+	if init != "" {
+		st, err := os.Stat(init)
+		if err != nil {
+			return 0, false, err
+		}
+		// the concat protocol reads the files as one stream of bytes
+		input = "concat:" + init + "|" + path
+		offset = st.Size()
+	}
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error",
+		"-select_streams", "v:0",
+		"-read_intervals", "%+#2",
+		"-show_entries", "packet=pos,size,flags",
+		"-print_format", "json",
+		input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, false, fmt.Errorf("ffprobe packets failed: %w\nstderr: %s", err, stderr.String())
+	}
+	var res struct {
+		Packets []probePacket `json:"packets"`
+	}
+	if err := json.Unmarshal(out, &res); err != nil {
+		return 0, false, err
+	}
+	if len(res.Packets) == 0 || !strings.Contains(res.Packets[0].Flags, "K") {
+		return 0, false, nil
+	}
+	pos, err := strconv.ParseInt(res.Packets[0].Pos, 10, 64)
+	if err != nil || pos < offset {
+		return 0, false, nil
+	}
+	size, _ := strconv.ParseInt(res.Packets[0].Size, 10, 64)
+	end = pos + size
+	// TS interleaves packet headers and audio into the frame, it ends where the next one starts
+	if len(res.Packets) > 1 {
+		if next, err := strconv.ParseInt(res.Packets[1].Pos, 10, 64); err == nil && next > end {
+			end = next
+		}
+	}
+	return end - offset, true, nil
+}
@@ -1,24 +1,60 @@
 package media
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ak-ansari/mytube/internal/encoding"
+	"github.com/ak-ansari/mytube/internal/util"
 )
 
 type FFM struct{}
 type ProbeFormat struct {
 	Duration string `json:"duration"`
+	BitRate  string `json:"bit_rate"`
+}
+type ProbeSideData struct {
+	Rotation int `json:"rotation"`
 }
 type ProbeStream struct {
-	CodecName string `json:"codec_name"`
-	CodecType string `json:"codec_type"`
-	Width     int    `json:"width"`
-	Height    int    `json:"height"`
+	CodecName    string            `json:"codec_name"`
+	CodecType    string            `json:"codec_type"`
+	Width        int               `json:"width"`
+	Height       int               `json:"height"`
+	BitRate      string            `json:"bit_rate"`
+	Profile      string            `json:"profile"`
+	Level        int               `json:"level"`
+	AvgFrameRate string            `json:"avg_frame_rate"`
+	RFrameRate   string            `json:"r_frame_rate"`
+	Channels     int               `json:"channels"`
+	PixFmt       string            `json:"pix_fmt"`
+	Tags         map[string]string `json:"tags"`
+	SideDataList []ProbeSideData   `json:"side_data_list"`
 }
+
+// DisplaySize is the size the stream is shown at. Phones store portrait video
+// as landscape frames with a rotation, which ffmpeg applies when decoding.
+func (s ProbeStream) DisplaySize() (int, int) {
+	rotation := 0
+	if r, err := strconv.Atoi(s.Tags["rotate"]); err == nil {
+		rotation = r
+	}
+	for _, sd := range s.SideDataList {
+		if sd.Rotation != 0 {
+			rotation = sd.Rotation
+		}
+	}
+	if rotation%180 != 0 {
+		return s.Height, s.Width
+	}
+	return s.Width, s.Height
+}
+
 type ProbeResult struct {
 	Format  ProbeFormat   `json:"format"`
 	Streams []ProbeStream `json:"streams"`
@@ -39,36 +75,73 @@ func (f *FFM) Probe(ctx context.Context, path string) (*ProbeResult, error) {
 	}
 	return &pr, nil
 }
-func (f *FFM) TranscodeH264(ctx context.Context, inPath, outPath string, w, h int) error {
 
-	scaleFilter := fmt.Sprintf("scale=-2:%d", h)
+// Transcode encodes one rendition q of inPath with the settings profile p has
+// for the codec of q
+func (f *FFM) Transcode(ctx context.Context, inPath, outPath string, q util.Quality, p encoding.Profile, progress ProgressFunc) error {
+	codec, ok := p.VideoCodec(q.Codec)
+	if !ok {
+		return fmt.Errorf("profile %s has no codec %s", p.Name, q.Codec)
+	}
 
-	args := []string{
-		"-y", "-i", inPath,
-		"-c:v", "libx264",
-		"-preset", "veryfast",
-		"-crf", "22",
+	// both sides come from the ladder, which already keeps the aspect ratio
+	scaleFilter := fmt.Sprintf("scale=%d:%d", q.Width, q.Height)
+	if q.Width <= 0 {
+		scaleFilter = fmt.Sprintf("scale=-2:%d", q.Height)
+	}
+
+	args := []string{"-y", "-i", inPath}
+	args = append(args, videoCodecArgs(codec, p.RateControl, q)...)
+	if q.MaxBitrate > 0 {
+		bufSize := q.BufSize
+		if bufSize <= 0 {
+			bufSize = 2 * q.MaxBitrate
+		}
+		args = append(args, "-maxrate", strconv.Itoa(q.MaxBitrate), "-bufsize", strconv.Itoa(bufSize))
+	}
+	if p.GOPSeconds > 0 {
+		// keyframes on a fixed clock so segments of every rendition line up
+		args = append(args,
+			"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", p.GOPSeconds),
+			"-sc_threshold", "0")
+	}
+	args = append(args,
 		"-vf", scaleFilter,
-		"-c:a", "aac", "-b:a", "128k", "-ac", "2",
+		"-c:a", p.Audio.Codec, "-b:a", p.Audio.Bitrate, "-ac", strconv.Itoa(p.Audio.Channels),
 		"-movflags", "+faststart",
 		outPath,
-	}
-	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	)
+	return f.run(ctx, "transcode", args, progress)
+}
 
-	if err := cmd.Run(); err != nil {
-		errMsg := stderr.String()
-		if len(errMsg) > 500 {
-			errMsg = errMsg[:500] + "..."
+// videoCodecArgs selects the encoder of c and its speed and rate control,
+// which every encoder spells its own way
+func videoCodecArgs(c encoding.VideoCodec, rateControl string, q util.Quality) []string {
+	args := []string{"-c:v", c.Encoder}
+	switch c.Encoder {
+	case "libvpx-vp9", "libaom-av1":
+		args = append(args, "-cpu-used", c.Preset, "-row-mt", "1")
+		if c.Encoder == "libvpx-vp9" {
+			args = append(args, "-deadline", "good")
+		}
+		if rateControl == encoding.RateVBR {
+			return append(args, "-b:v", strconv.Itoa(q.Bandwidth))
 		}
-		return fmt.Errorf("ffmpeg transcode failed: %w\nstderr: %s", err, errMsg)
+		// constant quality needs the bitrate unset, a max rate still caps it
+		return append(args, "-crf", strconv.Itoa(c.CRF), "-b:v", "0")
+	case "libx265":
+		// hvc1 is the sample entry Apple players want
+		args = append(args, "-preset", c.Preset, "-tag:v", "hvc1")
+	default:
+		args = append(args, "-preset", c.Preset)
 	}
-	return nil
+	if rateControl == encoding.RateVBR {
+		return append(args, "-b:v", strconv.Itoa(q.Bandwidth))
+	}
+	return append(args, "-crf", strconv.Itoa(c.CRF))
 }
 
-func (f *FFM) SegmentHLS(ctx context.Context, inPath, outDir, baseName string, segmentDuration int) error {
+func (f *FFM) SegmentHLS(ctx context.Context, inPath, outDir, baseName string, segmentDuration int, progress ProgressFunc) error {
 	if segmentDuration <= 0 {
 		segmentDuration = 4
 	}
@@ -85,20 +158,81 @@ func (f *FFM) SegmentHLS(ctx context.Context, inPath, outDir, baseName string, s
 		indexFilePath,
 	}
 
-	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	return f.run(ctx, "segment", args, progress)
+}
+
+// names of the files PackageCMAF writes next to the segments
+const (
+	CMAFManifest = "manifest.mpd"
+	CMAFMaster   = "master.m3u8"
+)
 
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+// PackageInput is a transcoded rendition to package
+type PackageInput struct {
+	Path  string
+	Codec string
+}
 
-	if err := cmd.Run(); err != nil {
-		errMsg := stderr.String()
-		if len(errMsg) > 500 {
-			errMsg = errMsg[:500] + "..."
+// PackageDash packages the renditions in inputs into one MPD at
+// outDir/manifestName, each rendition a representation of the video adaptation
+// set of its codec with the bandwidth, size and codecs ffmpeg reads from it. The audio of the
+// first input becomes the audio adaptation set, the renditions all carry the same one.
+func (f *FFM) PackageDash(ctx context.Context, inputs []PackageInput, outDir, manifestName string, segmentDuration int, progress ProgressFunc) error {
+	return f.packageFMP4(ctx, inputs, filepath.Join(outDir, manifestName), segmentDuration, false, progress)
+}
+
+// PackageCMAF packages the renditions in inputs once as fMP4, an init segment
+// and .m4s fragments each, and writes both a DASH manifest (CMAFManifest) and
+// HLS playlists (CMAFMaster plus media_<n>.m3u8 per stream) that point at them
+func (f *FFM) PackageCMAF(ctx context.Context, inputs []PackageInput, outDir string, segmentDuration int, progress ProgressFunc) error {
+	return f.packageFMP4(ctx, inputs, filepath.Join(outDir, CMAFManifest), segmentDuration, true, progress)
+}
+
+func (f *FFM) packageFMP4(ctx context.Context, inputs []PackageInput, mpdPath string, segmentDuration int, hls bool, progress ProgressFunc) error {
+	if len(inputs) == 0 {
+		return fmt.Errorf("ffmpeg dash: no renditions to package")
+	}
+	if segmentDuration <= 0 {
+		segmentDuration = 4
+	}
+	args := []string{"-y"}
+	// one adaptation set per codec, players switch between representations of the same one only
+	var codecs []string
+	streams := map[string][]string{}
+	for i, in := range inputs {
+		args = append(args, "-i", in.Path)
+		if _, ok := streams[in.Codec]; !ok {
+			codecs = append(codecs, in.Codec)
 		}
-		return fmt.Errorf("ffmpeg segment failed: %w\nstderr: %s", err, errMsg)
+		streams[in.Codec] = append(streams[in.Codec], strconv.Itoa(i))
 	}
-	return nil
+	var sets []string
+	for i, codec := range codecs {
+		sets = append(sets, fmt.Sprintf("id=%d,streams=%s", i, strings.Join(streams[codec], ",")))
+	}
+	sets = append(sets, fmt.Sprintf("id=%d,streams=a", len(codecs)))
+	for i := range inputs {
+		args = append(args, "-map", fmt.Sprintf("%d:v:0", i))
+	}
+	args = append(args, "-map", "0:a:0?", "-c", "copy")
+	args = append(args,
+		"-f", "dash",
+		"-dash_segment_type", "mp4",
+		"-seg_duration", strconv.Itoa(segmentDuration),
+		"-use_template", "1",
+		"-use_timeline", "1",
+		"-adaptation_sets", strings.Join(sets, " "),
+		"-init_seg_name", "init_$RepresentationID$.m4s",
+		"-media_seg_name", "chunk_$RepresentationID$_$Number%05d$.m4s",
+	)
+	if hls {
+		args = append(args, "-hls_playlist", "1", "-hls_master_name", CMAFMaster)
+	}
+	args = append(args, mpdPath)
+
+	return f.run(ctx, "dash", args, progress)
 }
+
 func (f *FFM) CreateThumbnail(ctx context.Context, inputURL string, outputPath string, timestamp int) error {
 	// Build ffmpeg command:
 	// -ss <timestamp> : seek to timestamp (e.g. 3 seconds)
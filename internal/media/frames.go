@@ -0,0 +1,82 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// Frame is a decoded frame of a video and when it is shown
+type Frame struct {
+	At float64
+	// Pixels are 8 bit grayscale, row by row
+	Pixels []byte
+}
+
+// showinfo logs a line per frame that went through the filters
+var showinfoTime = regexp.MustCompile(`Parsed_showinfo.*\bpts_time:\s*(-?[0-9.]+)`)
+
+// Keyframes decodes up to maxFrames keyframes of inPath at least interval seconds
+// apart, scaled to size×size grayscale. Only keyframes are decoded, which keeps
+// it fast on long videos.
+func (f *FFM) Keyframes(ctx context.Context, inPath string, size int, interval float64, maxFrames int) ([]Frame, error) {
+	filter := fmt.Sprintf("select='isnan(prev_selected_t)+gte(t-prev_selected_t\\,%g)',scale=%d:%d:flags=area,format=gray,showinfo", interval, size, size)
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-nostdin",
+		"-skip_frame", "nokey",
+		"-i", inPath,
+		"-an", "-sn",
+		"-vf", filter,
+		"-vsync", "vfr",
+		"-frames:v", strconv.Itoa(maxFrames),
+		"-f", "rawvideo",
+		"-pix_fmt", "gray",
+		"pipe:1",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var pixels [][]byte
+	for {
+		frame := make([]byte, size*size)
+		if _, err = io.ReadFull(stdout, frame); err != nil {
+			break
+		}
+		pixels = append(pixels, frame)
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	// Wait closes stdout, it has to be read to the end first
+	if werr := cmd.Wait(); werr != nil || err != nil {
+		if werr != nil {
+			err = werr
+		}
+		errMsg := stderr.String()
+		if len(errMsg) > 500 {
+			errMsg = "..." + errMsg[len(errMsg)-500:]
+		}
+		return nil, fmt.Errorf("ffmpeg keyframes failed: %w\nstderr: %s", err, errMsg)
+	}
+
+	times := showinfoTime.FindAllSubmatch(stderr.Bytes(), -1)
+	frames := make([]Frame, len(pixels))
+	for i, p := range pixels {
+		frames[i].Pixels = p
+		if i < len(times) {
+			frames[i].At, _ = strconv.ParseFloat(string(times[i][1]), 64)
+		}
+	}
+	return frames, nil
+}
@@ -0,0 +1,112 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Progress is a progress report of a running ffmpeg
+type Progress struct {
+	// OutTime is how much of the output is written
+	OutTime time.Duration
+	// Speed is the multiple of realtime ffmpeg runs at
+	Speed float64
+	FPS   float64
+	// Done is set on the last report
+	Done bool
+}
+
+// ProgressFunc receives the reports of a running ffmpeg, about every half second
+type ProgressFunc func(Progress)
+
+// Percent is how much of an output of the given total duration is done
+func (p Progress) Percent(total time.Duration) float64 {
+	if p.Done {
+		return 100
+	}
+	if total <= 0 {
+		return 0
+	}
+	return min(100, 100*float64(p.OutTime)/float64(total))
+}
+
+// run runs ffmpeg with args. When progress is set ffmpeg writes its -progress
+// reports to stdout and they are passed on as they come.
+func (f *FFM) run(ctx context.Context, what string, args []string, progress ProgressFunc) error {
+	if progress != nil {
+		args = append([]string{"-progress", "pipe:1", "-nostats"}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	var parsed chan struct{}
+	if progress != nil {
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		parsed = make(chan struct{})
+		go func() {
+			defer close(parsed)
+			parseProgress(stdout, progress)
+		}()
+	}
+
+	err := cmd.Start()
+	if err == nil {
+		if parsed != nil {
+			// Wait closes stdout, read it to the end first
+			<-parsed
+		}
+		err = cmd.Wait()
+	}
+	if err != nil {
+		errMsg := stderr.String()
+		if len(errMsg) > 500 {
+			errMsg = errMsg[:500] + "..."
+		}
+		return fmt.Errorf("ffmpeg %s failed: %w\nstderr: %s", what, err, errMsg)
+	}
+	return nil
+}
+
+// parseProgress reads the key=value blocks of -progress, each ends with a
+// progress=continue or progress=end line
+func parseProgress(r io.Reader, fn ProgressFunc) {
+	var p Progress
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(sc.Text()), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "out_time_us":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+				p.OutTime = time.Duration(us) * time.Microsecond
+			}
+		case "speed":
+			if s, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+				p.Speed = s
+			}
+		case "fps":
+			if fps, err := strconv.ParseFloat(value, 64); err == nil {
+				p.FPS = fps
+			}
+		case "progress":
+			p.Done = value == "end"
+			fn(p)
+		}
+	}
+	// drain whatever is left so ffmpeg never blocks on a full pipe
+	_, _ = io.Copy(io.Discard, r)
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// Fingerprint is the perceptual hashes of a keyframe of a video
+type Fingerprint struct {
+	VideoID  uuid.UUID `json:"video_id"`
+	Position int       `json:"position"`
+	// At is when the frame is shown, in seconds
+	At    float64 `json:"at_seconds"`
+	PHash uint64  `json:"phash"`
+	DHash uint64  `json:"dhash"`
+	// Bands index PHash for the frames near it, see phash.Bands
+	Bands []int32 `json:"-"`
+}
+
+// SimilarVideo is a video that shares frames with another one
+type SimilarVideo struct {
+	VideoID  uuid.UUID   `json:"video_id"`
+	Filename string      `json:"filename"`
+	Status   VideoStatus `json:"status"`
+	// Score is the larger of the shares of either video's frames found in the
+	// other, 1 for a copy and for a part cut out of a video
+	Score float64 `json:"score"`
+	// MatchedFrames are the frames of the video asked about found in this one
+	MatchedFrames int `json:"matched_frames"`
+	// Frames is how many frames of this video were fingerprinted
+	Frames int `json:"frames"`
+	// Distance is the average pHash distance of the matching frames, 0 to 64
+	Distance float64 `json:"distance"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type OutboxKind string
+
+const (
+	// OutboxJob is a job payload for the queue named by Topic
+	OutboxJob OutboxKind = "job"
+	// OutboxEvent is an events.Event of the video named by Topic
+	OutboxEvent OutboxKind = "event"
+)
+
+// OutboxMessage is a message waiting for the transaction that wrote it to be
+// relayed to the queue or the event bus
+type OutboxMessage struct {
+	ID          int64           `json:"id"`
+	Kind        OutboxKind      `json:"kind"`
+	Topic       string          `json:"topic"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	LastError   *string         `json:"last_error,omitempty"`
+	AvailableAt time.Time       `json:"available_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// SearchHit is a video matching a search, best matches rank highest
+type SearchHit struct {
+	Video
+	Rank float64 `json:"rank"`
+	// Highlights are the title and the parts of the description that matched,
+	// HTML escaped with the matching words in <mark>
+	Highlights SearchHighlights `json:"highlights"`
+}
+
+type SearchHighlights struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/ak-ansari/mytube/internal/encoding"
 	"github.com/google/uuid"
 )
 
@@ -16,20 +17,45 @@ const (
 	StatusFailed     VideoStatus = "failed"
 )
 
+// Rendition is a transcoded quality of a video and the codec it is encoded with
+type Rendition struct {
+	Quality string `json:"quality"`
+	Codec   string `json:"codec"`
+}
+
+// VideoMetadata is what uploaders tell about a video, it is what search looks at
+type VideoMetadata struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
 type Video struct {
-	ID                 uuid.UUID   `json:"id"`
-	Filename           string      `json:"filename"`
-	OriginalObjectKey  string      `json:"original_object_key"`
-	SHA256             *string     `json:"sha256,omitempty"`
-	DurationSeconds    *int        `json:"duration_seconds,omitempty"`
-	CodecVideo         *string     `json:"codec_video,omitempty"`
-	CodecAudio         *string     `json:"codec_audio,omitempty"`
-	Width              *int        `json:"width,omitempty"`
-	Height             *int        `json:"height,omitempty"`
-	Status             VideoStatus `json:"status"`
-	AvailableQualities []string    `json:"available_qualities,omitempty"`
-	ManifestPath       *string     `json:"manifest_path,omitempty"`
-	Thumbnail          *string     `json:"thumbnail,omitempty"`
-	CreatedAt          time.Time   `json:"created_at"`
-	UpdatedAt          time.Time   `json:"updated_at"`
+	ID                uuid.UUID `json:"id"`
+	Filename          string    `json:"filename"`
+	OriginalObjectKey string    `json:"original_object_key"`
+	SHA256            *string   `json:"sha256,omitempty"`
+	SizeBytes         *int64    `json:"size_bytes,omitempty"`
+	DurationSeconds   *int      `json:"duration_seconds,omitempty"`
+	CodecVideo        *string   `json:"codec_video,omitempty"`
+	CodecAudio        *string   `json:"codec_audio,omitempty"`
+	Width             *int      `json:"width,omitempty"`
+	Height            *int      `json:"height,omitempty"`
+	BitrateBps        *int64    `json:"bitrate_bps,omitempty"`
+	// EncodingProfile is nil for videos uploaded before profiles existed
+	EncodingProfile    *encoding.Profile `json:"encoding_profile,omitempty"`
+	Status             VideoStatus       `json:"status"`
+	AvailableQualities []string          `json:"available_qualities,omitempty"`
+	Renditions         []Rendition       `json:"renditions,omitempty"`
+	ManifestPath       *string           `json:"manifest_path,omitempty"`
+	DashManifestPath   *string           `json:"dash_manifest_path,omitempty"`
+	Thumbnail          *string           `json:"thumbnail,omitempty"`
+	// SourceID is the video whose stored objects this duplicate upload uses
+	SourceID *uuid.UUID `json:"source_id,omitempty"`
+	// RefCount is how many videos use the objects this one owns, itself
+	// included, duplicates own nothing and have none
+	RefCount int `json:"ref_count,omitempty"`
+	VideoMetadata
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
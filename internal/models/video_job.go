@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobRetrying  JobStatus = "retrying"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// VideoJob is the state of one pipeline step of a video
+type VideoJob struct {
+	ID          int64     `json:"id"`
+	VideoID     uuid.UUID `json:"video_id"`
+	Step        string    `json:"step"`
+	Variant     string    `json:"variant,omitempty"`
+	Status      JobStatus `json:"status"`
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"max_attempts"`
+	LastError   *string   `json:"last_error,omitempty"`
+	// Progress is the percentage done of the running attempt, Speed and FPS
+	// are how fast ffmpeg goes
+	Progress    *float64   `json:"progress,omitempty"`
+	Speed       *float64   `json:"speed,omitempty"`
+	FPS         *float64   `json:"fps,omitempty"`
+	AvailableAt time.Time  `json:"available_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	DurationMs  *int64     `json:"duration_ms,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
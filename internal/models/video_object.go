@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ObjectKind string
+
+const (
+	ObjectRendition ObjectKind = "rendition"
+	ObjectSegment   ObjectKind = "segment"
+	ObjectPlaylist  ObjectKind = "playlist"
+	ObjectManifest  ObjectKind = "manifest"
+	ObjectThumbnail ObjectKind = "thumbnail"
+)
+
+// VideoObject is a file the pipeline stored for a video, with the size and
+// checksums of the local file it was uploaded from
+type VideoObject struct {
+	VideoID   uuid.UUID  `json:"video_id"`
+	Key       string     `json:"key"`
+	Kind      ObjectKind `json:"kind"`
+	SizeBytes int64      `json:"size_bytes"`
+	SHA256    string     `json:"sha256"`
+	MD5       string     `json:"md5"`
+	// ETag is what the store reported right after the upload
+	ETag       string     `json:"etag"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	// Problem is what the last verification found wrong
+	Problem   *string   `json:"problem,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
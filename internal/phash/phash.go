@@ -0,0 +1,120 @@
+// Package phash computes perceptual hashes of video frames: 64 bit hashes that
+// stay close, by Hamming distance, when a frame is re-encoded, scaled or
+// slightly recoloured. Frames come in as Size×Size 8 bit grayscale pixels.
+package phash
+
+import (
+	"math"
+	"sort"
+)
+
+// Size is the width and height of the frames the hashes are computed from
+const Size = 32
+
+// minStdDev is the contrast below which a frame is flat: black, white or a
+// single colour, which would match any other flat frame
+const minStdDev = 4
+
+// dct holds cos((2x+1)uπ/2N) for the low frequencies u the pHash keeps
+var dct = func() [8][Size]float64 {
+	var t [8][Size]float64
+	for u := range t {
+		for x := range t[u] {
+			t[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * Size))
+		}
+	}
+	return t
+}()
+
+// PHash is the DCT hash of frame: each bit tells whether one of the 8×8 lowest
+// frequencies of the frame is above their median. The DC term is left out of
+// the median, it is the brightness of the frame and dwarfs the others; its
+// bit, bit 0, is always unset.
+func PHash(frame []byte) uint64 {
+	// rows first, only the 8 lowest frequencies are needed
+	var rows [Size][8]float64
+	for y := 0; y < Size; y++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for x := 0; x < Size; x++ {
+				s += float64(frame[y*Size+x]) * dct[u][x]
+			}
+			rows[y][u] = s
+		}
+	}
+	var coeffs [64]float64
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for y := 0; y < Size; y++ {
+				s += rows[y][u] * dct[v][y]
+			}
+			coeffs[v*8+u] = s
+		}
+	}
+
+	ac := coeffs
+	sort.Float64s(ac[1:])
+	median := ac[32]
+	var h uint64
+	for i := 1; i < 64; i++ {
+		if coeffs[i] > median {
+			h |= 1 << i
+		}
+	}
+	return h
+}
+
+// Bands splits h into n runs of neighbouring bits, each tagged with its index
+// in the upper bits. Hashes less than n bits apart differ in at most n-1 runs
+// and so have a band in common, which makes bands an index for near hashes.
+// n is 8 to 64, runs are at most 8 bits long.
+func Bands(h uint64, n int) []int32 {
+	bands := make([]int32, n)
+	for i := range bands {
+		lo, hi := i*64/n, (i+1)*64/n
+		bands[i] = int32(i<<8) | int32(h>>lo&(1<<(hi-lo)-1))
+	}
+	return bands
+}
+
+// DHash is the difference hash of frame: the frame shrunk to 9×8 and each bit
+// telling whether a pixel is brighter than its right neighbour
+func DHash(frame []byte) uint64 {
+	var small [8][9]float64
+	for j := 0; j < 8; j++ {
+		y0, y1 := j*Size/8, (j+1)*Size/8
+		for i := 0; i < 9; i++ {
+			x0, x1 := i*Size/9, (i+1)*Size/9
+			var s float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					s += float64(frame[y*Size+x])
+				}
+			}
+			small[j][i] = s / float64((y1-y0)*(x1-x0))
+		}
+	}
+	var h uint64
+	for j := 0; j < 8; j++ {
+		for i := 0; i < 8; i++ {
+			if small[j][i] > small[j][i+1] {
+				h |= 1 << (j*8 + i)
+			}
+		}
+	}
+	return h
+}
+
+// Flat tells whether frame has too little contrast to be told apart from other
+// frames, its hashes would match those of every fade to black
+func Flat(frame []byte) bool {
+	var sum, sq float64
+	for _, p := range frame {
+		sum += float64(p)
+		sq += float64(p) * float64(p)
+	}
+	n := float64(len(frame))
+	mean := sum / n
+	return math.Sqrt(math.Max(sq/n-mean*mean, 0)) < minStdDev
+}
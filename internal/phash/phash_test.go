@@ -0,0 +1,246 @@
+package phash
+
+import (
+	"math"
+	"math/bits"
+	"math/rand"
+	"testing"
+)
+
+// picture is a frame drawn from a function of the position, scaled to 0..1
+type picture func(x, y float64) float64
+
+// scene is a picture made of a lit background and a few soft blobs of light
+// and shade placed by seed, closer to a video frame than plain shapes whose
+// spectrum is mostly zeros
+func scene(seed int64) picture {
+	r := rand.New(rand.NewSource(seed))
+	type blob struct{ x, y, radius, light float64 }
+	blobs := make([]blob, 8)
+	for i := range blobs {
+		blobs[i] = blob{r.Float64(), r.Float64(), 0.05 + 0.2*r.Float64(), r.Float64() - 0.5}
+	}
+	angle := r.Float64() * 2 * math.Pi
+	return func(x, y float64) float64 {
+		v := 0.5 + 0.2*((x-0.5)*math.Cos(angle)+(y-0.5)*math.Sin(angle))
+		for _, b := range blobs {
+			d := math.Hypot(x-b.x, y-b.y) / b.radius
+			v += b.light * math.Exp(-d*d)
+		}
+		return v
+	}
+}
+
+// render draws p at Size×Size, supersampling every pixel as a scaler would
+func render(p picture, tone func(float64) float64) []byte {
+	const sub = 4
+	frame := make([]byte, Size*Size)
+	for y := 0; y < Size; y++ {
+		for x := 0; x < Size; x++ {
+			var s float64
+			for j := 0; j < sub; j++ {
+				for i := 0; i < sub; i++ {
+					s += p((float64(x)+(float64(i)+0.5)/sub)/Size, (float64(y)+(float64(j)+0.5)/sub)/Size)
+				}
+			}
+			frame[y*Size+x] = level(tone(s / sub / sub))
+		}
+	}
+	return frame
+}
+
+// level is the 8 bit pixel of v, clipped as a camera would
+func level(v float64) byte {
+	return byte(math.Round(255 * math.Min(math.Max(v, 0), 1)))
+}
+
+func identity(v float64) float64 { return v }
+
+// the same picture after the kinds of damage a re-encode does
+var copies = map[string]func(picture) []byte{
+	"brighter": func(p picture) []byte {
+		return render(p, func(v float64) float64 { return v + 0.08 })
+	},
+	"more contrast": func(p picture) []byte {
+		return render(p, func(v float64) float64 { return 0.5 + (v-0.5)*1.2 })
+	},
+	"gamma": func(p picture) []byte {
+		return render(p, func(v float64) float64 { return math.Pow(v, 0.8) })
+	},
+	"noisy": func(p picture) []byte {
+		frame := render(p, identity)
+		r := rand.New(rand.NewSource(1))
+		for i, v := range frame {
+			frame[i] = byte(math.Min(math.Max(float64(v)+r.NormFloat64()*6, 0), 255))
+		}
+		return frame
+	},
+	"aliased": func(p picture) []byte {
+		// point sampled rather than averaged, as a cheap scaler would
+		frame := make([]byte, Size*Size)
+		for y := 0; y < Size; y++ {
+			for x := 0; x < Size; x++ {
+				frame[y*Size+x] = level(p((float64(x)+0.5)/Size, (float64(y)+0.5)/Size))
+			}
+		}
+		return frame
+	},
+}
+
+var pictures = map[string]picture{"street": scene(1), "beach": scene(2), "kitchen": scene(3), "stadium": scene(4)}
+
+func distance(a, b uint64) int { return bits.OnesCount64(a ^ b) }
+
+func TestHashesOfCopiesAreClose(t *testing.T) {
+	for name, p := range pictures {
+		original := render(p, identity)
+		for damage, copy := range copies {
+			frame := copy(p)
+			if d := distance(PHash(original), PHash(frame)); d > 10 {
+				t.Errorf("%s %s: pHash %d bits away, want at most 10", damage, name, d)
+			}
+			if d := distance(DHash(original), DHash(frame)); d > 10 {
+				t.Errorf("%s %s: dHash %d bits away, want at most 10", damage, name, d)
+			}
+		}
+	}
+}
+
+func TestHashesOfDifferentPicturesAreFar(t *testing.T) {
+	for a, pa := range pictures {
+		for b, pb := range pictures {
+			if a >= b {
+				continue
+			}
+			fa, fb := render(pa, identity), render(pb, identity)
+			if d := distance(PHash(fa), PHash(fb)); d <= 20 {
+				t.Errorf("%s and %s: pHash %d bits away, want more than 20", a, b, d)
+			}
+			if d := distance(DHash(fa), DHash(fb)); d <= 10 {
+				t.Errorf("%s and %s: dHash %d bits away, want more than 10", a, b, d)
+			}
+		}
+	}
+}
+
+func TestPHashIgnoresBrightness(t *testing.T) {
+	// the DC term would flip no bit, but must not move the median either: a
+	// uniformly brighter frame hashes the same
+	frame := render(scene(1), func(v float64) float64 { return 0.2 + 0.6*v })
+	brighter := make([]byte, len(frame))
+	for i, v := range frame {
+		brighter[i] = v + 40
+	}
+	if a, b := PHash(frame), PHash(brighter); a != b {
+		t.Errorf("brighter frame hashes %016x, want %016x", b, a)
+	}
+	if PHash(frame)&1 != 0 {
+		t.Error("bit 0, the DC term, is set")
+	}
+}
+
+func TestPHashHalfTheBitsSet(t *testing.T) {
+	// the median splits the 63 AC terms, 31 above it
+	for name, p := range pictures {
+		if n := bits.OnesCount64(PHash(render(p, identity))); n != 31 {
+			t.Errorf("%s: %d bits set, want 31", name, n)
+		}
+	}
+}
+
+func TestDHash(t *testing.T) {
+	// brightness falling left to right sets every bit, rising sets none
+	falling := render(func(x, y float64) float64 { return 0.9 - 0.8*x }, identity)
+	if h := DHash(falling); h != math.MaxUint64 {
+		t.Errorf("falling gradient = %016x, want every bit set", h)
+	}
+	rising := render(func(x, y float64) float64 { return 0.1 + 0.8*x }, identity)
+	if h := DHash(rising); h != 0 {
+		t.Errorf("rising gradient = %016x, want no bit set", h)
+	}
+}
+
+func TestFlat(t *testing.T) {
+	uniform := func(v byte) []byte {
+		frame := make([]byte, Size*Size)
+		for i := range frame {
+			frame[i] = v
+		}
+		return frame
+	}
+	grain := uniform(16)
+	r := rand.New(rand.NewSource(1))
+	for i := range grain {
+		grain[i] += byte(r.Intn(4))
+	}
+	tests := []struct {
+		name  string
+		frame []byte
+		flat  bool
+	}{
+		{"black", uniform(0), true},
+		{"white", uniform(255), true},
+		{"grey", uniform(128), true},
+		{"black with grain", grain, true},
+		{"scene", render(scene(1), identity), false},
+	}
+	for _, tt := range tests {
+		if got := Flat(tt.frame); got != tt.flat {
+			t.Errorf("Flat(%s) = %v, want %v", tt.name, got, tt.flat)
+		}
+	}
+}
+
+func TestBands(t *testing.T) {
+	for _, n := range []int{8, 11, 16, 64} {
+		h := uint64(0x9e3779b97f4a7c15)
+		bands := Bands(h, n)
+		if len(bands) != n {
+			t.Fatalf("Bands(_, %d) has %d bands", n, len(bands))
+		}
+		// the runs put back together are the hash
+		var back uint64
+		for i, b := range bands {
+			if int(b>>8) != i {
+				t.Errorf("band %d of %d tagged %d", i, n, b>>8)
+			}
+			back |= uint64(b&0xff) << (i * 64 / n)
+		}
+		if back != h {
+			t.Errorf("Bands(_, %d) put back together = %016x, want %016x", n, back, h)
+		}
+	}
+}
+
+func TestBandsFindEveryNearHash(t *testing.T) {
+	// hashes n-1 bits apart share a band however the bits are spread, n apart
+	// they need not
+	const n = 11
+	r := rand.New(rand.NewSource(1))
+	shares := func(a, b []int32) bool {
+		for i := range a {
+			if a[i] == b[i] {
+				return true
+			}
+		}
+		return false
+	}
+	for i := 0; i < 10000; i++ {
+		h := r.Uint64()
+		var flip uint64
+		for bits.OnesCount64(flip) < n-1 {
+			flip |= 1 << r.Intn(64)
+		}
+		if !shares(Bands(h, n), Bands(h^flip, n)) {
+			t.Fatalf("%016x and %016x are %d bits apart and share no band", h, h^flip, n-1)
+		}
+	}
+	// one bit in each band
+	var spread uint64
+	for i := 0; i < n; i++ {
+		spread |= 1 << (i * 64 / n)
+	}
+	if shares(Bands(0, n), Bands(spread, n)) {
+		t.Errorf("hashes differing in every band share one")
+	}
+}
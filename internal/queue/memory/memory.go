@@ -0,0 +1,223 @@
+package memoryQueue
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/queue"
+)
+
+const dequeueTimeout = 5 * time.Second
+
+type entry struct {
+	id       string
+	body     []byte
+	attempts int
+	deadline time.Time
+}
+
+// topic is one named queue: a FIFO of ready entries, the leased ones and a
+// channel that wakes up blocked consumers
+type topic struct {
+	ready    []*entry
+	inflight map[string]*entry
+	dead     map[string]queue.DeadLetter
+	signal   chan struct{}
+}
+
+// memoryQueue is an in-process queue with the same lease, retry and dead letter
+// semantics as the redis and postgres ones. Everything is lost when the process
+// exits, so it is meant for tests and the single binary mode.
+type memoryQueue struct {
+	mu         sync.Mutex
+	topics     map[string]*topic
+	visibility time.Duration
+	seq        int64
+}
+
+func NewMemoryQ(visibility time.Duration) *memoryQueue {
+	if visibility <= 0 {
+		visibility = queue.DefaultVisibilityTimeout
+	}
+	return &memoryQueue{topics: map[string]*topic{}, visibility: visibility}
+}
+
+func (m *memoryQueue) Enqueue(ctx context.Context, queueName string, payload []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.push(queueName, &entry{id: m.nextID(), body: append([]byte(nil), payload...)})
+	return nil
+}
+
+func (m *memoryQueue) Dequeue(ctx context.Context, queueName string) (*queue.Message, error) {
+	timeout := time.NewTimer(dequeueTimeout)
+	defer timeout.Stop()
+
+	for {
+		m.mu.Lock()
+		t := m.topic(queueName)
+		m.reclaim(t)
+		if len(t.ready) > 0 {
+			e := t.ready[0]
+			t.ready = t.ready[1:]
+			e.attempts++
+			e.deadline = time.Now().Add(m.visibility)
+			t.inflight[e.id] = e
+			m.mu.Unlock()
+			return &queue.Message{ID: e.id, Body: e.body, Attempts: e.attempts}, nil
+		}
+		signal := t.signal
+		m.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout.C:
+			return nil, nil
+		case <-signal:
+		}
+	}
+}
+
+func (m *memoryQueue) Ack(ctx context.Context, queueName string, msg *queue.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.topic(queueName).inflight, msg.ID)
+	return nil
+}
+
+// Nack hands the message back, after delay if there is one
+func (m *memoryQueue) Nack(ctx context.Context, queueName string, msg *queue.Message, delay time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.topic(queueName)
+	e, ok := t.inflight[msg.ID]
+	if !ok {
+		return queue.ErrNotFound
+	}
+	delete(t.inflight, msg.ID)
+	e.attempts = msg.Attempts
+
+	if delay <= 0 {
+		m.push(queueName, e)
+		return nil
+	}
+	time.AfterFunc(delay, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.push(queueName, e)
+	})
+	return nil
+}
+
+func (m *memoryQueue) Extend(ctx context.Context, queueName string, msg *queue.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.topic(queueName).inflight[msg.ID]
+	if !ok {
+		return queue.ErrNotFound
+	}
+	e.deadline = time.Now().Add(m.visibility)
+	return nil
+}
+
+func (m *memoryQueue) Bury(ctx context.Context, queueName string, msg *queue.Message, lastErr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.topic(queueName).dead[msg.ID] = queue.DeadLetter{
+		ID:        msg.ID,
+		Body:      string(msg.Body),
+		Attempts:  msg.Attempts,
+		LastError: lastErr,
+		FailedAt:  time.Now().UTC(),
+	}
+	return nil
+}
+
+func (m *memoryQueue) List(ctx context.Context, queueName string, offset, limit int) ([]queue.DeadLetter, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	all := make([]queue.DeadLetter, 0, len(m.topic(queueName).dead))
+	for _, dl := range m.topic(queueName).dead {
+		all = append(all, dl)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].FailedAt.After(all[j].FailedAt) })
+
+	if offset > len(all) {
+		offset = len(all)
+	}
+	end := min(offset+limit, len(all))
+	return all[offset:end], len(all), nil
+}
+
+func (m *memoryQueue) Get(ctx context.Context, queueName string, id string) (*queue.DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dl, ok := m.topic(queueName).dead[id]
+	if !ok {
+		return nil, queue.ErrNotFound
+	}
+	return &dl, nil
+}
+
+func (m *memoryQueue) Requeue(ctx context.Context, queueName string, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.topic(queueName)
+	dl, ok := t.dead[id]
+	if !ok {
+		return queue.ErrNotFound
+	}
+	delete(t.dead, id)
+	m.push(queueName, &entry{id: m.nextID(), body: []byte(dl.Body)})
+	return nil
+}
+
+func (m *memoryQueue) Delete(ctx context.Context, queueName string, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.topic(queueName).dead, id)
+	return nil
+}
+
+// push appends e to the ready list and wakes a consumer, callers hold m.mu
+func (m *memoryQueue) push(queueName string, e *entry) {
+	t := m.topic(queueName)
+	t.ready = append(t.ready, e)
+	select {
+	case t.signal <- struct{}{}:
+	default:
+	}
+}
+
+// reclaim makes leases that ran out ready again, callers hold m.mu
+func (m *memoryQueue) reclaim(t *topic) {
+	now := time.Now()
+	for id, e := range t.inflight {
+		if now.After(e.deadline) {
+			delete(t.inflight, id)
+			t.ready = append(t.ready, e)
+		}
+	}
+}
+
+func (m *memoryQueue) topic(queueName string) *topic {
+	t, ok := m.topics[queueName]
+	if !ok {
+		t = &topic{
+			inflight: map[string]*entry{},
+			dead:     map[string]queue.DeadLetter{},
+			signal:   make(chan struct{}, 1),
+		}
+		m.topics[queueName] = t
+	}
+	return t
+}
+
+func (m *memoryQueue) nextID() string {
+	m.seq++
+	return strconv.FormatInt(m.seq, 10)
+}
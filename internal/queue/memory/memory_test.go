@@ -0,0 +1,149 @@
+package memoryQueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/queue"
+)
+
+const qname = "jobs"
+
+func mustDequeue(t *testing.T, q *memoryQueue) *queue.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := q.Dequeue(ctx, qname)
+	if err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	if msg == nil {
+		t.Fatal("Dequeue: no message")
+	}
+	return msg
+}
+
+func expectEmpty(t *testing.T, q *memoryQueue) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if msg, err := q.Dequeue(ctx, qname); msg != nil {
+		t.Fatalf("Dequeue = %s, want nothing (err %v)", msg.Body, err)
+	}
+}
+
+func TestEnqueueDequeueAck(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQ(time.Minute)
+
+	for _, body := range []string{"a", "b"} {
+		if err := q.Enqueue(ctx, qname, []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"a", "b"} {
+		msg := mustDequeue(t, q)
+		if string(msg.Body) != want || msg.Attempts != 1 {
+			t.Fatalf("Dequeue = %s attempt %d, want %s attempt 1", msg.Body, msg.Attempts, want)
+		}
+		if err := q.Ack(ctx, qname, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectEmpty(t, q)
+}
+
+func TestDequeueWakesOnEnqueue(t *testing.T) {
+	q := NewMemoryQ(time.Minute)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		q.Enqueue(context.Background(), qname, []byte("late"))
+	}()
+	if msg := mustDequeue(t, q); string(msg.Body) != "late" {
+		t.Fatalf("Dequeue = %s, want late", msg.Body)
+	}
+}
+
+func TestNackKeepsAttemptsAndDelays(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQ(time.Minute)
+	q.Enqueue(ctx, qname, []byte("job"))
+
+	msg := mustDequeue(t, q)
+	if err := q.Nack(ctx, qname, msg, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	expectEmpty(t, q)
+
+	time.Sleep(100 * time.Millisecond)
+	again := mustDequeue(t, q)
+	if again.ID != msg.ID || again.Attempts != 2 {
+		t.Fatalf("redelivered %s attempt %d, want %s attempt 2", again.ID, again.Attempts, msg.ID)
+	}
+	if err := q.Nack(ctx, qname, msg, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Nack(ctx, qname, msg, 0); !errors.Is(err, queue.ErrNotFound) {
+		t.Fatalf("Nack of a message that isn't leased: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestExpiredLeaseIsRedelivered(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQ(30 * time.Millisecond)
+	q.Enqueue(ctx, qname, []byte("job"))
+
+	first := mustDequeue(t, q)
+	time.Sleep(40 * time.Millisecond)
+	second := mustDequeue(t, q)
+	if second.ID != first.ID || second.Attempts != 2 {
+		t.Fatalf("redelivered %s attempt %d, want %s attempt 2", second.ID, second.Attempts, first.ID)
+	}
+
+	// extending keeps the lease alive past the visibility timeout
+	for i := 0; i < 3; i++ {
+		time.Sleep(20 * time.Millisecond)
+		if err := q.Extend(ctx, qname, second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectEmpty(t, q)
+}
+
+func TestBuryListRequeue(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQ(time.Minute)
+	q.Enqueue(ctx, qname, []byte("doomed"))
+
+	msg := mustDequeue(t, q)
+	if err := q.Bury(ctx, qname, msg, "boom"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Ack(ctx, qname, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	letters, total, err := q.List(ctx, qname, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(letters) != 1 || letters[0].LastError != "boom" || letters[0].Attempts != 1 {
+		t.Fatalf("List = %+v (total %d)", letters, total)
+	}
+
+	if err := q.Requeue(ctx, qname, msg.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Get(ctx, qname, msg.ID); !errors.Is(err, queue.ErrNotFound) {
+		t.Fatalf("Get after Requeue: err = %v, want ErrNotFound", err)
+	}
+	if err := q.Requeue(ctx, qname, msg.ID); !errors.Is(err, queue.ErrNotFound) {
+		t.Fatalf("second Requeue: err = %v, want ErrNotFound", err)
+	}
+	again := mustDequeue(t, q)
+	if string(again.Body) != "doomed" || again.Attempts != 1 {
+		t.Fatalf("requeued %s attempt %d, want doomed with a fresh attempt count", again.Body, again.Attempts)
+	}
+}
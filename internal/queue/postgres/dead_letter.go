@@ -0,0 +1,100 @@
+package pgQueue
+
+import (
+	"context"
+
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/queue"
+	"github.com/jackc/pgx/v5"
+)
+
+// Dead letters are the video_jobs rows left in the failed status.
+
+func (q *pgQueue) Bury(ctx context.Context, queueName string, msg *queue.Message, lastErr string) error {
+	id, err := parseID(msg.ID)
+	if err != nil {
+		return err
+	}
+	_, err = q.pool.Exec(ctx, `
+        UPDATE video_jobs SET status=$3, last_error=$4, attempts=$5, leased_until=NULL, updated_at=now()
+        WHERE id=$1 AND queue=$2
+    `, id, queueName, models.JobFailed, lastErr, msg.Attempts)
+	return err
+}
+
+func (q *pgQueue) List(ctx context.Context, queueName string, offset, limit int) ([]queue.DeadLetter, int, error) {
+	var total int
+	if err := q.pool.QueryRow(ctx, `
+        SELECT count(*) FROM video_jobs WHERE queue=$1 AND status=$2
+    `, queueName, models.JobFailed).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := q.pool.Query(ctx, `
+        SELECT id::text, COALESCE(payload::text, ''), attempts, COALESCE(last_error, ''), updated_at
+        FROM video_jobs WHERE queue=$1 AND status=$2
+        ORDER BY updated_at DESC, id DESC OFFSET $3 LIMIT $4
+    `, queueName, models.JobFailed, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	out := []queue.DeadLetter{}
+	for rows.Next() {
+		var dl queue.DeadLetter
+		if err := rows.Scan(&dl.ID, &dl.Body, &dl.Attempts, &dl.LastError, &dl.FailedAt); err != nil {
+			return nil, 0, err
+		}
+		out = append(out, dl)
+	}
+	return out, total, rows.Err()
+}
+
+func (q *pgQueue) Get(ctx context.Context, queueName string, id string) (*queue.DeadLetter, error) {
+	rowID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	var dl queue.DeadLetter
+	err = q.pool.QueryRow(ctx, `
+        SELECT id::text, COALESCE(payload::text, ''), attempts, COALESCE(last_error, ''), updated_at
+        FROM video_jobs WHERE id=$1 AND queue=$2 AND status=$3
+    `, rowID, queueName, models.JobFailed).Scan(&dl.ID, &dl.Body, &dl.Attempts, &dl.LastError, &dl.FailedAt)
+	if err == pgx.ErrNoRows {
+		return nil, queue.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
+func (q *pgQueue) Requeue(ctx context.Context, queueName string, id string) error {
+	rowID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	tag, err := q.pool.Exec(ctx, `
+        UPDATE video_jobs SET status=$4, attempts=0, last_error=NULL, available_at=now(), leased_until=NULL, updated_at=now()
+        WHERE id=$1 AND queue=$2 AND status=$3
+    `, rowID, queueName, models.JobFailed, models.JobQueued)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return queue.ErrNotFound
+	}
+	return nil
+}
+
+func (q *pgQueue) Delete(ctx context.Context, queueName string, id string) error {
+	rowID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	_, err = q.pool.Exec(ctx, `
+        DELETE FROM video_jobs WHERE id=$1 AND queue=$2 AND status=$3
+    `, rowID, queueName, models.JobFailed)
+	return err
+}
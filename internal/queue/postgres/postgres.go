@@ -0,0 +1,140 @@
+package pgQueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/db"
+	"github.com/ak-ansari/mytube/internal/jobs"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/queue"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const pollInterval = time.Second
+
+// pgQueue keeps jobs in the video_jobs table, one row per step of a video.
+// Workers lease rows with SELECT ... FOR UPDATE SKIP LOCKED; a row whose lease
+// ran out is picked up again, and retries wait in the table until available_at.
+// Enqueue joins the caller's transaction, so a job is only visible once the
+// rows it refers to are committed.
+type pgQueue struct {
+	pool       *pgxpool.Pool
+	visibility time.Duration
+}
+
+func NewPgQueue(pool *pgxpool.Pool, visibility time.Duration) *pgQueue {
+	if visibility <= 0 {
+		visibility = queue.DefaultVisibilityTimeout
+	}
+	return &pgQueue{pool: pool, visibility: visibility}
+}
+
+func (q *pgQueue) Enqueue(ctx context.Context, queueName string, payload []byte) error {
+	var p jobs.JobPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("invalid job payload: %w", err)
+	}
+	videoID, err := uuid.Parse(p.VideoID)
+	if err != nil {
+		return fmt.Errorf("invalid videoId: %w", err)
+	}
+
+	_, err = db.Conn(ctx, q.pool).Exec(ctx, `
+        INSERT INTO video_jobs (video_id, step, variant, queue, payload, status, attempts, available_at)
+        VALUES ($1,$2,$3,$4,$5,$6,0,now())
+        ON CONFLICT (video_id, step, variant) DO UPDATE SET
+            queue=EXCLUDED.queue, payload=EXCLUDED.payload, status=EXCLUDED.status, attempts=0,
+            last_error=NULL, available_at=now(), leased_until=NULL, updated_at=now()
+    `, videoID, p.Step, p.Variant, queueName, string(payload), models.JobQueued)
+	return err
+}
+
+// Dequeue leases the oldest ready row, polling while there is none. A row the
+// runner marked as retrying is still leased until its Nack lands, so the backoff
+// FailStep wrote is never raced by another worker.
+func (q *pgQueue) Dequeue(ctx context.Context, queueName string) (*queue.Message, error) {
+	var (
+		id       int64
+		payload  string
+		attempts int
+	)
+	err := q.pool.QueryRow(ctx, `
+        UPDATE video_jobs SET status=$2, attempts=attempts+1, leased_until=now()+$3::float8*interval '1 millisecond', updated_at=now()
+        WHERE id = (
+            SELECT id FROM video_jobs
+            WHERE queue=$1 AND (
+                (status IN ($4,$5) AND available_at <= now() AND (leased_until IS NULL OR leased_until < now()))
+                OR (status=$2 AND leased_until < now())
+            )
+            ORDER BY available_at, id
+            FOR UPDATE SKIP LOCKED
+            LIMIT 1
+        )
+        RETURNING id, payload::text, attempts
+    `, queueName, models.JobRunning, q.visibility.Milliseconds(), models.JobQueued, models.JobRetrying).Scan(&id, &payload, &attempts)
+	if err == pgx.ErrNoRows {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &queue.Message{ID: strconv.FormatInt(id, 10), Body: []byte(payload), Attempts: attempts}, nil
+}
+
+// Ack releases the lease, the row stays as the step's history
+func (q *pgQueue) Ack(ctx context.Context, queueName string, msg *queue.Message) error {
+	id, err := parseID(msg.ID)
+	if err != nil {
+		return err
+	}
+	_, err = q.pool.Exec(ctx, `
+        UPDATE video_jobs SET leased_until=NULL,
+            status=CASE WHEN status=$3 THEN $4 ELSE status END, updated_at=now()
+        WHERE id=$1 AND queue=$2
+    `, id, queueName, models.JobRunning, models.JobSucceeded)
+	return err
+}
+
+func (q *pgQueue) Nack(ctx context.Context, queueName string, msg *queue.Message, delay time.Duration) error {
+	id, err := parseID(msg.ID)
+	if err != nil {
+		return err
+	}
+	_, err = q.pool.Exec(ctx, `
+        UPDATE video_jobs SET status=$3, attempts=$4, available_at=now()+$5::float8*interval '1 millisecond', leased_until=NULL, updated_at=now()
+        WHERE id=$1 AND queue=$2
+    `, id, queueName, models.JobRetrying, msg.Attempts, delay.Milliseconds())
+	return err
+}
+
+func (q *pgQueue) Extend(ctx context.Context, queueName string, msg *queue.Message) error {
+	id, err := parseID(msg.ID)
+	if err != nil {
+		return err
+	}
+	_, err = q.pool.Exec(ctx, `
+        UPDATE video_jobs SET leased_until=now()+$3::float8*interval '1 millisecond', updated_at=now()
+        WHERE id=$1 AND queue=$2
+    `, id, queueName, q.visibility.Milliseconds())
+	return err
+}
+
+// parseID turns a message id back into its video_jobs row id, unknown ids are not found
+func parseID(id string) (int64, error) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, queue.ErrNotFound
+	}
+	return n, nil
+}
@@ -0,0 +1,39 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/ak-ansari/mytube/internal/config"
+	"github.com/ak-ansari/mytube/internal/queue"
+	memoryQueue "github.com/ak-ansari/mytube/internal/queue/memory"
+	pgQueue "github.com/ak-ansari/mytube/internal/queue/postgres"
+	redisQueue "github.com/ak-ansari/mytube/internal/queue/redis"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	BackendRedis    = "redis"
+	BackendPostgres = "postgres"
+	BackendMemory   = "memory"
+)
+
+// Queue is a job queue that also keeps its dead letters
+type Queue interface {
+	queue.Queue
+	queue.DeadLetterQueue
+}
+
+// New builds the queue selected by QUEUE.BACKEND, redis when it isn't set
+func New(conf *config.Config, pool *pgxpool.Pool, client *redis.Client) (Queue, error) {
+	switch conf.Queue.Backend {
+	case "", BackendRedis:
+		return redisQueue.NewRedisQ(client, conf.Queue.ConsumerGroup, conf.Queue.VisibilityTimeout), nil
+	case BackendPostgres:
+		return pgQueue.NewPgQueue(pool, conf.Queue.VisibilityTimeout), nil
+	case BackendMemory:
+		// only useful when the api and the workers share a process
+		return memoryQueue.NewMemoryQ(conf.Queue.VisibilityTimeout), nil
+	}
+	return nil, fmt.Errorf("unknown queue backend %q", conf.Queue.Backend)
+}
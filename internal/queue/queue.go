@@ -1,13 +1,52 @@
 package queue
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
+// DefaultVisibilityTimeout is how long a message stays leased without being extended
+const DefaultVisibilityTimeout = 10 * time.Minute
+
+var ErrNotFound = errors.New("message not found")
+
+// Message is a leased job. It is delivered again if it isn't acked before the
+// lease runs out.
 type Message struct {
+	ID   string
 	Body []byte
+	// Attempts counts the deliveries of this message, including the current one
+	Attempts int
 }
 
 type Queue interface {
 	Enqueue(ctx context.Context, qname string, payload []byte) error
-	Dequeue(ctx context.Context, qname string) ([]byte, error) // blocking-ish
-	// DLQ handling is implementation-specific; keep interface minimal for swapability
+	Dequeue(ctx context.Context, qname string) (*Message, error) // blocking-ish, nil when nothing is ready
+	// Ack removes a handled message for good
+	Ack(ctx context.Context, qname string, msg *Message) error
+	// Nack gives the lease back so the message is delivered again after delay
+	Nack(ctx context.Context, qname string, msg *Message, delay time.Duration) error
+	// Extend renews the lease of a message that is still being handled
+	Extend(ctx context.Context, qname string, msg *Message) error
+}
+
+// DeadLetter is a message that ran out of attempts, kept with the error that finished it
+type DeadLetter struct {
+	ID        string    `json:"id"`
+	Body      string    `json:"body"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError"`
+	FailedAt  time.Time `json:"failedAt"`
+}
+
+// DeadLetterQueue parks messages that can't be handled until an operator looks at them
+type DeadLetterQueue interface {
+	// Bury moves msg to the dead letters of qname, the caller still acks it
+	Bury(ctx context.Context, qname string, msg *Message, lastErr string) error
+	List(ctx context.Context, qname string, offset, limit int) ([]DeadLetter, int, error)
+	Get(ctx context.Context, qname string, id string) (*DeadLetter, error)
+	// Requeue puts a dead letter back on qname with a fresh attempt count
+	Requeue(ctx context.Context, qname string, id string) error
+	Delete(ctx context.Context, qname string, id string) error
 }
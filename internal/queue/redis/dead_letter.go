@@ -0,0 +1,122 @@
+package redisQueue
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/queue"
+	"github.com/redis/go-redis/v9"
+)
+
+// Dead letters live in a hash keyed by message id, with a sorted set by failure
+// time next to it for listing.
+
+func (r *redisQueue) Bury(ctx context.Context, queueName string, msg *queue.Message, lastErr string) error {
+	dl := queue.DeadLetter{
+		ID:        msg.ID,
+		Body:      string(msg.Body),
+		Attempts:  msg.Attempts,
+		LastError: lastErr,
+		FailedAt:  time.Now().UTC(),
+	}
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HSet(ctx, deadKey(queueName), dl.ID, data)
+		p.ZAdd(ctx, deadIndexKey(queueName), redis.Z{Score: float64(dl.FailedAt.UnixMilli()), Member: dl.ID})
+		return nil
+	})
+	return err
+}
+
+// List returns the most recent dead letters first, with the total count
+func (r *redisQueue) List(ctx context.Context, queueName string, offset, limit int) ([]queue.DeadLetter, int, error) {
+	total, err := r.client.ZCard(ctx, deadIndexKey(queueName)).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	ids, err := r.client.ZRevRange(ctx, deadIndexKey(queueName), int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(ids) == 0 {
+		return []queue.DeadLetter{}, int(total), nil
+	}
+
+	vals, err := r.client.HMGet(ctx, deadKey(queueName), ids...).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	out := make([]queue.DeadLetter, 0, len(vals))
+	for _, v := range vals {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var dl queue.DeadLetter
+		if err := json.Unmarshal([]byte(s), &dl); err != nil {
+			return nil, 0, err
+		}
+		out = append(out, dl)
+	}
+	return out, int(total), nil
+}
+
+func (r *redisQueue) Get(ctx context.Context, queueName string, id string) (*queue.DeadLetter, error) {
+	data, err := r.client.HGet(ctx, deadKey(queueName), id).Bytes()
+	if err == redis.Nil {
+		return nil, queue.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var dl queue.DeadLetter
+	if err := json.Unmarshal(data, &dl); err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
+// requeueScript moves a dead letter back onto the stream with its attempts
+// reset, atomically so that two requeues can't both add it
+var requeueScript = redis.NewScript(`
+local data = redis.call('HGET', KEYS[1], ARGV[1])
+if not data then
+  return 0
+end
+local dl = cjson.decode(data)
+redis.call('XADD', KEYS[3], '*', 'body', dl.body, 'attempts', 0)
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+return 1
+`)
+
+func (r *redisQueue) Requeue(ctx context.Context, queueName string, id string) error {
+	n, err := requeueScript.Run(ctx, r.client, []string{deadKey(queueName), deadIndexKey(queueName), queueName}, id).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return queue.ErrNotFound
+	}
+	return nil
+}
+
+func (r *redisQueue) Delete(ctx context.Context, queueName string, id string) error {
+	_, err := r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HDel(ctx, deadKey(queueName), id)
+		p.ZRem(ctx, deadIndexKey(queueName), id)
+		return nil
+	})
+	return err
+}
+
+func deadKey(queueName string) string {
+	return queueName + ":dead"
+}
+
+func deadIndexKey(queueName string) string {
+	return queueName + ":dead:index"
+}
@@ -2,32 +2,226 @@ package redisQueue
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/ak-ansari/mytube/internal/queue"
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	defaultGroup = "workers"
+	blockTimeout = 5 * time.Second
+
+	fieldBody     = "body"
+	fieldAttempts = "attempts"
+
+	promoteBatch = 50
+)
+
+// promoteScript moves delayed messages that are due onto the stream, atomically
+// so a crash can't lose or duplicate them
+var promoteScript = redis.NewScript(`
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, item in ipairs(items) do
+  local m = cjson.decode(item)
+  redis.call('XADD', KEYS[2], '*', 'body', m.body, 'attempts', m.attempts)
+  redis.call('ZREM', KEYS[1], item)
+end
+return #items
+`)
+
+// extendScript claims a message again only if it is still pending for the
+// consumer asking, a worker whose message was reclaimed by another must not
+// take it back while that one runs it
+var extendScript = redis.NewScript(`
+local pending = redis.call('XPENDING', KEYS[1], ARGV[1], ARGV[3], ARGV[3], 1, ARGV[2])
+if #pending == 0 then
+  return 0
+end
+redis.call('XCLAIM', KEYS[1], ARGV[1], ARGV[2], 0, ARGV[3], 'JUSTID')
+return 1
+`)
+
+// delayed is a message waiting in the delayed set for its retry time
+type delayed struct {
+	ID       string `json:"id"`
+	Body     string `json:"body"`
+	Attempts int    `json:"attempts"`
+}
+
+// redisQueue is a Redis Streams queue. Every worker reads through the same
+// consumer group, messages stay in the group's pending list until acked and
+// are reclaimed with XAUTOCLAIM once they have been idle for the visibility timeout.
 type redisQueue struct {
-	client *redis.Client
+	client     *redis.Client
+	group      string
+	consumer   string
+	visibility time.Duration
+	groups     sync.Map
 }
 
-func NewRedisQ(c *redis.Client) *redisQueue {
-	return &redisQueue{client: c}
+func NewRedisQ(c *redis.Client, group string, visibility time.Duration) *redisQueue {
+	if group == "" {
+		group = defaultGroup
+	}
+	if visibility <= 0 {
+		visibility = queue.DefaultVisibilityTimeout
+	}
+	host, _ := os.Hostname()
+	return &redisQueue{
+		client:     c,
+		group:      group,
+		consumer:   fmt.Sprintf("%s-%d", host, os.Getpid()),
+		visibility: visibility,
+	}
 }
 
 func (r *redisQueue) Enqueue(ctx context.Context, queueName string, payload []byte) error {
-	return r.client.RPush(ctx, queueName, payload).Err()
+	return r.add(ctx, queueName, payload, 0)
 }
-func (r *redisQueue) Dequeue(ctx context.Context, queueName string) ([]byte, error) {
-	res, err := r.client.BLPop(ctx, 5*time.Second, queueName).Result()
+
+func (r *redisQueue) Dequeue(ctx context.Context, queueName string) (*queue.Message, error) {
+	if err := r.ensureGroup(ctx, queueName); err != nil {
+		return nil, err
+	}
+	if err := r.promote(ctx, queueName); err != nil {
+		return nil, err
+	}
+
+	// first take over anything a dead worker left behind
+	claimed, _, err := r.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   queueName,
+		Group:    r.group,
+		Consumer: r.consumer,
+		MinIdle:  r.visibility,
+		Start:    "0-0",
+		Count:    1,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	if len(claimed) > 0 {
+		return r.toMessage(ctx, queueName, claimed[0])
+	}
+
+	res, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    r.group,
+		Consumer: r.consumer,
+		Streams:  []string{queueName, ">"},
+		Count:    1,
+		Block:    blockTimeout,
+	}).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil
 		}
 		return nil, err
 	}
-	if len(res) != 2 {
+	if len(res) == 0 || len(res[0].Messages) == 0 {
 		return nil, nil
 	}
-	return []byte(res[1]), nil
+	return r.toMessage(ctx, queueName, res[0].Messages[0])
+}
+
+func (r *redisQueue) Ack(ctx context.Context, queueName string, msg *queue.Message) error {
+	if err := r.client.XAck(ctx, queueName, r.group, msg.ID).Err(); err != nil {
+		return err
+	}
+	return r.client.XDel(ctx, queueName, msg.ID).Err()
+}
+
+// Nack re-adds the message keeping its attempt count, at the tail of the stream
+// or, with a delay, in the delayed set until it is due
+func (r *redisQueue) Nack(ctx context.Context, queueName string, msg *queue.Message, delay time.Duration) error {
+	member, err := json.Marshal(delayed{ID: msg.ID, Body: string(msg.Body), Attempts: msg.Attempts})
+	if err != nil {
+		return err
+	}
+	due := time.Now().Add(delay).UnixMilli()
+	// in one transaction, a crash in between would run the job twice or never again
+	_, err = r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		if delay <= 0 {
+			p.XAdd(ctx, &redis.XAddArgs{
+				Stream: queueName,
+				Values: map[string]any{fieldBody: msg.Body, fieldAttempts: msg.Attempts},
+			})
+		} else {
+			p.ZAdd(ctx, delayedKey(queueName), redis.Z{Score: float64(due), Member: member})
+		}
+		p.XAck(ctx, queueName, r.group, msg.ID)
+		p.XDel(ctx, queueName, msg.ID)
+		return nil
+	})
+	return err
+}
+
+// Extend claims the message again for this consumer, which resets its idle
+// time. A message another consumer has reclaimed is not found.
+func (r *redisQueue) Extend(ctx context.Context, queueName string, msg *queue.Message) error {
+	owned, err := extendScript.Run(ctx, r.client, []string{queueName}, r.group, r.consumer, msg.ID).Int()
+	if err != nil {
+		return err
+	}
+	if owned == 0 {
+		return queue.ErrNotFound
+	}
+	return nil
+}
+
+func (r *redisQueue) add(ctx context.Context, queueName string, payload []byte, attempts int) error {
+	return r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: queueName,
+		Values: map[string]any{fieldBody: payload, fieldAttempts: attempts},
+	}).Err()
+}
+
+func (r *redisQueue) promote(ctx context.Context, queueName string) error {
+	now := time.Now().UnixMilli()
+	return promoteScript.Run(ctx, r.client, []string{delayedKey(queueName), queueName}, now, promoteBatch).Err()
+}
+
+func (r *redisQueue) ensureGroup(ctx context.Context, queueName string) error {
+	if _, ok := r.groups.Load(queueName); ok {
+		return nil
+	}
+	// start at 0 so jobs enqueued before the first worker came up aren't skipped
+	err := r.client.XGroupCreateMkStream(ctx, queueName, r.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	r.groups.Store(queueName, struct{}{})
+	return nil
+}
+
+// toMessage adds the deliveries made by this group to the attempts the message
+// already carried when it was (re)added
+func (r *redisQueue) toMessage(ctx context.Context, queueName string, m redis.XMessage) (*queue.Message, error) {
+	body, _ := m.Values[fieldBody].(string)
+	prev, _ := strconv.Atoi(fmt.Sprint(m.Values[fieldAttempts]))
+
+	deliveries := int64(1)
+	pending, err := r.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: queueName,
+		Group:  r.group,
+		Start:  m.ID,
+		End:    m.ID,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) > 0 {
+		deliveries = pending[0].RetryCount
+	}
+	return &queue.Message{ID: m.ID, Body: []byte(body), Attempts: prev + int(deliveries)}, nil
+}
+
+func delayedKey(queueName string) string {
+	return queueName + ":delayed"
 }
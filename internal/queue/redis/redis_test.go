@@ -0,0 +1,234 @@
+package redisQueue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/queue"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// these run against a real server, MYTUBE_TEST_REDIS_ADDR=localhost:6379 go test ./internal/queue/redis
+func newTestQueue(t *testing.T, visibility time.Duration) (*redisQueue, string) {
+	t.Helper()
+	addr := os.Getenv("MYTUBE_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("MYTUBE_TEST_REDIS_ADDR is not set")
+	}
+	// without it a blocking read ignores the deadline of its context
+	client := redis.NewClient(&redis.Options{Addr: addr, ContextTimeoutEnabled: true})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("redis at %s: %v", addr, err)
+	}
+	qname := "test:" + uuid.NewString()
+	t.Cleanup(func() {
+		client.Del(context.Background(), qname, delayedKey(qname), deadKey(qname), deadIndexKey(qname))
+		client.Close()
+	})
+	q := NewRedisQ(client, "", visibility)
+	q.consumer = "first"
+	return q, qname
+}
+
+// otherConsumer is a second worker reading through the same group
+func otherConsumer(q *redisQueue) *redisQueue {
+	other := NewRedisQ(q.client, q.group, q.visibility)
+	other.consumer = "second"
+	return other
+}
+
+func mustDequeue(t *testing.T, q *redisQueue, qname string) *queue.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := q.Dequeue(ctx, qname)
+	if err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	if msg == nil {
+		t.Fatal("Dequeue: no message")
+	}
+	return msg
+}
+
+func expectEmpty(t *testing.T, q *redisQueue, qname string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if msg, err := q.Dequeue(ctx, qname); msg != nil {
+		t.Fatalf("Dequeue = %s, want nothing (err %v)", msg.Body, err)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	tests := []struct {
+		key  func(string) string
+		want string
+	}{
+		{delayedKey, "jobs:delayed"},
+		{deadKey, "jobs:dead"},
+		{deadIndexKey, "jobs:dead:index"},
+	}
+	for _, tt := range tests {
+		if got := tt.key("jobs"); got != tt.want {
+			t.Errorf("key = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestEnqueueDequeueAck(t *testing.T) {
+	ctx := context.Background()
+	q, qname := newTestQueue(t, time.Minute)
+
+	for _, body := range []string{"a", "b"} {
+		if err := q.Enqueue(ctx, qname, []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"a", "b"} {
+		msg := mustDequeue(t, q, qname)
+		if string(msg.Body) != want || msg.Attempts != 1 {
+			t.Fatalf("Dequeue = %s attempt %d, want %s attempt 1", msg.Body, msg.Attempts, want)
+		}
+		if err := q.Ack(ctx, qname, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectEmpty(t, q, qname)
+	// acked messages are deleted, not only taken off the pending list
+	if n := q.client.XLen(ctx, qname).Val(); n != 0 {
+		t.Errorf("stream keeps %d acked messages", n)
+	}
+}
+
+func TestNackKeepsAttemptsAndDelays(t *testing.T) {
+	ctx := context.Background()
+	q, qname := newTestQueue(t, time.Minute)
+	q.Enqueue(ctx, qname, []byte("job"))
+
+	msg := mustDequeue(t, q, qname)
+	if err := q.Nack(ctx, qname, msg, 0); err != nil {
+		t.Fatal(err)
+	}
+	again := mustDequeue(t, q, qname)
+	if string(again.Body) != "job" || again.Attempts != 2 {
+		t.Fatalf("redelivered %s attempt %d, want job attempt 2", again.Body, again.Attempts)
+	}
+
+	if err := q.Nack(ctx, qname, again, 200*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	expectEmpty(t, q, qname)
+	if n := q.client.ZCard(ctx, delayedKey(qname)).Val(); n != 1 {
+		t.Fatalf("%d delayed messages, want 1", n)
+	}
+	time.Sleep(200 * time.Millisecond)
+	last := mustDequeue(t, q, qname)
+	if string(last.Body) != "job" || last.Attempts != 3 {
+		t.Fatalf("redelivered %s attempt %d, want job attempt 3", last.Body, last.Attempts)
+	}
+	if n := q.client.ZCard(ctx, delayedKey(qname)).Val(); n != 0 {
+		t.Errorf("%d delayed messages left after promotion", n)
+	}
+}
+
+func TestExpiredLeaseIsReclaimed(t *testing.T) {
+	ctx := context.Background()
+	q, qname := newTestQueue(t, 100*time.Millisecond)
+	other := otherConsumer(q)
+	q.Enqueue(ctx, qname, []byte("job"))
+
+	first := mustDequeue(t, q, qname)
+	expectEmpty(t, other, qname)
+	time.Sleep(150 * time.Millisecond)
+	second := mustDequeue(t, other, qname)
+	if second.ID != first.ID || second.Attempts != 2 {
+		t.Fatalf("reclaimed %s attempt %d, want %s attempt 2", second.ID, second.Attempts, first.ID)
+	}
+
+	// the worker that lost the message must not take it back
+	if err := q.Extend(ctx, qname, first); !errors.Is(err, queue.ErrNotFound) {
+		t.Fatalf("Extend by the consumer that lost it: err = %v, want ErrNotFound", err)
+	}
+	// extending keeps the lease alive past the visibility timeout
+	for i := 0; i < 3; i++ {
+		time.Sleep(50 * time.Millisecond)
+		if err := other.Extend(ctx, qname, second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectEmpty(t, q, qname)
+
+	if err := other.Ack(ctx, qname, second); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Extend(ctx, qname, second); !errors.Is(err, queue.ErrNotFound) {
+		t.Errorf("Extend after Ack: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestBuryListRequeueDelete(t *testing.T) {
+	ctx := context.Background()
+	q, qname := newTestQueue(t, time.Minute)
+	for _, body := range []string{"doomed", "lost"} {
+		q.Enqueue(ctx, qname, []byte(body))
+	}
+
+	var buried []*queue.Message
+	for _, lastErr := range []string{"boom", "bang"} {
+		msg := mustDequeue(t, q, qname)
+		if err := q.Bury(ctx, qname, msg, lastErr); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.Ack(ctx, qname, msg); err != nil {
+			t.Fatal(err)
+		}
+		buried = append(buried, msg)
+		time.Sleep(2 * time.Millisecond) // apart in the index, which is by the millisecond
+	}
+	expectEmpty(t, q, qname)
+
+	letters, total, err := q.List(ctx, qname, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(letters) != 2 {
+		t.Fatalf("List = %+v (total %d), want 2", letters, total)
+	}
+	// most recent first
+	if letters[0].Body != "lost" || letters[0].LastError != "bang" || letters[1].Body != "doomed" || letters[1].Attempts != 1 {
+		t.Errorf("List = %+v", letters)
+	}
+	if page, total, _ := q.List(ctx, qname, 1, 10); total != 2 || len(page) != 1 || page[0].ID != buried[0].ID {
+		t.Errorf("List from offset 1 = %+v (total %d)", page, total)
+	}
+
+	dl, err := q.Get(ctx, qname, buried[0].ID)
+	if err != nil || dl.Body != "doomed" || dl.LastError != "boom" {
+		t.Fatalf("Get = %+v, %v", dl, err)
+	}
+	if err := q.Requeue(ctx, qname, buried[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Get(ctx, qname, buried[0].ID); !errors.Is(err, queue.ErrNotFound) {
+		t.Fatalf("Get after Requeue: err = %v, want ErrNotFound", err)
+	}
+	if err := q.Requeue(ctx, qname, buried[0].ID); !errors.Is(err, queue.ErrNotFound) {
+		t.Fatalf("second Requeue: err = %v, want ErrNotFound", err)
+	}
+	again := mustDequeue(t, q, qname)
+	if string(again.Body) != "doomed" || again.Attempts != 1 {
+		t.Fatalf("requeued %s attempt %d, want doomed with a fresh attempt count", again.Body, again.Attempts)
+	}
+
+	if err := q.Delete(ctx, qname, buried[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := q.List(ctx, qname, 0, 10); total != 0 {
+		t.Errorf("%d dead letters left after Requeue and Delete", total)
+	}
+}
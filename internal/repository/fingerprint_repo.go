@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/ak-ansari/mytube/internal/models"
+)
+
+// FingerprintRepository keeps the perceptual hashes of the keyframes of videos
+type FingerprintRepository interface {
+	// Replace drops the fingerprints of videoId and stores prints instead
+	Replace(ctx context.Context, videoId string, prints []models.Fingerprint) error
+	// Similar returns the videos with frames whose pHash is at most maxPHash and
+	// dHash at most maxDHash bits from a frame of videoId, scoring minScore or
+	// more, best first. Frames are found through their bands, which must number
+	// more than maxPHash.
+	Similar(ctx context.Context, videoId string, maxPHash, maxDHash int, minScore float64, limit int) ([]models.SimilarVideo, error)
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/models"
+)
+
+// JobRepository keeps the state of every job of a video, one per step and
+// variant. variant is empty for steps that aren't fanned out.
+type JobRepository interface {
+	// Queued records that step was enqueued and hasn't started yet
+	Queued(ctx context.Context, videoId string, step, variant string) error
+	Start(ctx context.Context, videoId string, step, variant string, attempt, maxAttempts int) error
+	// Progress records how far the running attempt of step is
+	Progress(ctx context.Context, videoId string, step, variant string, percent, speed, fps float64) error
+	Finish(ctx context.Context, videoId string, step, variant string) error
+	// Fail records errMsg, the step is retrying when retryAt is set and failed otherwise
+	Fail(ctx context.Context, videoId string, step, variant string, errMsg string, retryAt *time.Time) error
+	ListByVideo(ctx context.Context, videoId string) ([]models.VideoJob, error)
+	// Reset drops the settled jobs of steps, so that they run again once the
+	// steps they depend on are done
+	Reset(ctx context.Context, videoId string, steps []string) error
+}
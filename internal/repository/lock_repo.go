@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// LockRepository hands out leases on keys that hold across processes. A lease
+// lapses after ttl unless its holder acquires it again.
+type LockRepository interface {
+	// Acquire takes the lease on key for holder, or renews it when holder has it
+	// already. It returns false while someone else holds a live lease.
+	Acquire(ctx context.Context, key, holder string, ttl time.Duration) (bool, error)
+	// Release drops the lease on key if holder still has it
+	Release(ctx context.Context, key, holder string) error
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/ak-ansari/mytube/internal/models"
+)
+
+// ObjectRepository keeps the checksums of the objects stored for each video
+type ObjectRepository interface {
+	// Record adds o, or replaces the record of an object uploaded again
+	Record(ctx context.Context, o models.VideoObject) error
+	ListByVideo(ctx context.Context, videoId string) ([]models.VideoObject, error)
+	// Verified stores the outcome of verifying key, problem is nil when it passed
+	Verified(ctx context.Context, videoId, key string, problem *string) error
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/models"
+)
+
+// OutboxRepository keeps the messages to relay. Add joins the caller's
+// transaction, so a message exists if and only if the change it announces does.
+type OutboxRepository interface {
+	Add(ctx context.Context, kind models.OutboxKind, topic string, payload []byte) error
+	// Claim leases up to limit messages that are due, oldest first, hiding them
+	// from other relays for lease
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMessage, error)
+	// Delete drops the messages that were relayed
+	Delete(ctx context.Context, ids []int64) error
+	// Fail records errMsg, the message is tried again at retryAt
+	Fail(ctx context.Context, id int64, errMsg string, retryAt time.Time) error
+	// Listen signals on the returned channel when messages were added, until ctx is done
+	Listen(ctx context.Context) (<-chan struct{}, error)
+}
@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ak-ansari/mytube/internal/db"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type FingerprintRepo struct{ pool *pgxpool.Pool }
+
+func NewFingerprintRepo(pool *pgxpool.Pool) *FingerprintRepo {
+	return &FingerprintRepo{pool: pool}
+}
+
+func (r *FingerprintRepo) Replace(ctx context.Context, videoId string, prints []models.Fingerprint) error {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return fmt.Errorf("invalid videoId: %w", err)
+	}
+	if _, err := db.Conn(ctx, r.pool).Exec(ctx, `DELETE FROM video_fingerprints WHERE video_id=$1`, id); err != nil {
+		return err
+	}
+	if len(prints) == 0 {
+		return nil
+	}
+	positions := make([]int32, len(prints))
+	at := make([]float64, len(prints))
+	phashes := make([]int64, len(prints))
+	dhashes := make([]int64, len(prints))
+	// the bands of every frame one after the other, postgres has no arrays of arrays
+	n := len(prints[0].Bands)
+	bands := make([]int32, 0, n*len(prints))
+	for i, p := range prints {
+		if len(p.Bands) != n {
+			return fmt.Errorf("fingerprint %d has %d bands, not %d", p.Position, len(p.Bands), n)
+		}
+		// BIGINT is signed, the bits are what matter
+		positions[i], at[i], phashes[i], dhashes[i] = int32(p.Position), p.At, int64(p.PHash), int64(p.DHash)
+		bands = append(bands, p.Bands...)
+	}
+	_, err = db.Conn(ctx, r.pool).Exec(ctx, `
+        INSERT INTO video_fingerprints (video_id, position, at_seconds, phash, dhash, bands)
+        SELECT $1, f.position, f.at_seconds, f.phash, f.dhash, ($6::int[])[(f.n-1)*$7+1 : f.n*$7]
+        FROM unnest($2::int[], $3::float8[], $4::bigint[], $5::bigint[]) WITH ORDINALITY
+            AS f(position, at_seconds, phash, dhash, n)
+    `, id, positions, at, phashes, dhashes, bands, n)
+	return err
+}
+
+func (r *FingerprintRepo) Similar(ctx context.Context, videoId string, maxPHash, maxDHash int, minScore float64, limit int) ([]models.SimilarVideo, error) {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid videoId: %w", err)
+	}
+	// the bands narrow the candidates down to frames sharing a band with one
+	// of ours, every frame within maxPHash bits does, the distances are
+	// checked on those
+	rows, err := db.Conn(ctx, r.pool).Query(ctx, `
+        WITH mine AS (
+            SELECT position, phash, dhash, bands FROM video_fingerprints WHERE video_id=$1
+        ), pairs AS (
+            SELECT o.video_id, m.position AS mine, o.position AS theirs,
+                bit_count((m.phash # o.phash)::bit(64)) AS distance
+            FROM mine m
+            JOIN video_fingerprints o ON o.bands && m.bands AND o.video_id <> $1
+            WHERE bit_count((m.phash # o.phash)::bit(64)) <= $2
+              AND bit_count((m.dhash # o.dhash)::bit(64)) <= $3
+        ), matched AS (
+            SELECT video_id, COUNT(DISTINCT mine) AS mine, COUNT(DISTINCT theirs) AS theirs, AVG(distance) AS distance
+            FROM pairs GROUP BY video_id
+        ), scored AS (
+            SELECT m.video_id, m.mine, m.distance,
+                (SELECT COUNT(*) FROM video_fingerprints f WHERE f.video_id=m.video_id) AS frames,
+                GREATEST(
+                    m.mine::float8 / (SELECT COUNT(*) FROM mine),
+                    m.theirs::float8 / (SELECT COUNT(*) FROM video_fingerprints f WHERE f.video_id=m.video_id)
+                ) AS score
+            FROM matched m
+        )
+        SELECT v.id, v.filename, v.status, s.score, s.mine, s.frames, s.distance
+        FROM scored s JOIN videos v ON v.id=s.video_id AND v.deleted_at IS NULL
+        WHERE s.score >= $4
+        ORDER BY s.score DESC, s.distance, v.created_at
+        LIMIT $5
+    `, id, maxPHash, maxDHash, minScore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.SimilarVideo{}
+	for rows.Next() {
+		var s models.SimilarVideo
+		if err := rows.Scan(&s.VideoID, &s.Filename, &s.Status, &s.Score, &s.MatchedFrames, &s.Frames, &s.Distance); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
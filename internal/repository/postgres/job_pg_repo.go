@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/db"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type JobRepo struct{ pool *pgxpool.Pool }
+
+func NewJobRepo(pool *pgxpool.Pool) *JobRepo {
+	return &JobRepo{pool: pool}
+}
+
+func (r *JobRepo) Queued(ctx context.Context, videoId string, step, variant string) error {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return fmt.Errorf("invalid videoId: %w", err)
+	}
+	_, err = db.Conn(ctx, r.pool).Exec(ctx, `
+        INSERT INTO video_jobs (video_id, step, variant, status)
+        VALUES ($1,$2,$3,$4)
+        ON CONFLICT (video_id, step, variant) DO UPDATE SET
+            status=EXCLUDED.status, last_error=NULL, started_at=NULL, finished_at=NULL, duration_ms=NULL,
+            progress=NULL, speed=NULL, fps=NULL, updated_at=now()
+    `, id, step, variant, models.JobQueued)
+	return err
+}
+
+func (r *JobRepo) Start(ctx context.Context, videoId string, step, variant string, attempt, maxAttempts int) error {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return fmt.Errorf("invalid videoId: %w", err)
+	}
+	_, err = db.Conn(ctx, r.pool).Exec(ctx, `
+        INSERT INTO video_jobs (video_id, step, variant, attempts, max_attempts, status, started_at)
+        VALUES ($1,$2,$3,$4,$5,$6,now())
+        ON CONFLICT (video_id, step, variant) DO UPDATE SET
+            attempts=EXCLUDED.attempts, max_attempts=EXCLUDED.max_attempts, status=EXCLUDED.status,
+            started_at=now(), finished_at=NULL, duration_ms=NULL, progress=NULL, speed=NULL, fps=NULL, updated_at=now()
+    `, id, step, variant, attempt, maxAttempts, models.JobRunning)
+	return err
+}
+
+func (r *JobRepo) Progress(ctx context.Context, videoId string, step, variant string, percent, speed, fps float64) error {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return fmt.Errorf("invalid videoId: %w", err)
+	}
+	_, err = db.Conn(ctx, r.pool).Exec(ctx, `
+        UPDATE video_jobs SET progress=$4, speed=$5, fps=$6, updated_at=now()
+        WHERE video_id=$1 AND step=$2 AND variant=$3 AND status=$7
+    `, id, step, variant, percent, speed, fps, models.JobRunning)
+	return err
+}
+
+func (r *JobRepo) Finish(ctx context.Context, videoId string, step, variant string) error {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return fmt.Errorf("invalid videoId: %w", err)
+	}
+	_, err = db.Conn(ctx, r.pool).Exec(ctx, `
+        UPDATE video_jobs SET status=$3, last_error=NULL, finished_at=now(), progress=100,
+            duration_ms=(extract(epoch FROM now()-started_at)*1000)::bigint, updated_at=now()
+        WHERE video_id=$1 AND step=$2 AND variant=$4
+    `, id, step, models.JobSucceeded, variant)
+	return err
+}
+
+func (r *JobRepo) Fail(ctx context.Context, videoId string, step, variant string, errMsg string, retryAt *time.Time) error {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return fmt.Errorf("invalid videoId: %w", err)
+	}
+	status := models.JobFailed
+	if retryAt != nil {
+		status = models.JobRetrying
+	}
+	_, err = db.Conn(ctx, r.pool).Exec(ctx, `
+        UPDATE video_jobs SET status=$3, last_error=$4, available_at=COALESCE($5, available_at), finished_at=now(),
+            duration_ms=(extract(epoch FROM now()-started_at)*1000)::bigint, updated_at=now()
+        WHERE video_id=$1 AND step=$2 AND variant=$6
+    `, id, step, status, errMsg, retryAt, variant)
+	return err
+}
+
+func (r *JobRepo) Reset(ctx context.Context, videoId string, steps []string) error {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return fmt.Errorf("invalid videoId: %w", err)
+	}
+	_, err = db.Conn(ctx, r.pool).Exec(ctx, `
+        DELETE FROM video_jobs WHERE video_id=$1 AND step=ANY($2) AND status IN ($3,$4)
+    `, id, steps, models.JobSucceeded, models.JobFailed)
+	return err
+}
+
+func (r *JobRepo) ListByVideo(ctx context.Context, videoId string) ([]models.VideoJob, error) {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid videoId: %w", err)
+	}
+	rows, err := db.Conn(ctx, r.pool).Query(ctx, `
+        SELECT id, video_id, step, variant, status, attempts, max_attempts, last_error, progress, speed, fps, available_at, started_at, finished_at, duration_ms, created_at, updated_at
+        FROM video_jobs WHERE video_id=$1 ORDER BY COALESCE(started_at, created_at), id
+    `, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.VideoJob{}
+	for rows.Next() {
+		var j models.VideoJob
+		if err := rows.Scan(&j.ID, &j.VideoID, &j.Step, &j.Variant, &j.Status, &j.Attempts, &j.MaxAttempts, &j.LastError, &j.Progress, &j.Speed, &j.FPS, &j.AvailableAt, &j.StartedAt, &j.FinishedAt, &j.DurationMs, &j.CreatedAt, &j.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type LockRepo struct{ pool *pgxpool.Pool }
+
+func NewLockRepo(pool *pgxpool.Pool) *LockRepo {
+	return &LockRepo{pool: pool}
+}
+
+func (r *LockRepo) Acquire(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	var got string
+	err := db.Conn(ctx, r.pool).QueryRow(ctx, `
+        INSERT INTO locks (key, holder, expires_at) VALUES ($1,$2,now()+$3::float8*interval '1 millisecond')
+        ON CONFLICT (key) DO UPDATE SET holder=EXCLUDED.holder, expires_at=EXCLUDED.expires_at
+        WHERE locks.holder=EXCLUDED.holder OR locks.expires_at <= now()
+        RETURNING holder
+    `, key, holder, ttl.Milliseconds()).Scan(&got)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *LockRepo) Release(ctx context.Context, key, holder string) error {
+	_, err := db.Conn(ctx, r.pool).Exec(ctx, `DELETE FROM locks WHERE key=$1 AND holder=$2`, key, holder)
+	return err
+}
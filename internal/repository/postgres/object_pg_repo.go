@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ak-ansari/mytube/internal/db"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ObjectRepo struct{ pool *pgxpool.Pool }
+
+func NewObjectRepo(pool *pgxpool.Pool) *ObjectRepo {
+	return &ObjectRepo{pool: pool}
+}
+
+func (r *ObjectRepo) Record(ctx context.Context, o models.VideoObject) error {
+	_, err := db.Conn(ctx, r.pool).Exec(ctx, `
+        INSERT INTO video_objects (video_id, key, kind, size_bytes, sha256, md5, etag)
+        VALUES ($1,$2,$3,$4,$5,$6,$7)
+        ON CONFLICT (video_id, key) DO UPDATE SET
+            kind=EXCLUDED.kind, size_bytes=EXCLUDED.size_bytes, sha256=EXCLUDED.sha256, md5=EXCLUDED.md5,
+            etag=EXCLUDED.etag, verified_at=NULL, problem=NULL, updated_at=now()
+    `, o.VideoID, o.Key, o.Kind, o.SizeBytes, o.SHA256, o.MD5, o.ETag)
+	return err
+}
+
+func (r *ObjectRepo) ListByVideo(ctx context.Context, videoId string) ([]models.VideoObject, error) {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid videoId: %w", err)
+	}
+	rows, err := db.Conn(ctx, r.pool).Query(ctx, `
+        SELECT video_id, key, kind, size_bytes, sha256, md5, etag, verified_at, problem, created_at, updated_at
+        FROM video_objects WHERE video_id=$1 ORDER BY key
+    `, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.VideoObject{}
+	for rows.Next() {
+		var o models.VideoObject
+		if err := rows.Scan(&o.VideoID, &o.Key, &o.Kind, &o.SizeBytes, &o.SHA256, &o.MD5, &o.ETag, &o.VerifiedAt, &o.Problem, &o.CreatedAt, &o.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+func (r *ObjectRepo) Verified(ctx context.Context, videoId, key string, problem *string) error {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return fmt.Errorf("invalid videoId: %w", err)
+	}
+	_, err = db.Conn(ctx, r.pool).Exec(ctx, `
+        UPDATE video_objects SET verified_at=now(), problem=$3, updated_at=now()
+        WHERE video_id=$1 AND key=$2
+    `, id, key, problem)
+	return err
+}
@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/db"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// outboxChannel is notified by the trigger of the outbox table
+const outboxChannel = "outbox"
+
+type OutboxRepo struct{ pool *pgxpool.Pool }
+
+func NewOutboxRepo(pool *pgxpool.Pool) *OutboxRepo {
+	return &OutboxRepo{pool: pool}
+}
+
+func (r *OutboxRepo) Add(ctx context.Context, kind models.OutboxKind, topic string, payload []byte) error {
+	_, err := db.Conn(ctx, r.pool).Exec(ctx, `
+        INSERT INTO outbox (kind, topic, payload) VALUES ($1,$2,$3)
+    `, kind, topic, string(payload))
+	return err
+}
+
+func (r *OutboxRepo) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	rows, err := db.Conn(ctx, r.pool).Query(ctx, `
+        UPDATE outbox SET attempts=attempts+1, available_at=now()+$2::float8*interval '1 millisecond'
+        WHERE id IN (
+            SELECT id FROM outbox
+            WHERE available_at <= now()
+            ORDER BY available_at, id
+            FOR UPDATE SKIP LOCKED
+            LIMIT $1
+        )
+        RETURNING id, kind, topic, payload::text, attempts, last_error, available_at, created_at
+    `, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.OutboxMessage{}
+	for rows.Next() {
+		var (
+			m       models.OutboxMessage
+			payload string
+		)
+		if err := rows.Scan(&m.ID, &m.Kind, &m.Topic, &payload, &m.Attempts, &m.LastError, &m.AvailableAt, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.Payload = []byte(payload)
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// RETURNING doesn't keep the order of the subquery
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (r *OutboxRepo) Delete(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := db.Conn(ctx, r.pool).Exec(ctx, `DELETE FROM outbox WHERE id = ANY($1)`, ids)
+	return err
+}
+
+func (r *OutboxRepo) Fail(ctx context.Context, id int64, errMsg string, retryAt time.Time) error {
+	_, err := db.Conn(ctx, r.pool).Exec(ctx, `
+        UPDATE outbox SET last_error=$2, available_at=$3 WHERE id=$1
+    `, id, errMsg, retryAt)
+	return err
+}
+
+// Listen holds a connection of the pool for LISTEN, it reconnects when the
+// connection breaks and the caller polls meanwhile
+func (r *OutboxRepo) Listen(ctx context.Context) (<-chan struct{}, error) {
+	conn, err := r.listen(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan struct{}, 1)
+	go func() {
+		defer close(out)
+		for {
+			if conn != nil {
+				_, err = conn.Conn().WaitForNotification(ctx)
+				if err == nil {
+					select {
+					case out <- struct{}{}:
+					default:
+					}
+					continue
+				}
+				// the connection may be mid-query, it can't go back to the pool
+				conn.Conn().Close(context.WithoutCancel(ctx))
+				conn.Release()
+				conn = nil
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			if conn, err = r.listen(ctx); err == nil {
+				// messages may have been added while we weren't listening
+				select {
+				case out <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (r *OutboxRepo) listen(ctx context.Context) (*pgxpool.Conn, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+outboxChannel); err != nil {
+		conn.Release()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -3,9 +3,14 @@ package postgres
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/ak-ansari/mytube/internal/db"
+	"github.com/ak-ansari/mytube/internal/encoding"
 	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/repository"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -16,34 +21,59 @@ func NewVideoRepo(pool *pgxpool.Pool) *VideoRepo {
 }
 
 func (r *VideoRepo) InsertBasic(ctx context.Context, v models.Video) error {
-	_, err := r.pool.Exec(ctx, `
-        INSERT INTO videos (id, filename, original_object_key, status)
-        VALUES ($1,$2,$3,$4)
-    `, v.ID, v.Filename, v.OriginalObjectKey, v.Status)
+	_, err := db.Conn(ctx, r.pool).Exec(ctx, `
+        INSERT INTO videos (id, filename, original_object_key, sha256, size_bytes, status, encoding_profile, title, description, tags)
+        VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+    `, v.ID, v.Filename, v.OriginalObjectKey, v.SHA256, v.SizeBytes, v.Status, v.EncodingProfile, v.Title, v.Description, tags(v.Tags))
 	return err
 }
 
-func (r *VideoRepo) UpdateMeta(ctx context.Context, videoId string, sha string, dur int, vcodec string, acodec string, w int, h int, status models.VideoStatus) error {
+func (r *VideoRepo) UpdateMeta(ctx context.Context, videoId string, sha string, dur int, vcodec string, acodec string, w int, h int, bitrate int64, status models.VideoStatus) error {
 	id, _ := uuid.Parse(videoId)
-	_, err := r.pool.Exec(ctx, `
-        UPDATE videos SET sha256=$2, duration_seconds=$3, codec_video=$4, codec_audio=$5, width=$6, height=$7, status=$8,updated_at=now() WHERE id=$1
-    `, id, sha, dur, vcodec, acodec, w, h, status)
+	_, err := db.Conn(ctx, r.pool).Exec(ctx, `
+        UPDATE videos SET sha256=$2, duration_seconds=$3, codec_video=$4, codec_audio=$5, width=$6, height=$7, bitrate_bps=NULLIF($9, 0), status=$8,updated_at=now() WHERE id=$1
+    `, id, sha, dur, vcodec, acodec, w, h, status, bitrate)
 	return err
 }
-func (r *VideoRepo) UpdateQualities(ctx context.Context, videoId string, qualities []string, status models.VideoStatus) error {
+func (r *VideoRepo) UpdateQualities(ctx context.Context, videoId string, renditions []models.Rendition, status models.VideoStatus) error {
 	id, _ := uuid.Parse(videoId)
-	_, err := r.pool.Exec(ctx, `
-        UPDATE videos SET available_qualities=$2, status=$3, updated_at=now() WHERE id=$1
-    `, id, qualities, status)
+	qualities := make([]string, 0, len(renditions))
+	for _, rd := range renditions {
+		qualities = append(qualities, rd.Quality)
+	}
+	_, err := db.Conn(ctx, r.pool).Exec(ctx, `
+        UPDATE videos SET available_qualities=$2, renditions=$4, status=$3, updated_at=now() WHERE id=$1
+    `, id, qualities, status, renditions)
+	return err
+}
+func (r *VideoRepo) AddQuality(ctx context.Context, videoId string, rendition models.Rendition, status models.VideoStatus) error {
+	id, _ := uuid.Parse(videoId)
+	_, err := db.Conn(ctx, r.pool).Exec(ctx, `
+        UPDATE videos SET available_qualities=CASE
+                WHEN $2=ANY(COALESCE(available_qualities, '{}')) THEN available_qualities
+                ELSE array_append(COALESCE(available_qualities, '{}'), $2) END,
+            renditions=CASE
+                WHEN renditions @> jsonb_build_array(jsonb_build_object('quality', $2::text)) THEN renditions
+                ELSE renditions || jsonb_build_array(jsonb_build_object('quality', $2::text, 'codec', $4::text)) END,
+            status=$3, updated_at=now()
+        WHERE id=$1
+    `, id, rendition.Quality, status, rendition.Codec)
 	return err
 }
 func (r *VideoRepo) UpdateManifest(ctx context.Context, videoId string, manifest string) error {
 	id, _ := uuid.Parse(videoId)
-	_, err := r.pool.Exec(ctx, `
+	_, err := db.Conn(ctx, r.pool).Exec(ctx, `
         UPDATE videos SET manifest_path=$2,updated_at=now() WHERE id=$1
     `, id, manifest)
 	return err
 }
+func (r *VideoRepo) UpdateDashManifest(ctx context.Context, videoId string, manifest string) error {
+	id, _ := uuid.Parse(videoId)
+	_, err := db.Conn(ctx, r.pool).Exec(ctx, `
+        UPDATE videos SET dash_manifest_path=$2,updated_at=now() WHERE id=$1
+    `, id, manifest)
+	return err
+}
 func (r *VideoRepo) UpdateStatus(ctx context.Context, videoId string, status models.VideoStatus) error {
 	id, err := uuid.Parse(videoId)
 	if err != nil {
@@ -52,27 +82,293 @@ func (r *VideoRepo) UpdateStatus(ctx context.Context, videoId string, status mod
 
 	query := "UPDATE videos SET status=$2,updated_at=now() WHERE id=$1"
 
-	_, err = r.pool.Exec(ctx, query, id, status)
+	_, err = db.Conn(ctx, r.pool).Exec(ctx, query, id, status)
 	return err
 }
 
 func (r *VideoRepo) UpdateThumbnail(ctx context.Context, videoId string, thumbnailKey string) error {
 	id, _ := uuid.Parse(videoId)
-	_, err := r.pool.Exec(ctx, `
+	_, err := db.Conn(ctx, r.pool).Exec(ctx, `
         UPDATE videos SET thumbnail=$2, updated_at=now() WHERE id=$1
     `, id, thumbnailKey)
 	return err
 }
 
+const videoColumns = `id, filename, title, description, tags, original_object_key, sha256, size_bytes, duration_seconds, codec_video, codec_audio, width, height, bitrate_bps, encoding_profile, status, available_qualities, renditions, manifest_path, dash_manifest_path, thumbnail, source_id, ref_count, created_at, updated_at`
+
 func (r *VideoRepo) Get(ctx context.Context, videoId string) (*models.Video, error) {
 	id, _ := uuid.Parse(videoId)
-	row := r.pool.QueryRow(ctx, `
-        SELECT id, filename, original_object_key, sha256, duration_seconds, codec_video, codec_audio, width, height, status, available_qualities, manifest_path, thumbnail, created_at, updated_at
-        FROM videos WHERE id=$1
+	v, err := scanVideo(db.Conn(ctx, r.pool).QueryRow(ctx, `
+        SELECT `+videoColumns+`
+        FROM videos WHERE id=$1 AND deleted_at IS NULL
+    `, id))
+	if err == pgx.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	return v, err
+}
+
+// sortKeys are the expressions videos are sorted by and the type of their
+// cursor keys, they match the indexes of the videos table
+var sortKeys = map[repository.VideoSort]struct{ expr, cast string }{
+	repository.SortCreatedAt: {"created_at", "timestamptz"},
+	repository.SortDuration:  {"COALESCE(duration_seconds, 0)", "bigint"},
+	repository.SortSize:      {"COALESCE(size_bytes, 0)", "bigint"},
+}
+
+func (r *VideoRepo) List(ctx context.Context, q repository.VideoQuery) ([]models.Video, error) {
+	key, ok := sortKeys[q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort %q", q.Sort)
+	}
+	where := []string{"deleted_at IS NULL"}
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if len(q.Statuses) > 0 {
+		statuses := make([]string, len(q.Statuses))
+		for i, st := range q.Statuses {
+			statuses[i] = string(st)
+		}
+		where = append(where, "status = ANY("+arg(statuses)+"::text[])")
+	}
+	if q.CreatedAfter != nil {
+		where = append(where, "created_at >= "+arg(*q.CreatedAfter))
+	}
+	if q.CreatedBefore != nil {
+		where = append(where, "created_at < "+arg(*q.CreatedBefore))
+	}
+	if q.MinDuration != nil {
+		where = append(where, "duration_seconds >= "+arg(*q.MinDuration))
+	}
+	if q.MaxDuration != nil {
+		where = append(where, "duration_seconds <= "+arg(*q.MaxDuration))
+	}
+	if q.MinHeight != nil {
+		where = append(where, "height >= "+arg(*q.MinHeight))
+	}
+	if q.MaxHeight != nil {
+		where = append(where, "height <= "+arg(*q.MaxHeight))
+	}
+	dir, cmp := "ASC", ">"
+	if q.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if q.After != nil {
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s::%s, %s)", key.expr, cmp, arg(q.After.Key), key.cast, arg(q.After.ID)))
+	}
+
+	rows, err := db.Conn(ctx, r.pool).Query(ctx, `
+        SELECT `+videoColumns+`
+        FROM videos WHERE `+strings.Join(where, " AND ")+`
+        ORDER BY `+key.expr+` `+dir+`, id `+dir+`
+        LIMIT `+arg(q.Limit), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Video{}
+	for rows.Next() {
+		v, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *v)
+	}
+	return out, rows.Err()
+}
+
+func (r *VideoRepo) ListByHash(ctx context.Context, sha256 string) ([]models.Video, error) {
+	rows, err := db.Conn(ctx, r.pool).Query(ctx, `
+        SELECT `+videoColumns+`
+        FROM videos WHERE sha256=$1 AND deleted_at IS NULL ORDER BY created_at, id
+    `, sha256)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Video{}
+	for rows.Next() {
+		v, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *v)
+	}
+	return out, rows.Err()
+}
+
+func (r *VideoRepo) FindSource(ctx context.Context, sha256 string, profile encoding.Profile) (*models.Video, error) {
+	v, err := scanVideo(db.Conn(ctx, r.pool).QueryRow(ctx, `
+        SELECT `+videoColumns+`
+        FROM videos
+        WHERE sha256=$1 AND encoding_profile=$2 AND status=$3 AND source_id IS NULL AND deleted_at IS NULL
+        ORDER BY created_at, id
+        LIMIT 1
+        FOR UPDATE
+    `, sha256, profile, models.StatusReady))
+	if err == pgx.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	return v, err
+}
+
+func (r *VideoRepo) InsertLinked(ctx context.Context, v models.Video, sourceId string) error {
+	source, err := uuid.Parse(sourceId)
+	if err != nil {
+		return fmt.Errorf("invalid sourceId: %w", err)
+	}
+	tag, err := db.Conn(ctx, r.pool).Exec(ctx, `
+        INSERT INTO videos (id, filename, title, description, tags, original_object_key, sha256, size_bytes, duration_seconds, codec_video, codec_audio, width, height, bitrate_bps,
+            encoding_profile, status, available_qualities, renditions, manifest_path, dash_manifest_path, thumbnail, source_id, ref_count)
+        SELECT $1, $2, $5, $6, $7, original_object_key, sha256, size_bytes, duration_seconds, codec_video, codec_audio, width, height, bitrate_bps,
+            encoding_profile, $3, available_qualities, renditions, manifest_path, dash_manifest_path, thumbnail, id, 0
+        FROM videos WHERE id=$4
+    `, v.ID, v.Filename, models.StatusReady, source, v.Title, v.Description, tags(v.Tags))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *VideoRepo) AddRefs(ctx context.Context, videoId string, delta int) (int, error) {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return 0, fmt.Errorf("invalid videoId: %w", err)
+	}
+	var refs int
+	err = db.Conn(ctx, r.pool).QueryRow(ctx, `
+        UPDATE videos SET ref_count=ref_count+$2, updated_at=now() WHERE id=$1 RETURNING ref_count
+    `, id, delta).Scan(&refs)
+	if err == pgx.ErrNoRows {
+		return 0, repository.ErrNotFound
+	}
+	return refs, err
+}
+
+func (r *VideoRepo) MarkDeleted(ctx context.Context, videoId string) error {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return fmt.Errorf("invalid videoId: %w", err)
+	}
+	_, err = db.Conn(ctx, r.pool).Exec(ctx, `
+        UPDATE videos SET deleted_at=now(), updated_at=now() WHERE id=$1
     `, id)
+	return err
+}
+
+func (r *VideoRepo) Delete(ctx context.Context, videoId string) error {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return fmt.Errorf("invalid videoId: %w", err)
+	}
+	_, err = db.Conn(ctx, r.pool).Exec(ctx, `DELETE FROM videos WHERE id=$1`, id)
+	return err
+}
+
+func (r *VideoRepo) UpdateMetadata(ctx context.Context, videoId string, meta models.VideoMetadata) error {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return fmt.Errorf("invalid videoId: %w", err)
+	}
+	tag, err := db.Conn(ctx, r.pool).Exec(ctx, `
+        UPDATE videos SET title=$2, description=$3, tags=$4, updated_at=now() WHERE id=$1 AND deleted_at IS NULL
+    `, id, meta.Title, meta.Description, tags(meta.Tags))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *VideoRepo) Search(ctx context.Context, s repository.VideoSearch) ([]models.SearchHit, int, error) {
+	sel := fmt.Sprintf(`StartSel="%s", StopSel="%s"`, repository.HighlightStart, repository.HighlightStop)
+	var statuses []string
+	for _, st := range s.Statuses {
+		statuses = append(statuses, string(st))
+	}
+	// counted apart, a window count over the page has no rows to sit on past the end
+	var total int
+	if err := db.Conn(ctx, r.pool).QueryRow(ctx, `
+        SELECT count(*) FROM videos
+        WHERE deleted_at IS NULL AND search_vector @@ to_tsquery('simple', $1)
+          AND (cardinality($2::text[]) = 0 OR status = ANY($2::text[]))
+    `, s.Query, statuses).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// headlines are costly, they are only made for the page
+	rows, err := db.Conn(ctx, r.pool).Query(ctx, `
+        WITH q AS (
+            SELECT to_tsquery('simple', $1) AS query
+        ), hits AS (
+            SELECT `+videoColumns+`, ts_rank_cd(search_vector, q.query) AS rank
+            FROM videos, q
+            WHERE deleted_at IS NULL AND search_vector @@ q.query
+              AND (cardinality($2::text[]) = 0 OR status = ANY($2::text[]))
+            ORDER BY rank DESC, created_at DESC, id
+            LIMIT $3 OFFSET $4
+        )
+        SELECT `+videoColumns+`, rank,
+            ts_headline('simple', title, q.query, $5 || ', HighlightAll=true'),
+            ts_headline('simple', description, q.query, $5 || ', MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" ... "')
+        FROM hits, q
+        ORDER BY rank DESC, created_at DESC, id
+    `, s.Query, statuses, s.Limit, s.Offset, sel)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	out := []models.SearchHit{}
+	for rows.Next() {
+		var h models.SearchHit
+		v, err := scanVideo(rows, &h.Rank, &h.Highlights.Title, &h.Highlights.Description)
+		if err != nil {
+			return nil, 0, err
+		}
+		h.Video = *v
+		out = append(out, h)
+	}
+	return out, total, rows.Err()
+}
+
+// tags keeps an empty list from going in as NULL
+func tags(t []string) []string {
+	if t == nil {
+		return []string{}
+	}
+	return t
+}
+
+// scanVideo scans videoColumns, and into extra what is selected after them
+func scanVideo(row pgx.Row, extra ...any) (*models.Video, error) {
 	var v models.Video
-	if err := row.Scan(&v.ID, &v.Filename, &v.OriginalObjectKey, &v.SHA256, &v.DurationSeconds, &v.CodecVideo, &v.CodecAudio, &v.Width, &v.Height, &v.Status, &v.AvailableQualities, &v.ManifestPath, &v.Thumbnail, &v.CreatedAt, &v.UpdatedAt); err != nil {
+	dest := []any{&v.ID, &v.Filename, &v.Title, &v.Description, &v.Tags, &v.OriginalObjectKey, &v.SHA256, &v.SizeBytes, &v.DurationSeconds, &v.CodecVideo, &v.CodecAudio, &v.Width, &v.Height, &v.BitrateBps, &v.EncodingProfile, &v.Status, &v.AvailableQualities, &v.Renditions, &v.ManifestPath, &v.DashManifestPath, &v.Thumbnail, &v.SourceID, &v.RefCount, &v.CreatedAt, &v.UpdatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
 		return nil, err
 	}
 	return &v, nil
 }
+
+func (r *VideoRepo) Lock(ctx context.Context, videoId string) error {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return fmt.Errorf("invalid videoId: %w", err)
+	}
+	var locked uuid.UUID
+	err = db.Conn(ctx, r.pool).QueryRow(ctx, `SELECT id FROM videos WHERE id=$1 FOR UPDATE`, id).Scan(&locked)
+	if err == pgx.ErrNoRows {
+		return repository.ErrNotFound
+	}
+	return err
+}
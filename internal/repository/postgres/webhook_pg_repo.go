@@ -0,0 +1,223 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/db"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/repository"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const webhookColumns = `id, url, secret, events, active, created_at, updated_at`
+
+const deliveryColumns = `id, webhook_id, event_id, event_type, video_id, payload::text, status, attempts,
+            next_attempt_at, last_error, replay_of, delivered_at, created_at, updated_at`
+
+type WebhookRepo struct{ pool *pgxpool.Pool }
+
+func NewWebhookRepo(pool *pgxpool.Pool) *WebhookRepo {
+	return &WebhookRepo{pool: pool}
+}
+
+func (r *WebhookRepo) Create(ctx context.Context, w models.Webhook) error {
+	_, err := db.Conn(ctx, r.pool).Exec(ctx, `
+        INSERT INTO webhooks (id, url, secret, events, active)
+        VALUES ($1,$2,$3,$4,$5)
+    `, w.ID, w.URL, w.Secret, w.Events, w.Active)
+	return err
+}
+
+func (r *WebhookRepo) List(ctx context.Context) ([]models.Webhook, error) {
+	rows, err := db.Conn(ctx, r.pool).Query(ctx, `
+        SELECT `+webhookColumns+` FROM webhooks ORDER BY created_at, id
+    `)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhooks(rows)
+}
+
+func (r *WebhookRepo) Get(ctx context.Context, webhookId string) (*models.Webhook, error) {
+	id, err := uuid.Parse(webhookId)
+	if err != nil {
+		return nil, repository.ErrNotFound
+	}
+	var w models.Webhook
+	err = db.Conn(ctx, r.pool).QueryRow(ctx, `
+        SELECT `+webhookColumns+` FROM webhooks WHERE id=$1
+    `, id).Scan(&w.ID, &w.URL, &w.Secret, &w.Events, &w.Active, &w.CreatedAt, &w.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (r *WebhookRepo) Delete(ctx context.Context, webhookId string) error {
+	id, err := uuid.Parse(webhookId)
+	if err != nil {
+		return repository.ErrNotFound
+	}
+	tag, err := db.Conn(ctx, r.pool).Exec(ctx, `DELETE FROM webhooks WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *WebhookRepo) Subscribed(ctx context.Context, eventType string) ([]models.Webhook, error) {
+	rows, err := db.Conn(ctx, r.pool).Query(ctx, `
+        SELECT `+webhookColumns+` FROM webhooks
+        WHERE active AND (cardinality(events)=0 OR $1=ANY(events))
+        ORDER BY created_at, id
+    `, eventType)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhooks(rows)
+}
+
+func (r *WebhookRepo) InsertDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	_, err := db.Conn(ctx, r.pool).Exec(ctx, `
+        INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, video_id, payload, status, next_attempt_at, replay_of)
+        VALUES ($1,$2,$3,$4,$5,$6,$7,now(),$8)
+    `, d.ID, d.WebhookID, d.EventID, d.EventType, d.VideoID, string(d.Payload), d.Status, d.ReplayOf)
+	return err
+}
+
+func (r *WebhookRepo) GetDelivery(ctx context.Context, deliveryId string) (*models.WebhookDelivery, error) {
+	id, err := uuid.Parse(deliveryId)
+	if err != nil {
+		return nil, repository.ErrNotFound
+	}
+	d, err := scanDelivery(db.Conn(ctx, r.pool).QueryRow(ctx, `
+        SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id=$1
+    `, id))
+	if err == pgx.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	return d, err
+}
+
+func (r *WebhookRepo) ListDeliveries(ctx context.Context, webhookId string, offset, limit int) ([]models.WebhookDelivery, int, error) {
+	id, err := uuid.Parse(webhookId)
+	if err != nil {
+		return nil, 0, repository.ErrNotFound
+	}
+	var total int
+	if err := db.Conn(ctx, r.pool).QueryRow(ctx, `
+        SELECT count(*) FROM webhook_deliveries WHERE webhook_id=$1
+    `, id).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Conn(ctx, r.pool).Query(ctx, `
+        SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE webhook_id=$1
+        ORDER BY created_at DESC, id DESC OFFSET $2 LIMIT $3
+    `, id, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	out := []models.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		out = append(out, *d)
+	}
+	return out, total, rows.Err()
+}
+
+func (r *WebhookRepo) ClaimDelivery(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error) {
+	d, err := scanDelivery(db.Conn(ctx, r.pool).QueryRow(ctx, `
+        UPDATE webhook_deliveries SET attempts=attempts+1, next_attempt_at=now()+$2::float8*interval '1 millisecond', updated_at=now()
+        WHERE id = (
+            SELECT id FROM webhook_deliveries
+            WHERE status=$1 AND next_attempt_at <= now()
+            ORDER BY next_attempt_at, id
+            FOR UPDATE SKIP LOCKED
+            LIMIT 1
+        )
+        RETURNING `+deliveryColumns+`
+    `, models.DeliveryPending, lease.Milliseconds()))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+func (r *WebhookRepo) RecordAttempt(ctx context.Context, a models.WebhookAttempt, status models.DeliveryStatus, retryAt time.Time) error {
+	_, err := db.Conn(ctx, r.pool).Exec(ctx, `
+        WITH attempt AS (
+            INSERT INTO webhook_attempts (delivery_id, attempt, status_code, error, response_body, duration_ms)
+            VALUES ($1,$2,$3,$4,$5,$6)
+        )
+        UPDATE webhook_deliveries SET status=$7, last_error=$4, next_attempt_at=$8,
+            delivered_at=CASE WHEN $7=$9 THEN now() ELSE delivered_at END, updated_at=now()
+        WHERE id=$1
+    `, a.DeliveryID, a.Attempt, a.StatusCode, a.Error, a.ResponseBody, a.DurationMs, status, retryAt, models.DeliverySucceeded)
+	return err
+}
+
+func (r *WebhookRepo) ListAttempts(ctx context.Context, deliveryId string) ([]models.WebhookAttempt, error) {
+	id, err := uuid.Parse(deliveryId)
+	if err != nil {
+		return nil, repository.ErrNotFound
+	}
+	rows, err := db.Conn(ctx, r.pool).Query(ctx, `
+        SELECT id, delivery_id, attempt, status_code, error, response_body, duration_ms, created_at
+        FROM webhook_attempts WHERE delivery_id=$1 ORDER BY attempt, id
+    `, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.WebhookAttempt{}
+	for rows.Next() {
+		var a models.WebhookAttempt
+		if err := rows.Scan(&a.ID, &a.DeliveryID, &a.Attempt, &a.StatusCode, &a.Error, &a.ResponseBody, &a.DurationMs, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func scanWebhooks(rows pgx.Rows) ([]models.Webhook, error) {
+	defer rows.Close()
+	out := []models.Webhook{}
+	for rows.Next() {
+		var w models.Webhook
+		if err := rows.Scan(&w.ID, &w.URL, &w.Secret, &w.Events, &w.Active, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+func scanDelivery(row pgx.Row) (*models.WebhookDelivery, error) {
+	var (
+		d       models.WebhookDelivery
+		payload string
+	)
+	if err := row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.VideoID, &payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastError, &d.ReplayOf, &d.DeliveredAt, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		return nil, err
+	}
+	d.Payload = []byte(payload)
+	return &d, nil
+}
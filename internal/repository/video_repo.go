@@ -2,16 +2,103 @@ package repository
 
 import (
 	"context"
+	"time"
 
+	"github.com/ak-ansari/mytube/internal/encoding"
 	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/google/uuid"
 )
 
+// VideoSort is what videos are listed by, ties are broken by id
+type VideoSort string
+
+const (
+	SortCreatedAt VideoSort = "created_at"
+	SortDuration  VideoSort = "duration"
+	SortSize      VideoSort = "size"
+)
+
+// VideoCursor is the last video of a page, the next one starts after it
+type VideoCursor struct {
+	// Key is the sort key of the video, a time.Time for SortCreatedAt and an
+	// int64 for the others
+	Key any
+	ID  uuid.UUID
+}
+
+// VideoQuery filters and orders the videos List returns, unset filters match
+// every video
+type VideoQuery struct {
+	Statuses      []models.VideoStatus
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// durations are in seconds
+	MinDuration *int
+	MaxDuration *int
+	// MinHeight and MaxHeight filter on the resolution, 720 for 720p
+	MinHeight *int
+	MaxHeight *int
+	Sort      VideoSort
+	Desc      bool
+	After     *VideoCursor
+	Limit     int
+}
+
+// Highlights of search hits mark the matching words with these, which can't
+// appear in metadata
+const (
+	HighlightStart = "\x02"
+	HighlightStop  = "\x03"
+)
+
+// VideoSearch is a full-text search of the metadata of videos
+type VideoSearch struct {
+	// Query is a tsquery of the simple configuration
+	Query    string
+	Statuses []models.VideoStatus
+	Offset   int
+	Limit    int
+}
+
 type VideoRepository interface {
 	InsertBasic(ctx context.Context, v models.Video) error
-	UpdateMeta(ctx context.Context, videoId string, sha string, dur int, vcodec, acodec string, w, h int, status models.VideoStatus) error
+	UpdateMeta(ctx context.Context, videoId string, sha string, dur int, vcodec, acodec string, w, h int, bitrate int64, status models.VideoStatus) error
 	UpdateStatus(ctx context.Context, videoId string, status models.VideoStatus) error
-	UpdateQualities(ctx context.Context, videoId string, qualities []string, status models.VideoStatus) error
+	UpdateQualities(ctx context.Context, videoId string, renditions []models.Rendition, status models.VideoStatus) error
+	// AddQuality appends rendition to the available ones unless it is already there
+	AddQuality(ctx context.Context, videoId string, rendition models.Rendition, status models.VideoStatus) error
 	UpdateManifest(ctx context.Context, videoId string, manifest string) error
+	UpdateDashManifest(ctx context.Context, videoId string, manifest string) error
 	UpdateThumbnail(ctx context.Context, videoId string, thumbnailKey string) error
+	// Get returns ErrNotFound for videos that don't exist or were deleted
 	Get(ctx context.Context, videoId string) (*models.Video, error)
+	// List returns the videos matching q in its order
+	List(ctx context.Context, q VideoQuery) ([]models.Video, error)
+	// Search returns a page of the videos matching s, best first, and how many
+	// match in all
+	Search(ctx context.Context, s VideoSearch) ([]models.SearchHit, int, error)
+	// UpdateMetadata replaces the title, description and tags of a video
+	UpdateMetadata(ctx context.Context, videoId string, meta models.VideoMetadata) error
+	// ListByHash returns the videos uploaded with content sha256, oldest first
+	ListByHash(ctx context.Context, sha256 string) ([]models.Video, error)
+	// FindSource returns the oldest ready video with content sha256 processed with
+	// profile that owns its objects, and locks it until the transaction ends
+	FindSource(ctx context.Context, sha256 string, profile encoding.Profile) (*models.Video, error)
+	// InsertLinked inserts v as a ready duplicate of source, sharing everything
+	// the pipeline produced for it
+	InsertLinked(ctx context.Context, v models.Video, sourceId string) error
+	// AddRefs adds delta to the references to the objects of videoId and
+	// returns how many are left
+	AddRefs(ctx context.Context, videoId string, delta int) (int, error)
+	// MarkDeleted hides a video whose objects are still used by its duplicates
+	MarkDeleted(ctx context.Context, videoId string) error
+	Delete(ctx context.Context, videoId string) error
+	// Lock takes the video's row lock until the surrounding transaction ends
+	Lock(ctx context.Context, videoId string) error
+}
+
+// Transactor runs fn in one database transaction that the repositories called
+// with the ctx it receives take part in
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/models"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// WebhookRepository keeps the webhooks, the deliveries made to them and every
+// attempt of those deliveries
+type WebhookRepository interface {
+	Create(ctx context.Context, w models.Webhook) error
+	List(ctx context.Context) ([]models.Webhook, error)
+	Get(ctx context.Context, id string) (*models.Webhook, error)
+	Delete(ctx context.Context, id string) error
+	// Subscribed returns the active webhooks that want eventType
+	Subscribed(ctx context.Context, eventType string) ([]models.Webhook, error)
+
+	InsertDelivery(ctx context.Context, d models.WebhookDelivery) error
+	GetDelivery(ctx context.Context, id string) (*models.WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, webhookId string, offset, limit int) ([]models.WebhookDelivery, int, error)
+	// ClaimDelivery leases the oldest pending delivery that is due, hiding it
+	// from other senders for lease. It returns nil when none is due.
+	ClaimDelivery(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error)
+	// RecordAttempt stores attempt and moves its delivery to status. A pending
+	// delivery is tried again at retryAt.
+	RecordAttempt(ctx context.Context, attempt models.WebhookAttempt, status models.DeliveryStatus, retryAt time.Time) error
+	ListAttempts(ctx context.Context, deliveryId string) ([]models.WebhookAttempt, error)
+}
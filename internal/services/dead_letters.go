@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ak-ansari/mytube/internal/jobs"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/queue"
+)
+
+// DeadJob is a dead-lettered pipeline job as shown to operators
+type DeadJob struct {
+	queue.DeadLetter
+	Payload *jobs.JobPayload `json:"payload,omitempty"`
+}
+
+type DeadJobList struct {
+	Items  []DeadJob `json:"items"`
+	Total  int       `json:"total"`
+	Offset int       `json:"offset"`
+	Limit  int       `json:"limit"`
+}
+
+func (v *VideoService) ListDeadJobs(ctx context.Context, offset, limit int) (*DeadJobList, error) {
+	letters, total, err := v.dlq.List(ctx, v.queueName, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]DeadJob, 0, len(letters))
+	for _, dl := range letters {
+		items = append(items, toDeadJob(dl))
+	}
+	return &DeadJobList{Items: items, Total: total, Offset: offset, Limit: limit}, nil
+}
+
+func (v *VideoService) GetDeadJob(ctx context.Context, id string) (*DeadJob, error) {
+	dl, err := v.dlq.Get(ctx, v.queueName, id)
+	if err != nil {
+		return nil, err
+	}
+	dj := toDeadJob(*dl)
+	return &dj, nil
+}
+
+// RequeueDeadJob sends a dead-lettered job through the pipeline again. The
+// steps after it are reset first, what they made came from the run that failed
+// and they have to run again on what the job makes now.
+func (v *VideoService) RequeueDeadJob(ctx context.Context, id string) error {
+	dj, err := v.GetDeadJob(ctx, id)
+	if err != nil {
+		return err
+	}
+	if dj.Payload == nil || dj.Payload.VideoID == "" {
+		return v.dlq.Requeue(ctx, v.queueName, id)
+	}
+	p := dj.Payload
+	err = v.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := v.repo.Lock(ctx, p.VideoID); err != nil {
+			return err
+		}
+		downstream := v.pipeline.Downstream(p.Step)
+		if len(downstream) == 0 {
+			return nil
+		}
+		steps := make([]string, len(downstream))
+		for i, s := range downstream {
+			steps[i] = string(s)
+		}
+		return v.jobRepo.Reset(ctx, p.VideoID, steps)
+	})
+	if err != nil {
+		return err
+	}
+	if err := v.dlq.Requeue(ctx, v.queueName, id); err != nil {
+		return err
+	}
+	return v.UpdateStatus(ctx, p.VideoID, models.StatusProcessing)
+}
+
+func (v *VideoService) DeleteDeadJob(ctx context.Context, id string) error {
+	if _, err := v.dlq.Get(ctx, v.queueName, id); err != nil {
+		return err
+	}
+	return v.dlq.Delete(ctx, v.queueName, id)
+}
+
+func toDeadJob(dl queue.DeadLetter) DeadJob {
+	dj := DeadJob{DeadLetter: dl}
+	var p jobs.JobPayload
+	if err := json.Unmarshal([]byte(dl.Body), &p); err == nil {
+		dj.Payload = &p
+	}
+	return dj
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ak-ansari/mytube/internal/cache"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/repository"
+)
+
+var ErrVideoBusy = errors.New("video is still being processed")
+
+// linkDuplicate registers vm as a duplicate of source, a ready video with the
+// same content and profile, instead of processing it again. It is ready at
+// once and shares everything stored for source.
+func (v *VideoService) linkDuplicate(ctx context.Context, vm models.Video, source *models.Video) error {
+	if err := v.repo.InsertLinked(ctx, vm, source.ID.String()); err != nil {
+		return err
+	}
+	if _, err := v.repo.AddRefs(ctx, source.ID.String(), 1); err != nil {
+		return err
+	}
+	// the same announcements as a video going through the pipeline
+	for _, status := range []models.VideoStatus{models.StatusUploaded, models.StatusReady} {
+		if err := v.notifyWebhooks(ctx, vm.ID.String(), status); err != nil {
+			return err
+		}
+		if err := v.publishStatus(ctx, vm.ID.String(), status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetVideosByHash returns the videos whose content hashes to sum, oldest first
+func (v *VideoService) GetVideosByHash(ctx context.Context, sum string) ([]models.Video, error) {
+	sum = strings.ToLower(sum)
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != 32 {
+		return nil, ErrInvalidChecksum
+	}
+	videos, err := v.repo.ListByHash(ctx, sum)
+	if err != nil {
+		return nil, err
+	}
+	if len(videos) == 0 {
+		return nil, fmt.Errorf("no video with sha256 %s: %w", sum, repository.ErrNotFound)
+	}
+	return videos, nil
+}
+
+// DeleteVideo deletes a video that is ready or failed. A duplicate only drops
+// its reference to the objects of its source, the objects go with the last
+// video using them. A source deleted before its duplicates stays hidden until then.
+func (v *VideoService) DeleteVideo(ctx context.Context, id string) error {
+	var keys []string
+	err := v.tx.WithinTx(ctx, func(ctx context.Context) error {
+		keys = nil
+		if err := v.repo.Lock(ctx, id); err != nil {
+			return err
+		}
+		video, err := v.repo.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if video.Status != models.StatusReady && video.Status != models.StatusFailed {
+			return ErrVideoBusy
+		}
+
+		owner := id
+		if video.SourceID != nil {
+			owner = video.SourceID.String()
+			if err := v.repo.Delete(ctx, id); err != nil {
+				return err
+			}
+		}
+		refs, err := v.repo.AddRefs(ctx, owner, -1)
+		if err != nil {
+			return err
+		}
+		if refs > 0 {
+			if owner == id {
+				return v.repo.MarkDeleted(ctx, id)
+			}
+			return nil
+		}
+		// a duplicate carries the same keys as its source
+		if keys, err = v.ownedKeys(ctx, owner, video); err != nil {
+			return err
+		}
+		return v.repo.Delete(ctx, owner)
+	})
+	if err != nil {
+		return err
+	}
+
+	// the rows are gone, an object left behind is wasted space but nothing points at it
+	var errs []error
+	if err := v.cache.Delete(ctx, cache.GetKey(cache.KEY, id)); err != nil {
+		errs = append(errs, err)
+	}
+	for _, key := range keys {
+		if err := v.objStore.Delete(ctx, key); err != nil {
+			errs = append(errs, fmt.Errorf("delete %s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ownedKeys are the stored objects of owner: the original, whatever the
+// pipeline recorded and the keys the video points at, which are all there is
+// for videos processed before objects were recorded
+func (v *VideoService) ownedKeys(ctx context.Context, owner string, video *models.Video) ([]string, error) {
+	objects, err := v.objects.ListByVideo(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var keys []string
+	add := func(key *string) {
+		if key != nil && *key != "" && !seen[*key] {
+			seen[*key] = true
+			keys = append(keys, *key)
+		}
+	}
+	add(&video.OriginalObjectKey)
+	for _, o := range objects {
+		add(&o.Key)
+	}
+	add(video.ManifestPath)
+	add(video.DashManifestPath)
+	add(video.Thumbnail)
+	return keys, nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/repository"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+var ErrInvalidListQuery = errors.New("invalid video list query")
+
+var videoStatuses = map[models.VideoStatus]bool{
+	models.StatusUploaded:   true,
+	models.StatusValid:      true,
+	models.StatusProcessing: true,
+	models.StatusReady:      true,
+	models.StatusFailed:     true,
+}
+
+// VideoList is a page of videos
+type VideoList struct {
+	Items []models.Video `json:"items"`
+	// NextCursor fetches the page after this one, it is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// videoCursor is what a cursor handed to clients holds, the sort it was made
+// for is kept so it isn't used with another one
+type videoCursor struct {
+	Sort repository.VideoSort `json:"s"`
+	Desc bool                 `json:"d,omitempty"`
+	Key  string               `json:"k"`
+	ID   uuid.UUID            `json:"id"`
+}
+
+// ListVideos returns a page of the videos matching q, starting after cursor
+// when it is set. q.After is filled in from the cursor.
+func (v *VideoService) ListVideos(ctx context.Context, q repository.VideoQuery, cursor string) (*VideoList, error) {
+	if q.Sort == "" {
+		q.Sort, q.Desc = repository.SortCreatedAt, true
+	}
+	switch q.Sort {
+	case repository.SortCreatedAt, repository.SortDuration, repository.SortSize:
+	default:
+		return nil, fmt.Errorf("%w: unknown sort %s", ErrInvalidListQuery, q.Sort)
+	}
+	for _, s := range q.Statuses {
+		if !videoStatuses[s] {
+			return nil, fmt.Errorf("%w: unknown status %s", ErrInvalidListQuery, s)
+		}
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultListLimit
+	}
+	q.Limit = min(q.Limit, MaxListLimit)
+	if cursor != "" {
+		after, err := decodeCursor(cursor, q.Sort, q.Desc)
+		if err != nil {
+			return nil, err
+		}
+		q.After = after
+	}
+
+	// one more tells whether there is a next page
+	limit := q.Limit
+	q.Limit++
+	videos, err := v.repo.List(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	list := &VideoList{Items: videos}
+	if len(videos) > limit {
+		list.Items = videos[:limit]
+		last := list.Items[limit-1]
+		if list.NextCursor, err = encodeCursor(q.Sort, q.Desc, &last); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+func encodeCursor(sort repository.VideoSort, desc bool, last *models.Video) (string, error) {
+	c := videoCursor{Sort: sort, Desc: desc, ID: last.ID}
+	switch sort {
+	case repository.SortCreatedAt:
+		c.Key = last.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case repository.SortDuration:
+		c.Key = "0"
+		if last.DurationSeconds != nil {
+			c.Key = strconv.Itoa(*last.DurationSeconds)
+		}
+	case repository.SortSize:
+		c.Key = "0"
+		if last.SizeBytes != nil {
+			c.Key = strconv.FormatInt(*last.SizeBytes, 10)
+		}
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(cursor string, sort repository.VideoSort, desc bool) (*repository.VideoCursor, error) {
+	invalid := fmt.Errorf("%w: invalid cursor", ErrInvalidListQuery)
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalid
+	}
+	var c videoCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, invalid
+	}
+	if c.Sort != sort || c.Desc != desc {
+		return nil, fmt.Errorf("%w: the cursor is for another sort order", ErrInvalidListQuery)
+	}
+	var key any
+	if sort == repository.SortCreatedAt {
+		key, err = time.Parse(time.RFC3339Nano, c.Key)
+	} else {
+		key, err = strconv.ParseInt(c.Key, 10, 64)
+	}
+	if err != nil {
+		return nil, invalid
+	}
+	return &repository.VideoCursor{Key: key, ID: c.ID}, nil
+}
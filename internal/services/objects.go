@@ -0,0 +1,21 @@
+package services
+
+import (
+	"context"
+
+	"github.com/ak-ansari/mytube/internal/models"
+)
+
+// RecordObject keeps the checksums of an object stored for a video
+func (v *VideoService) RecordObject(ctx context.Context, o models.VideoObject) error {
+	return v.objects.Record(ctx, o)
+}
+
+func (v *VideoService) ListObjects(ctx context.Context, videoId string) ([]models.VideoObject, error) {
+	return v.objects.ListByVideo(ctx, videoId)
+}
+
+// ObjectVerified stores what verifying key found, problem is nil when it passed
+func (v *VideoService) ObjectVerified(ctx context.Context, videoId, key string, problem *string) error {
+	return v.objects.Verified(ctx, videoId, key, problem)
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/events"
+	"github.com/ak-ansari/mytube/internal/jobs"
+	"github.com/ak-ansari/mytube/internal/models"
+)
+
+// outboxLease is how long a claimed message is hidden from other relays, a
+// relay that dies with it leased only delays it
+const outboxLease = 30 * time.Second
+
+// outboxRetry paces a message the queue or the bus keeps refusing. It is never
+// exhausted, the message waits in the outbox until they are back.
+var outboxRetry = jobs.RetryPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// publish writes e to the outbox in the caller's transaction, the relay puts it
+// on the bus once that is committed
+func (v *VideoService) publish(ctx context.Context, e events.Event) error {
+	e.At = time.Now().UTC()
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return v.outbox.Add(ctx, models.OutboxEvent, e.VideoID, body)
+}
+
+// RelayOutbox sends up to limit committed outbox messages to the queue or the
+// bus and returns how many it claimed. A message is deleted once it was sent,
+// so it is sent at least once, and more than once if the relay dies in between.
+func (v *VideoService) RelayOutbox(ctx context.Context, limit int) (int, error) {
+	msgs, err := v.outbox.Claim(ctx, limit, outboxLease)
+	if err != nil {
+		return 0, err
+	}
+	// settle what was claimed even if we are shutting down
+	settleCtx := context.WithoutCancel(ctx)
+	sent := make([]int64, 0, len(msgs))
+	var failed error
+	for _, m := range msgs {
+		if err := v.relay(ctx, m); err != nil {
+			failed = fmt.Errorf("relay outbox message %d: %w", m.ID, err)
+			retryAt := time.Now().Add(outboxRetry.Backoff(m.Attempts))
+			if err := v.outbox.Fail(settleCtx, m.ID, err.Error(), retryAt); err != nil {
+				return len(msgs), err
+			}
+			continue
+		}
+		sent = append(sent, m.ID)
+	}
+	if err := v.outbox.Delete(settleCtx, sent); err != nil {
+		return len(msgs), err
+	}
+	return len(msgs), failed
+}
+
+func (v *VideoService) relay(ctx context.Context, m models.OutboxMessage) error {
+	switch m.Kind {
+	case models.OutboxJob:
+		return v.queue.Enqueue(ctx, m.Topic, m.Payload)
+	case models.OutboxEvent:
+		var e events.Event
+		if err := json.Unmarshal(m.Payload, &e); err != nil {
+			return err
+		}
+		return v.bus.Publish(ctx, e)
+	}
+	return fmt.Errorf("unknown outbox message kind %q", m.Kind)
+}
+
+// WatchOutbox signals when messages were added to the outbox
+func (v *VideoService) WatchOutbox(ctx context.Context) (<-chan struct{}, error) {
+	return v.outbox.Listen(ctx)
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ak-ansari/mytube/internal/events"
+	"github.com/ak-ansari/mytube/internal/jobs"
+	"github.com/ak-ansari/mytube/internal/models"
+)
+
+// stepState sums up the jobs of a step, which are several when it is fanned out
+type stepState struct {
+	jobs, succeeded, failed int
+}
+
+// done reports whether every job settled with at least one success, a fanned
+// out step goes on with the variants it has
+func (s stepState) done() bool {
+	return s.jobs > 0 && s.succeeded > 0 && s.succeeded+s.failed == s.jobs
+}
+
+// lost reports whether every job of the step failed
+func (s stepState) lost() bool {
+	return s.jobs > 0 && s.failed == s.jobs
+}
+
+func (v *VideoService) Pipeline() *jobs.Pipeline {
+	return v.pipeline
+}
+
+// CompleteStep records the job of p as succeeded and enqueues the steps that
+// were only waiting on it.
+func (v *VideoService) CompleteStep(ctx context.Context, p jobs.JobPayload) ([]jobs.Step, error) {
+	var next []jobs.Step
+	err := v.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := v.repo.Lock(ctx, p.VideoID); err != nil {
+			return err
+		}
+		if err := v.jobRepo.Finish(ctx, p.VideoID, string(p.Step), p.Variant); err != nil {
+			return err
+		}
+		var err error
+		if next, _, err = v.advance(ctx, p); err != nil {
+			return err
+		}
+		return v.publish(ctx, stepEvent(events.TypeStepFinished, p, 0))
+	})
+	return next, err
+}
+
+// FailVariant records a job of a fanned out step that failed for good. The
+// step still completes with the variants that succeed, so ok is false only
+// once all of them failed and the video can't go on.
+func (v *VideoService) FailVariant(ctx context.Context, p jobs.JobPayload, errMsg string) (next []jobs.Step, ok bool, err error) {
+	err = v.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := v.repo.Lock(ctx, p.VideoID); err != nil {
+			return err
+		}
+		if err := v.jobRepo.Fail(ctx, p.VideoID, string(p.Step), p.Variant, errMsg, nil); err != nil {
+			return err
+		}
+		var state stepState
+		if next, state, err = v.advance(ctx, p); err != nil {
+			return err
+		}
+		ok = !state.lost()
+		e := stepEvent(events.TypeStepFailed, p, 0)
+		e.Error = errMsg
+		return v.publish(ctx, e)
+	})
+	return next, ok, err
+}
+
+// advance enqueues the dependents of p's step whose dependencies are all done.
+// Callers hold the video's row lock, so when parallel jobs finish at the same
+// time exactly one of them enqueues the step joining them.
+func (v *VideoService) advance(ctx context.Context, p jobs.JobPayload) ([]jobs.Step, stepState, error) {
+	rows, err := v.jobRepo.ListByVideo(ctx, p.VideoID)
+	if err != nil {
+		return nil, stepState{}, err
+	}
+	states := map[jobs.Step]stepState{}
+	for _, r := range rows {
+		s := states[jobs.Step(r.Step)]
+		s.jobs++
+		switch r.Status {
+		case models.JobSucceeded:
+			s.succeeded++
+		case models.JobFailed:
+			s.failed++
+		}
+		states[jobs.Step(r.Step)] = s
+	}
+
+	var next []jobs.Step
+	for _, cand := range v.pipeline.Dependents(p.Step) {
+		// already on its way, e.g. this job was delivered twice. Rows left
+		// from an earlier run were reset when the job was requeued.
+		if s := states[cand]; s.jobs > 0 && !s.lost() {
+			continue
+		}
+		ready := true
+		for _, dep := range v.pipeline.DependsOn(cand) {
+			if !states[dep].done() {
+				ready = false
+				break
+			}
+		}
+		if ready {
+			next = append(next, cand)
+		}
+	}
+	return next, states[p.Step], v.enqueueSteps(ctx, p.VideoID, next)
+}
+
+// enqueueSteps marks the jobs of steps as queued and puts them in the outbox for
+// the queue, one per variant for fanned out steps. The relay enqueues them once
+// the caller's transaction commits.
+func (v *VideoService) enqueueSteps(ctx context.Context, videoId string, steps []jobs.Step) error {
+	for _, step := range steps {
+		variants, err := v.variants(ctx, videoId, step)
+		if err != nil {
+			return err
+		}
+		for _, variant := range variants {
+			payload, err := json.Marshal(jobs.JobPayload{VideoID: videoId, Step: step, Variant: variant})
+			if err != nil {
+				return err
+			}
+			if err := v.jobRepo.Queued(ctx, videoId, string(step), variant); err != nil {
+				return err
+			}
+			if err := v.outbox.Add(ctx, models.OutboxJob, v.queueName, payload); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// variants lists the jobs step is split into, a single unnamed one unless it fans out
+func (v *VideoService) variants(ctx context.Context, videoId string, step jobs.Step) ([]string, error) {
+	switch v.pipeline.FanOut(step) {
+	case jobs.FanOutRenditions:
+		video, err := v.repo.Get(ctx, videoId)
+		if err != nil {
+			return nil, err
+		}
+		ladder := v.Ladder(video)
+		labels := make([]string, 0, len(ladder))
+		for _, q := range ladder {
+			labels = append(labels, q.Label)
+		}
+		return labels, nil
+	}
+	return []string{""}, nil
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/repository"
+)
+
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 5000
+	maxTags              = 20
+	maxTagLength         = 50
+	// maxSearchTerms keeps the tsquery of a pasted paragraph reasonable
+	maxSearchTerms = 10
+)
+
+var (
+	ErrInvalidMetadata = errors.New("invalid video metadata")
+	ErrInvalidSearch   = errors.New("invalid search")
+)
+
+// SearchResults is a page of search hits
+type SearchResults struct {
+	Items  []models.SearchHit `json:"items"`
+	Total  int                `json:"total"`
+	Offset int                `json:"offset"`
+	Limit  int                `json:"limit"`
+}
+
+// MetadataPatch changes the fields that are set
+type MetadataPatch struct {
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	Tags        *[]string `json:"tags"`
+}
+
+// normalizeMetadata trims meta, titles it after filename when it has no
+// title and lowercases and dedupes the tags
+func normalizeMetadata(meta models.VideoMetadata, filename string) (models.VideoMetadata, error) {
+	out := models.VideoMetadata{
+		Title:       clean(meta.Title),
+		Description: clean(meta.Description),
+		Tags:        []string{},
+	}
+	if out.Title == "" {
+		out.Title = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	for _, t := range meta.Tags {
+		t = strings.ToLower(clean(t))
+		if t != "" && !slices.Contains(out.Tags, t) {
+			out.Tags = append(out.Tags, t)
+		}
+	}
+	switch {
+	case len([]rune(out.Title)) > maxTitleLength:
+		return out, fmt.Errorf("%w: title is longer than %d characters", ErrInvalidMetadata, maxTitleLength)
+	case len([]rune(out.Description)) > maxDescriptionLength:
+		return out, fmt.Errorf("%w: description is longer than %d characters", ErrInvalidMetadata, maxDescriptionLength)
+	case len(out.Tags) > maxTags:
+		return out, fmt.Errorf("%w: more than %d tags", ErrInvalidMetadata, maxTags)
+	}
+	for _, t := range out.Tags {
+		if len([]rune(t)) > maxTagLength {
+			return out, fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalidMetadata, t, maxTagLength)
+		}
+	}
+	return out, nil
+}
+
+// clean trims s and drops control characters but line breaks, which also
+// keeps the highlight markers out of metadata
+func clean(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimSpace(s)
+}
+
+// ParseTags splits a comma separated list of tags
+func ParseTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// UpdateMetadata changes the title, description or tags of a video. The video
+// is locked while the patch is applied, concurrent patches of different fields
+// would otherwise undo each other.
+func (v *VideoService) UpdateMetadata(ctx context.Context, id string, patch MetadataPatch) (*models.Video, error) {
+	var updated *models.Video
+	err := v.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := v.repo.Lock(ctx, id); err != nil {
+			return err
+		}
+		video, err := v.repo.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		meta := patch.apply(video.VideoMetadata)
+		if meta, err = normalizeMetadata(meta, video.Filename); err != nil {
+			return err
+		}
+		if err := v.repo.UpdateMetadata(ctx, id, meta); err != nil {
+			return err
+		}
+		updated, err = v.repo.Get(ctx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// apply returns meta with the fields of the patch that are set
+func (p MetadataPatch) apply(meta models.VideoMetadata) models.VideoMetadata {
+	if p.Title != nil {
+		meta.Title = *p.Title
+	}
+	if p.Description != nil {
+		meta.Description = *p.Description
+	}
+	if p.Tags != nil {
+		meta.Tags = *p.Tags
+	}
+	return meta
+}
+
+// SearchVideos finds the videos whose title, tags or description contain
+// every word of query, the last letters of a word may be missing. Titles weigh
+// the most, then tags, then descriptions.
+func (v *VideoService) SearchVideos(ctx context.Context, query string, statuses []models.VideoStatus, offset, limit int) (*SearchResults, error) {
+	tsquery := prefixQuery(query)
+	if tsquery == "" {
+		return nil, fmt.Errorf("%w: q has no words to search for", ErrInvalidSearch)
+	}
+	for _, s := range statuses {
+		if !videoStatuses[s] {
+			return nil, fmt.Errorf("%w: unknown status %s", ErrInvalidSearch, s)
+		}
+	}
+	hits, total, err := v.repo.Search(ctx, repository.VideoSearch{Query: tsquery, Statuses: statuses, Offset: offset, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	for i := range hits {
+		hits[i].Highlights.Title = highlight(hits[i].Highlights.Title)
+		hits[i].Highlights.Description = highlight(hits[i].Highlights.Description)
+	}
+	return &SearchResults{Items: hits, Total: total, Offset: offset, Limit: limit}, nil
+}
+
+// prefixQuery makes a tsquery matching every word of query as a prefix. Only
+// letters and digits are kept, nothing the user typed is tsquery syntax.
+func prefixQuery(query string) string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// highlight escapes a headline for HTML and turns its markers into <mark>
+func highlight(headline string) string {
+	s := html.EscapeString(headline)
+	s = strings.ReplaceAll(s, repository.HighlightStart, "<mark>")
+	return strings.ReplaceAll(s, repository.HighlightStop, "</mark>")
+}
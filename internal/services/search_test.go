@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/repository"
+)
+
+func TestPrefixQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"cats", "cats:*"},
+		{"Funny Cats", "funny:* & cats:*"},
+		{"  funny   cats  ", "funny:* & cats:*"},
+		{"cat's vlog #3", "cat:* & s:* & vlog:* & 3:*"},
+		{"über straße", "über:* & straße:*"},
+		// tsquery syntax is only ever a separator
+		{"cats & !dogs | (birds:*)", "cats:* & dogs:* & birds:*"},
+		{"a' <-> b", "a:* & b:*"},
+		{"", ""},
+		{"!&|():*", ""},
+		{"1 2 3 4 5 6 7 8 9 10 11 12", "1:* & 2:* & 3:* & 4:* & 5:* & 6:* & 7:* & 8:* & 9:* & 10:*"},
+	}
+	for _, tt := range tests {
+		if got := prefixQuery(tt.query); got != tt.want {
+			t.Errorf("prefixQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeMetadata(t *testing.T) {
+	meta, err := normalizeMetadata(models.VideoMetadata{
+		Title:       "  My trip\x00 ",
+		Description: "\tday one\nday two\x1b  ",
+		Tags:        []string{"Travel", " travel ", "", "  ", "Alps\x07"},
+	}, "trip.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Title != "My trip" {
+		t.Errorf("title = %q, want %q", meta.Title, "My trip")
+	}
+	if meta.Description != "day one\nday two" {
+		t.Errorf("description = %q, want %q", meta.Description, "day one\nday two")
+	}
+	if !slices.Equal(meta.Tags, []string{"travel", "alps"}) {
+		t.Errorf("tags = %q, want [travel alps]", meta.Tags)
+	}
+
+	meta, err = normalizeMetadata(models.VideoMetadata{Title: " \x02 "}, "holiday.final.mov")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Title != "holiday.final" {
+		t.Errorf("title of an untitled video = %q, want its filename", meta.Title)
+	}
+	if meta.Tags == nil {
+		t.Error("no tags came out as nil, the column takes an empty list")
+	}
+}
+
+func TestNormalizeMetadataLimits(t *testing.T) {
+	tags := func(n int) []string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = strings.Repeat("t", i+1)
+		}
+		return out
+	}
+	tests := []struct {
+		name string
+		meta models.VideoMetadata
+		ok   bool
+	}{
+		{"longest title", models.VideoMetadata{Title: strings.Repeat("é", maxTitleLength)}, true},
+		{"title too long", models.VideoMetadata{Title: strings.Repeat("a", maxTitleLength+1)}, false},
+		{"longest description", models.VideoMetadata{Description: strings.Repeat("é", maxDescriptionLength)}, true},
+		{"description too long", models.VideoMetadata{Description: strings.Repeat("a", maxDescriptionLength+1)}, false},
+		{"most tags", models.VideoMetadata{Tags: tags(maxTags)}, true},
+		{"too many tags", models.VideoMetadata{Tags: tags(maxTags + 1)}, false},
+		{"duplicates count once", models.VideoMetadata{Tags: append(tags(maxTags), "T", "TT")}, true},
+		{"longest tag", models.VideoMetadata{Tags: []string{strings.Repeat("é", maxTagLength)}}, true},
+		{"tag too long", models.VideoMetadata{Tags: []string{strings.Repeat("a", maxTagLength+1)}}, false},
+	}
+	for _, tt := range tests {
+		_, err := normalizeMetadata(tt.meta, "video.mp4")
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("%s: err = %v, want ErrInvalidMetadata", tt.name, err)
+		}
+	}
+}
+
+func TestMetadataPatchApply(t *testing.T) {
+	meta := models.VideoMetadata{Title: "old", Description: "kept", Tags: []string{"a"}}
+	title, tags := "new", []string{}
+	got := MetadataPatch{Title: &title, Tags: &tags}.apply(meta)
+	if got.Title != "new" || got.Description != "kept" || len(got.Tags) != 0 {
+		t.Errorf("apply = %+v, want the title replaced, the tags cleared and the description kept", got)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	start, stop := repository.HighlightStart, repository.HighlightStop
+	tests := []struct {
+		headline string
+		want     string
+	}{
+		{"no match", "no match"},
+		{"funny " + start + "cats" + stop, "funny <mark>cats</mark>"},
+		{start + "a" + stop + " & " + start + "b" + stop, "<mark>a</mark> &amp; <mark>b</mark>"},
+		// what was typed into the metadata is text, never markup
+		{`<script>alert("x")</script> ` + start + "cats" + stop, "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; <mark>cats</mark>"},
+		{"<mark>fake</mark>", "&lt;mark&gt;fake&lt;/mark&gt;"},
+	}
+	for _, tt := range tests {
+		if got := highlight(tt.headline); got != tt.want {
+			t.Errorf("highlight(%q) = %q, want %q", tt.headline, got, tt.want)
+		}
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"", nil},
+		{"cats", []string{"cats"}},
+		{" cats , dogs,,birds ,", []string{"cats", "dogs", "birds"}},
+		{" , ", nil},
+	}
+	for _, tt := range tests {
+		if got := ParseTags(tt.s); !slices.Equal(got, tt.want) {
+			t.Errorf("ParseTags(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/phash"
+)
+
+const (
+	// maxPHashDistance is how many bits the pHashes of two frames showing the
+	// same picture may differ in, re-encoding and scaling flip a few
+	maxPHashDistance = 10
+	// pHashBands is how many bands frames are indexed by, one more than the
+	// distance so that every frame within it shares a band with ours. Changing
+	// either needs the bands of stored frames recomputed, see migration 021.
+	pHashBands = maxPHashDistance + 1
+	// maxDHashDistance keeps frames with a similar spectrum but a different
+	// layout apart
+	maxDHashDistance = 10
+)
+
+// SaveFingerprints replaces the keyframe hashes of a video
+func (v *VideoService) SaveFingerprints(ctx context.Context, videoId string, prints []models.Fingerprint) error {
+	for i := range prints {
+		prints[i].Bands = phash.Bands(prints[i].PHash, pHashBands)
+	}
+	return v.tx.WithinTx(ctx, func(ctx context.Context) error {
+		return v.fingerprints.Replace(ctx, videoId, prints)
+	})
+}
+
+// SimilarVideos returns the videos sharing frames with a video, re-encoded
+// or trimmed copies of it, scoring at least minScore. A duplicate upload is
+// compared by the frames of its source.
+func (v *VideoService) SimilarVideos(ctx context.Context, id string, minScore float64, limit int) ([]models.SimilarVideo, error) {
+	video, err := v.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if video.SourceID != nil {
+		id = video.SourceID.String()
+	}
+	return v.fingerprints.Similar(ctx, id, maxPHashDistance, maxDHashDistance, minScore, limit)
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/cache"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	TusVersion    = "1.0.0"
+	TusMaxSize    = 10 << 30 // matches client_max_body_size in nginx.conf
+	tusPartSize   = 5 << 20  // smallest part S3 accepts, except for the last one
+	tusUploadTTL  = 24 * time.Hour
+	tusDefaultExt = ".mp4"
+	// uploadLockTTL is how long a crashed replica keeps an upload locked
+	uploadLockTTL  = 30 * time.Second
+	uploadLockPoll = 200 * time.Millisecond
+)
+
+var (
+	ErrUploadNotFound = errors.New("upload not found")
+	ErrOffsetMismatch = errors.New("upload offset does not match")
+	ErrUploadTooLarge = errors.New("upload length exceeds the maximum size")
+	ErrInvalidLength  = errors.New("upload length must be greater than zero")
+)
+
+// TusUpload is the state of a resumable upload, kept in the cache between requests.
+// Bytes that don't fill a whole part yet are parked in a pending object so that
+// the offset we report is always durable.
+type TusUpload struct {
+	ID          string               `json:"id"`
+	Filename    string               `json:"filename"`
+	Profile     string               `json:"profile,omitempty"`
+	Force       bool                 `json:"force,omitempty"`
+	Metadata    models.VideoMetadata `json:"metadata"`
+	Key         string               `json:"key"`
+	MultipartID string               `json:"multipartId"`
+	Length      int64                `json:"length"`
+	Offset      int64                `json:"offset"`
+	Pending     int64                `json:"pending"`
+	Parts       []storage.Part       `json:"parts"`
+	HashState   []byte               `json:"hashState"`
+	ExpiresAt   time.Time            `json:"expiresAt"`
+	Result      *UploadResult        `json:"result,omitempty"`
+}
+
+func (u *TusUpload) Completed() bool {
+	return u.Result != nil
+}
+
+func (v *VideoService) CreateTusUpload(ctx context.Context, length int64, filename, profile string, force bool, meta models.VideoMetadata) (*TusUpload, error) {
+	if length <= 0 {
+		return nil, ErrInvalidLength
+	}
+	if length > TusMaxSize {
+		return nil, ErrUploadTooLarge
+	}
+	if _, err := v.profiles.Get(profile); err != nil {
+		return nil, err
+	}
+
+	id := uuid.New()
+	ext := filepath.Ext(filename)
+	if ext == "" {
+		ext = tusDefaultExt
+	}
+	if filename == "" {
+		filename = "video" + ext
+	}
+	key := filepath.Join("originals", id.String(), "original"+ext)
+
+	multipartID, err := v.objStore.NewMultipartUpload(ctx, key, "video/"+ext[1:])
+	if err != nil {
+		return nil, err
+	}
+	hashState, err := sha256.New().(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	up := &TusUpload{
+		ID:          id.String(),
+		Filename:    filename,
+		Profile:     profile,
+		Force:       force,
+		Metadata:    meta,
+		Key:         key,
+		MultipartID: multipartID,
+		Length:      length,
+		HashState:   hashState,
+	}
+	if err := v.saveTusUpload(ctx, up); err != nil {
+		return nil, err
+	}
+	return up, nil
+}
+
+func (v *VideoService) GetTusUpload(ctx context.Context, id string) (*TusUpload, error) {
+	var up TusUpload
+	if err := v.cache.Get(ctx, cache.GetKey(cache.UPLOAD, id), &up); err != nil {
+		return nil, err
+	}
+	if up.ID == "" {
+		return nil, ErrUploadNotFound
+	}
+	return &up, nil
+}
+
+// WriteTusChunk appends the body of a PATCH request at offset. Every full part is
+// sent to the store as soon as it is read, so at most one part is held in memory.
+// Once the last byte lands the multipart upload is completed and the video is
+// registered for processing.
+func (v *VideoService) WriteTusChunk(ctx context.Context, id string, offset int64, r io.Reader) (*TusUpload, error) {
+	ctx, unlock, err := v.lockUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	up, err := v.GetTusUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != up.Offset {
+		return up, ErrOffsetMismatch
+	}
+
+	h := sha256.New()
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(up.HashState); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, tusPartSize)
+	filled := 0
+	if up.Pending > 0 {
+		pending, _, err := v.objStore.Get(ctx, v.pendingKey(id))
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.ReadFull(pending, buf[:up.Pending])
+		pending.Close()
+		if err != nil {
+			return nil, err
+		}
+		filled = int(up.Pending)
+	}
+
+	// keep whatever the client managed to send, even if the connection drops
+	body := io.LimitReader(r, up.Length-up.Offset)
+	var readErr error
+	for readErr == nil && up.Offset < up.Length {
+		var n int
+		n, readErr = io.ReadFull(body, buf[filled:])
+		h.Write(buf[filled : filled+n])
+		filled += n
+		up.Offset += int64(n)
+
+		if filled == len(buf) {
+			if err := v.putTusPart(ctx, up, buf); err != nil {
+				return nil, err
+			}
+			filled = 0
+		}
+	}
+	if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+		readErr = nil
+	}
+
+	hadPending := up.Pending > 0
+	if up.Offset == up.Length && up.MultipartID != "" {
+		if filled > 0 {
+			if err := v.putTusPart(ctx, up, buf[:filled]); err != nil {
+				return nil, err
+			}
+			filled = 0
+		}
+		if _, err := v.objStore.CompleteMultipartUpload(ctx, up.Key, up.MultipartID, up.Parts); err != nil {
+			return nil, err
+		}
+		up.MultipartID = ""
+	}
+	switch {
+	case filled > 0:
+		if _, err := v.objStore.Put(ctx, v.pendingKey(id), bytes.NewReader(buf[:filled]), int64(filled)); err != nil {
+			return nil, err
+		}
+	case hadPending:
+		if err := v.objStore.Delete(ctx, v.pendingKey(id)); err != nil {
+			return nil, err
+		}
+	}
+	up.Pending = int64(filled)
+
+	hashState, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	up.HashState = hashState
+	if err := v.saveTusUpload(ctx, up); err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return up, readErr
+	}
+
+	// the object is complete, register it (retried by a later PATCH if this fails)
+	if up.Offset == up.Length && !up.Completed() {
+		uid, err := uuid.Parse(up.ID)
+		if err != nil {
+			return nil, err
+		}
+		res, err := v.registerUpload(ctx, uid, up.Filename, up.Metadata, up.Profile, up.Key, hex.EncodeToString(h.Sum(nil)), up.Length, !up.Force)
+		if err != nil {
+			return nil, err
+		}
+		up.Result = res
+		if err := v.saveTusUpload(ctx, up); err != nil {
+			return nil, err
+		}
+	}
+	return up, nil
+}
+
+// TerminateTusUpload aborts an unfinished upload and forgets about it
+func (v *VideoService) TerminateTusUpload(ctx context.Context, id string) error {
+	ctx, unlock, err := v.lockUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	up, err := v.GetTusUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+	if up.MultipartID != "" {
+		if err := v.objStore.AbortMultipartUpload(ctx, up.Key, up.MultipartID); err != nil {
+			return err
+		}
+	}
+	if up.Pending > 0 {
+		if err := v.objStore.Delete(ctx, v.pendingKey(id)); err != nil {
+			return err
+		}
+	}
+	return v.cache.Delete(ctx, cache.GetKey(cache.UPLOAD, id))
+}
+
+func (v *VideoService) putTusPart(ctx context.Context, up *TusUpload, data []byte) error {
+	part, err := v.objStore.PutPart(ctx, up.Key, up.MultipartID, len(up.Parts)+1, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	up.Parts = append(up.Parts, part)
+	return nil
+}
+
+func (v *VideoService) saveTusUpload(ctx context.Context, up *TusUpload) error {
+	up.ExpiresAt = time.Now().Add(tusUploadTTL).UTC()
+	return v.cache.Set(ctx, cache.GetKey(cache.UPLOAD, up.ID), up, tusUploadTTL)
+}
+
+func (v *VideoService) pendingKey(id string) string {
+	return filepath.Join("uploads", id, "pending")
+}
+
+// lockUpload waits for the lease on an upload, which serializes the requests
+// for it across every api replica. The lease is renewed while it is held, the
+// returned ctx is cancelled if it is lost anyway so the caller stops writing.
+func (v *VideoService) lockUpload(ctx context.Context, id string) (context.Context, func(), error) {
+	key := cache.GetKey(cache.UPLOAD, id)
+	holder := uuid.NewString()
+	for {
+		ok, err := v.locks.Acquire(ctx, key, holder, uploadLockTTL)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(uploadLockPoll):
+		}
+	}
+
+	lctx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(uploadLockTTL / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-lctx.Done():
+				return
+			case <-t.C:
+				if ok, err := v.locks.Acquire(lctx, key, holder, uploadLockTTL); err != nil || !ok {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return lctx, func() {
+		cancel()
+		// a renewal in flight would take the lease again after the release
+		<-stopped
+		_ = v.locks.Release(context.WithoutCancel(ctx), key, holder)
+	}, nil
+}
@@ -1,10 +1,9 @@
 package services
 
 import (
-	"bytes"
 	"context"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -14,11 +13,14 @@ import (
 	"crypto/sha256"
 
 	"github.com/ak-ansari/mytube/internal/cache"
+	"github.com/ak-ansari/mytube/internal/encoding"
+	"github.com/ak-ansari/mytube/internal/events"
 	"github.com/ak-ansari/mytube/internal/jobs"
 	"github.com/ak-ansari/mytube/internal/models"
 	"github.com/ak-ansari/mytube/internal/queue"
 	"github.com/ak-ansari/mytube/internal/repository"
 	"github.com/ak-ansari/mytube/internal/storage"
+	"github.com/ak-ansari/mytube/internal/util"
 	"github.com/google/uuid"
 )
 
@@ -26,22 +28,55 @@ type UploadResult struct {
 	VideoId string `json:"videoId"`
 	Key     string `json:"key"`
 	Sha256  string `json:"sha256"`
+	// DuplicateOf is the video whose processed files this upload reuses
+	DuplicateOf string `json:"duplicateOf,omitempty"`
+}
+type VideoDetails struct {
+	*models.Video
+	// Progress is the percentage of the pipeline done, every step weighs the same
+	Progress float64           `json:"progress"`
+	Steps    []models.VideoJob `json:"steps"`
 }
 type VideoService struct {
-	objStore  storage.ObjectStore
-	repo      repository.VideoRepository
-	queue     queue.Queue
-	cache     cache.Cache
-	queueName string
+	objStore     storage.ObjectStore
+	repo         repository.VideoRepository
+	jobRepo      repository.JobRepository
+	webhooks     repository.WebhookRepository
+	outbox       repository.OutboxRepository
+	objects      repository.ObjectRepository
+	fingerprints repository.FingerprintRepository
+	locks        repository.LockRepository
+	tx           repository.Transactor
+	queue        queue.Queue
+	dlq          queue.DeadLetterQueue
+	cache        cache.Cache
+	queueName    string
+	pipeline     *jobs.Pipeline
+	profiles     *encoding.Profiles
+	bus          events.Bus
+	// allowPrivateWebhooks lets webhooks point inside the network
+	allowPrivateWebhooks bool
 }
 
-func NewVideoService(objStore storage.ObjectStore, repo repository.VideoRepository, queue queue.Queue, cache cache.Cache, queueName string) *VideoService {
+func NewVideoService(objStore storage.ObjectStore, repo repository.VideoRepository, jobRepo repository.JobRepository, webhooks repository.WebhookRepository, outbox repository.OutboxRepository, objects repository.ObjectRepository, fingerprints repository.FingerprintRepository, locks repository.LockRepository, tx repository.Transactor, queue queue.Queue, dlq queue.DeadLetterQueue, cache cache.Cache, queueName string, pipeline *jobs.Pipeline, profiles *encoding.Profiles, bus events.Bus, allowPrivateWebhooks bool) *VideoService {
 	return &VideoService{
-		objStore:  objStore,
-		queueName: queueName,
-		queue:     queue,
-		cache:     cache,
-		repo:      repo,
+		allowPrivateWebhooks: allowPrivateWebhooks,
+		bus:                  bus,
+		pipeline:             pipeline,
+		profiles:             profiles,
+		objStore:             objStore,
+		jobRepo:              jobRepo,
+		webhooks:             webhooks,
+		outbox:               outbox,
+		objects:              objects,
+		fingerprints:         fingerprints,
+		locks:                locks,
+		tx:                   tx,
+		queueName:            queueName,
+		queue:                queue,
+		dlq:                  dlq,
+		cache:                cache,
+		repo:                 repo,
 	}
 }
 func (v *VideoService) GetVideoKey(ctx context.Context, id string) (string, error) {
@@ -57,55 +92,147 @@ func (v *VideoService) GetVideoKey(ctx context.Context, id string) (string, erro
 	return video.OriginalObjectKey, v.cache.Set(ctx, cacheKey, video.OriginalObjectKey, 24*time.Hour)
 }
 
-func (v *VideoService) UploadVideo(ctx context.Context, file *multipart.FileHeader) (*UploadResult, error) {
+// UploadVideo stores and registers an uploaded file. Unless force is set, a file
+// that was already processed with the same profile reuses what was made of it.
+func (v *VideoService) UploadVideo(ctx context.Context, file *multipart.FileHeader, profile string, force bool, meta models.VideoMetadata) (*UploadResult, error) {
+	if _, err := v.profiles.Get(profile); err != nil {
+		return nil, err
+	}
 	f, err := file.Open()
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	buf := &bytes.Buffer{}
-	if _, err := io.Copy(buf, f); err != nil {
+
+	id := uuid.New()
+	ext := filepath.Ext(file.Filename)
+	key := filepath.Join("originals", id.String(), "original"+ext)
+
+	// stream the file to the store, hashing it on the way
+	h := sha256.New()
+	path, err := v.objStore.Put(ctx, key, io.TeeReader(f, h), file.Size)
+	if err != nil {
 		return nil, err
 	}
-	sum, err := v.CalculateChecksum(f)
+	res, err := v.registerUpload(ctx, id, file.Filename, meta, profile, path, hex.EncodeToString(h.Sum(nil)), file.Size, !force)
 	if err != nil {
+		// nothing refers to the original yet
+		_ = v.objStore.Delete(ctx, path)
 		return nil, err
 	}
-	id := uuid.New()
-	ext := filepath.Ext(file.Filename)
-	key := filepath.Join("originals", id.String(), "original"+ext)
+	return res, nil
+}
 
-	path, err := v.objStore.Put(ctx, key, buf, int64(buf.Len()))
+// registerUpload saves the meta of a stored original and queues its
+// validation, in one transaction through the outbox so that a video never
+// exists without its job. The metadata is normalized here, the upload paths
+// only pass it along. The encoding profile is copied onto the video as it is
+// now. With dedup, an original whose sum we computed ourselves is linked to a
+// ready video with the same content and profile instead, and the copy just
+// stored is dropped.
+func (v *VideoService) registerUpload(ctx context.Context, id uuid.UUID, filename string, meta models.VideoMetadata, profile, key, sum string, size int64, dedup bool) (*UploadResult, error) {
+	prof, err := v.profiles.Get(profile)
 	if err != nil {
 		return nil, err
 	}
-
-	// save meta in db
+	if meta, err = normalizeMetadata(meta, filename); err != nil {
+		return nil, err
+	}
 	vm := models.Video{
 		ID:                id,
-		Filename:          file.Filename,
-		OriginalObjectKey: path,
+		Filename:          filename,
+		VideoMetadata:     meta,
+		OriginalObjectKey: key,
+		SizeBytes:         &size,
 		Status:            models.StatusUploaded,
+		EncodingProfile:   &prof,
 	}
-	if err := v.repo.InsertBasic(ctx, vm); err != nil {
-		return nil, err
+	if sum != "" {
+		vm.SHA256 = &sum
 	}
-	payload, err := json.Marshal(jobs.JobPayload{VideoID: id.String(), Step: jobs.StepValidate})
+	var source *models.Video
+	err = v.tx.WithinTx(ctx, func(ctx context.Context) error {
+		source = nil
+		if dedup && sum != "" {
+			found, err := v.repo.FindSource(ctx, sum, prof)
+			if err == nil {
+				source = found
+				return v.linkDuplicate(ctx, vm, source)
+			}
+			if !errors.Is(err, repository.ErrNotFound) {
+				return err
+			}
+		}
+		if err := v.repo.InsertBasic(ctx, vm); err != nil {
+			return err
+		}
+		if err := v.notifyWebhooks(ctx, id.String(), models.StatusUploaded); err != nil {
+			return err
+		}
+		if err := v.publishStatus(ctx, id.String(), models.StatusUploaded); err != nil {
+			return err
+		}
+		return v.enqueueSteps(ctx, id.String(), v.pipeline.Roots())
+	})
 	if err != nil {
 		return nil, err
 	}
-	if err := v.queue.Enqueue(ctx, v.queueName, payload); err != nil {
-		return nil, err
+	res := &UploadResult{VideoId: id.String(), Key: key, Sha256: sum}
+	if source != nil {
+		// the video is registered, a copy left behind only wastes space
+		_ = v.objStore.Delete(ctx, key)
+		res.Key = source.OriginalObjectKey
+		res.DuplicateOf = source.ID.String()
 	}
-	cacheKey := cache.GetKey(cache.KEY, path)
-	if err := v.cache.Set(ctx, cacheKey, path, 24*time.Hour); err != nil {
+	cacheKey := cache.GetKey(cache.KEY, id.String())
+	if err := v.cache.Set(ctx, cacheKey, res.Key, 24*time.Hour); err != nil {
 		return nil, err
 	}
-	return &UploadResult{VideoId: id.String(), Key: path, Sha256: sum}, nil
+	return res, nil
 }
 func (v *VideoService) GetVideo(ctx context.Context, id string) (*models.Video, error) {
 	return v.repo.Get(ctx, id)
 }
+
+// GetVideoDetails returns the video together with the timeline of its pipeline steps
+func (v *VideoService) GetVideoDetails(ctx context.Context, id string) (*VideoDetails, error) {
+	video, err := v.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := v.jobRepo.ListByVideo(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &VideoDetails{Video: video, Progress: v.progress(steps), Steps: steps}, nil
+}
+
+// progress averages the jobs of every step of the pipeline, the variants of a
+// fanned out step count as parts of it
+func (v *VideoService) progress(jobs []models.VideoJob) float64 {
+	steps := v.pipeline.Steps()
+	if len(steps) == 0 {
+		return 0
+	}
+	done := map[string]float64{}
+	count := map[string]int{}
+	for _, j := range jobs {
+		count[j.Step]++
+		switch {
+		case j.Status == models.JobSucceeded:
+			done[j.Step] += 100
+		case j.Status == models.JobRunning && j.Progress != nil:
+			done[j.Step] += *j.Progress
+		}
+	}
+	total := 0.0
+	for _, step := range steps {
+		if n := count[string(step)]; n > 0 {
+			total += done[string(step)] / float64(n)
+		}
+	}
+	return total / float64(len(steps))
+}
 func (v *VideoService) GetDownloadUrl(ctx context.Context, key string) (string, error) {
 	cacheKey := cache.GetKey(cache.URL, key)
 	var cached string
@@ -121,20 +248,149 @@ func (v *VideoService) GetDownloadUrl(ctx context.Context, key string) (string,
 func (v *VideoService) DownloadVideo() string {
 	return "video is downloaded"
 }
-func (v *VideoService) UpdateMeta(ctx context.Context, videoId string, sha string, dur int, vcodec, acodec string, w, h int, status models.VideoStatus) error {
-	return v.repo.UpdateMeta(ctx, videoId, sha, dur, vcodec, acodec, w, h, status)
+func (v *VideoService) UpdateMeta(ctx context.Context, videoId string, sha string, dur int, vcodec, acodec string, w, h int, bitrate int64, status models.VideoStatus) error {
+	return v.changeStatus(ctx, videoId, status, func(ctx context.Context) error {
+		return v.repo.UpdateMeta(ctx, videoId, sha, dur, vcodec, acodec, w, h, bitrate, status)
+	})
 }
-func (v *VideoService) UpdateQualities(ctx context.Context, videoId string, qualities []string, status models.VideoStatus) error {
-	return v.repo.UpdateQualities(ctx, videoId, qualities, status)
+func (v *VideoService) UpdateQualities(ctx context.Context, videoId string, renditions []models.Rendition, status models.VideoStatus) error {
+	return v.changeStatus(ctx, videoId, status, func(ctx context.Context) error {
+		return v.repo.UpdateQualities(ctx, videoId, renditions, status)
+	})
 }
 func (v *VideoService) UpdateManifest(ctx context.Context, videoId string, manifest string) error {
 	return v.repo.UpdateManifest(ctx, videoId, manifest)
 }
+func (v *VideoService) UpdateDashManifest(ctx context.Context, videoId string, manifest string) error {
+	return v.repo.UpdateDashManifest(ctx, videoId, manifest)
+}
 func (v *VideoService) UpdateThumbnail(ctx context.Context, videoId string, thumbnailKey string) error {
 	return v.repo.UpdateThumbnail(ctx, videoId, thumbnailKey)
 }
 func (v *VideoService) UpdateStatus(ctx context.Context, videoId string, status models.VideoStatus) error {
-	return v.repo.UpdateStatus(ctx, videoId, status)
+	return v.changeStatus(ctx, videoId, status, func(ctx context.Context) error {
+		return v.repo.UpdateStatus(ctx, videoId, status)
+	})
+}
+func (v *VideoService) AddQuality(ctx context.Context, videoId string, rendition models.Rendition, status models.VideoStatus) error {
+	return v.changeStatus(ctx, videoId, status, func(ctx context.Context) error {
+		return v.repo.AddQuality(ctx, videoId, rendition, status)
+	})
+}
+func (v *VideoService) StartStep(ctx context.Context, p jobs.JobPayload, attempt, maxAttempts int) error {
+	return v.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := v.jobRepo.Start(ctx, p.VideoID, string(p.Step), p.Variant, attempt, maxAttempts); err != nil {
+			return err
+		}
+		return v.publish(ctx, stepEvent(events.TypeStepStarted, p, attempt))
+	})
+}
+func (v *VideoService) UpdateProgress(ctx context.Context, p jobs.JobPayload, percent, speed, fps float64) error {
+	return v.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := v.jobRepo.Progress(ctx, p.VideoID, string(p.Step), p.Variant, percent, speed, fps); err != nil {
+			return err
+		}
+		e := stepEvent(events.TypeProgress, p, 0)
+		e.Progress, e.Speed, e.FPS = percent, speed, fps
+		return v.publish(ctx, e)
+	})
+}
+func (v *VideoService) FailStep(ctx context.Context, p jobs.JobPayload, errMsg string, retryAt *time.Time) error {
+	return v.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := v.jobRepo.Fail(ctx, p.VideoID, string(p.Step), p.Variant, errMsg, retryAt); err != nil {
+			return err
+		}
+		e := stepEvent(events.TypeStepFailed, p, 0)
+		if retryAt != nil {
+			e.Type = events.TypeStepRetrying
+		}
+		e.Error = errMsg
+		return v.publish(ctx, e)
+	})
+}
+
+// Subscribe streams the events of a video until ctx is done
+func (v *VideoService) Subscribe(ctx context.Context, videoId string) (<-chan events.Event, error) {
+	return v.bus.Subscribe(ctx, videoId)
+}
+
+// changeStatus runs change, which leaves the video in status, and writes what
+// announces it, webhook deliveries and the status event, in the same transaction.
+// Webhooks only hear of a status the video was not already in: a retried step
+// setting it again would otherwise send the event a second time under a new id.
+func (v *VideoService) changeStatus(ctx context.Context, videoId string, status models.VideoStatus, change func(ctx context.Context) error) error {
+	return v.tx.WithinTx(ctx, func(ctx context.Context) error {
+		// concurrent changes queue up here, only the first sees the transition
+		if err := v.repo.Lock(ctx, videoId); err != nil {
+			return err
+		}
+		before, err := v.repo.Get(ctx, videoId)
+		if err != nil {
+			return err
+		}
+		if err := change(ctx); err != nil {
+			return err
+		}
+		if before.Status != status {
+			if err := v.notifyWebhooks(ctx, videoId, status); err != nil {
+				return err
+			}
+		}
+		return v.publishStatus(ctx, videoId, status)
+	})
+}
+
+func (v *VideoService) publishStatus(ctx context.Context, videoId string, status models.VideoStatus) error {
+	return v.publish(ctx, events.Event{Type: events.TypeStatus, VideoID: videoId, Status: string(status)})
+}
+
+func stepEvent(typ string, p jobs.JobPayload, attempt int) events.Event {
+	return events.Event{Type: typ, VideoID: p.VideoID, Step: string(p.Step), Variant: p.Variant, Attempt: attempt}
+}
+
+// Profile is the encoding profile video was uploaded with, videos from before
+// profiles existed keep the built in default
+func (v *VideoService) Profile(video *models.Video) encoding.Profile {
+	if video.EncodingProfile == nil {
+		return encoding.DefaultProfile
+	}
+	return *video.EncodingProfile
+}
+
+// Ladder is the set of renditions for video: the rungs of its profile that fit
+// its probed size and bitrate, once per codec of the profile. Renditions of the
+// primary codec keep the label of their rung, the others get the codec appended.
+func (v *VideoService) Ladder(video *models.Video) []util.Quality {
+	var w, h int
+	var bitrate int64
+	if video.Width != nil && video.Height != nil {
+		w, h = *video.Width, *video.Height
+	}
+	if video.BitrateBps != nil {
+		bitrate = *video.BitrateBps
+	}
+	profile := v.Profile(video)
+	rungs := util.Ladder(profile.Rungs, w, h, bitrate)
+	var ladder []util.Quality
+	for i, c := range profile.VideoCodecs() {
+		for _, q := range rungs {
+			q.Codec = c.Codec
+			if i > 0 {
+				q.Label += "-" + c.Codec
+			}
+			ladder = append(ladder, q)
+		}
+	}
+	return ladder
+}
+
+// RenditionExt is the container extension of a transcoded rendition. The
+// primary h264 renditions keep the one of the original, other codecs go in mp4.
+func (v *VideoService) RenditionExt(video *models.Video, q util.Quality) string {
+	if q.Codec == "" || q.Codec == encoding.CodecH264 {
+		return filepath.Ext(video.Filename)
+	}
+	return ".mp4"
 }
 func (v *VideoService) GetTranscodingPath(id string, quality string, ext string) string {
 	return filepath.Join("transcoded", id, fmt.Sprintf("%s%s", quality, ext))
@@ -142,6 +398,11 @@ func (v *VideoService) GetTranscodingPath(id string, quality string, ext string)
 func (v *VideoService) GetHlsDir(id string) string {
 	return filepath.Join("segments", id)
 }
+
+// GetDashDir keeps the DASH files apart from the HLS ones under the same prefix
+func (v *VideoService) GetDashDir(id string) string {
+	return filepath.Join(v.GetHlsDir(id), "dash")
+}
 func (v *VideoService) CalculateChecksum(f io.Reader) (string, error) {
 	hash := sha256.New()
 	if _, err := io.Copy(hash, f); err != nil {
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/repository"
+	"github.com/ak-ansari/mytube/internal/webhooks"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// webhookEvents are the video statuses webhooks hear about
+var webhookEvents = map[models.VideoStatus]string{
+	models.StatusUploaded: webhooks.EventUploaded,
+	models.StatusValid:    webhooks.EventValid,
+	models.StatusReady:    webhooks.EventReady,
+	models.StatusFailed:   webhooks.EventFailed,
+}
+
+// CreatedWebhook is a new webhook together with its secret, which is not shown again
+type CreatedWebhook struct {
+	*models.Webhook
+	Secret string `json:"secret"`
+}
+
+type WebhookDeliveryList struct {
+	Items  []models.WebhookDelivery `json:"items"`
+	Total  int                      `json:"total"`
+	Offset int                      `json:"offset"`
+	Limit  int                      `json:"limit"`
+}
+
+// WebhookDeliveryDetails is a delivery with every attempt made for it
+type WebhookDeliveryDetails struct {
+	*models.WebhookDelivery
+	Attempts []models.WebhookAttempt `json:"attempt_log"`
+}
+
+// CreateWebhook registers rawUrl for events, all of them when empty. A secret
+// is generated when none is given. Urls pointing inside the network are refused
+// unless private webhooks are allowed.
+func (v *VideoService) CreateWebhook(ctx context.Context, rawUrl string, events []string, secret string) (*CreatedWebhook, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an absolute http(s) url", ErrInvalidWebhook)
+	}
+	if !v.allowPrivateWebhooks {
+		if err := webhooks.CheckHost(u.Hostname()); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidWebhook, err)
+		}
+	}
+	for _, e := range events {
+		if !slices.Contains(webhooks.Events, e) {
+			return nil, fmt.Errorf("%w: unknown event %s", ErrInvalidWebhook, e)
+		}
+	}
+	if secret == "" {
+		if secret, err = webhooks.NewSecret(); err != nil {
+			return nil, err
+		}
+	}
+	if events == nil {
+		events = []string{}
+	}
+	w := models.Webhook{
+		ID:     uuid.New(),
+		URL:    u.String(),
+		Secret: secret,
+		Events: events,
+		Active: true,
+	}
+	if err := v.webhooks.Create(ctx, w); err != nil {
+		return nil, err
+	}
+	created, err := v.webhooks.Get(ctx, w.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	return &CreatedWebhook{Webhook: created, Secret: secret}, nil
+}
+
+func (v *VideoService) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	return v.webhooks.List(ctx)
+}
+
+func (v *VideoService) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	return v.webhooks.Get(ctx, id)
+}
+
+// DeleteWebhook removes the webhook and its deliveries, pending ones are not sent
+func (v *VideoService) DeleteWebhook(ctx context.Context, id string) error {
+	return v.webhooks.Delete(ctx, id)
+}
+
+func (v *VideoService) ListWebhookDeliveries(ctx context.Context, webhookId string, offset, limit int) (*WebhookDeliveryList, error) {
+	if _, err := v.webhooks.Get(ctx, webhookId); err != nil {
+		return nil, err
+	}
+	items, total, err := v.webhooks.ListDeliveries(ctx, webhookId, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookDeliveryList{Items: items, Total: total, Offset: offset, Limit: limit}, nil
+}
+
+func (v *VideoService) GetWebhookDelivery(ctx context.Context, webhookId, deliveryId string) (*WebhookDeliveryDetails, error) {
+	d, err := v.webhookDelivery(ctx, webhookId, deliveryId)
+	if err != nil {
+		return nil, err
+	}
+	attempts, err := v.webhooks.ListAttempts(ctx, deliveryId)
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookDeliveryDetails{WebhookDelivery: d, Attempts: attempts}, nil
+}
+
+// ReplayWebhookDelivery sends the event of a delivery again as a new delivery,
+// whatever became of the first one. The payload, event id included, is unchanged.
+func (v *VideoService) ReplayWebhookDelivery(ctx context.Context, webhookId, deliveryId string) (*models.WebhookDelivery, error) {
+	d, err := v.webhookDelivery(ctx, webhookId, deliveryId)
+	if err != nil {
+		return nil, err
+	}
+	replay := models.WebhookDelivery{
+		ID:        uuid.New(),
+		WebhookID: d.WebhookID,
+		EventID:   d.EventID,
+		EventType: d.EventType,
+		VideoID:   d.VideoID,
+		Payload:   d.Payload,
+		Status:    models.DeliveryPending,
+		ReplayOf:  &d.ID,
+	}
+	if err := v.webhooks.InsertDelivery(ctx, replay); err != nil {
+		return nil, err
+	}
+	return v.webhooks.GetDelivery(ctx, replay.ID.String())
+}
+
+// webhookDelivery returns the delivery if it belongs to the webhook
+func (v *VideoService) webhookDelivery(ctx context.Context, webhookId, deliveryId string) (*models.WebhookDelivery, error) {
+	d, err := v.webhooks.GetDelivery(ctx, deliveryId)
+	if err != nil {
+		return nil, err
+	}
+	if d.WebhookID.String() != webhookId {
+		return nil, repository.ErrNotFound
+	}
+	return d, nil
+}
+
+// ClaimWebhookDelivery leases the next delivery that is due and returns it with
+// its webhook, nil when nothing is due
+func (v *VideoService) ClaimWebhookDelivery(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, *models.Webhook, error) {
+	d, err := v.webhooks.ClaimDelivery(ctx, lease)
+	if err != nil || d == nil {
+		return nil, nil, err
+	}
+	w, err := v.webhooks.Get(ctx, d.WebhookID.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	return d, w, nil
+}
+
+func (v *VideoService) RecordWebhookAttempt(ctx context.Context, a models.WebhookAttempt, status models.DeliveryStatus, retryAt time.Time) error {
+	return v.webhooks.RecordAttempt(ctx, a, status, retryAt)
+}
+
+// notifyWebhooks queues a delivery of the event of status to every webhook that
+// wants it. It joins the caller's transaction so the event is only sent if the
+// status change is committed.
+func (v *VideoService) notifyWebhooks(ctx context.Context, videoId string, status models.VideoStatus) error {
+	eventType, ok := webhookEvents[status]
+	if !ok {
+		return nil
+	}
+	hooks, err := v.webhooks.Subscribed(ctx, eventType)
+	if err != nil || len(hooks) == 0 {
+		return err
+	}
+	video, err := v.repo.Get(ctx, videoId)
+	if err != nil {
+		return err
+	}
+	eventID := uuid.New()
+	body, err := json.Marshal(webhooks.Payload{
+		ID:        eventID.String(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      video,
+	})
+	if err != nil {
+		return err
+	}
+	for _, w := range hooks {
+		d := models.WebhookDelivery{
+			ID:        uuid.New(),
+			WebhookID: w.ID,
+			EventID:   eventID,
+			EventType: eventType,
+			VideoID:   &video.ID,
+			Payload:   body,
+			Status:    models.DeliveryPending,
+		}
+		if err := v.webhooks.InsertDelivery(ctx, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/config"
+	"github.com/ak-ansari/mytube/internal/pkg/logger"
+)
+
+// multipartDir holds the parts of uploads that haven't been completed yet
+const multipartDir = ".multipart"
+
+var ErrInvalidKey = errors.New("invalid object key")
+
+const defaultRoot = "./data"
+
+// FSStore keeps objects as files under a root directory. With a signer its urls
+// are signed http urls served by the api, otherwise file:// urls, which ffmpeg
+// reads like any other as long as it runs on the same host.
+type FSStore struct {
+	root   string
+	signer *URLSigner
+	log    logger.Logger
+}
+
+// NewLocalStore builds the store from the STORAGE config, PUBLIC_URL turns on signed urls
+func NewLocalStore(conf config.Storage, log logger.Logger) (*FSStore, error) {
+	var signer *URLSigner
+	if conf.PublicUrl != "" {
+		if conf.SigningKey == "" {
+			return nil, errors.New("STORAGE.SIGNING_KEY is required with STORAGE.PUBLIC_URL")
+		}
+		signer = NewURLSigner(conf.SigningKey, conf.PublicUrl, conf.UrlExpiry)
+	}
+	root := conf.Root
+	if root == "" {
+		root = defaultRoot
+	}
+	return NewFSStore(root, signer, log)
+}
+
+func NewFSStore(root string, signer *URLSigner, log logger.Logger) (*FSStore, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(abs, multipartDir), 0o755); err != nil {
+		return nil, err
+	}
+	log.Info("Using local object store", logger.String("root", abs))
+	return &FSStore{root: abs, signer: signer, log: log}, nil
+}
+
+// Signer is nil when the store hands out file:// urls
+func (fs *FSStore) Signer() *URLSigner {
+	return fs.signer
+}
+
+func (fs *FSStore) Put(ctx context.Context, key string, file io.Reader, size int64) (string, error) {
+	p, err := fs.path(key)
+	if err != nil {
+		return "", err
+	}
+	n, err := writeFile(p, file)
+	if err != nil {
+		fs.log.Error("Failed to put object",
+			logger.String("key", key),
+			logger.Error(err))
+		return "", err
+	}
+	if size >= 0 && n != size {
+		os.Remove(p)
+		return "", fmt.Errorf("put %s: wrote %d bytes, expected %d", key, n, size)
+	}
+	return key, nil
+}
+
+func (fs *FSStore) Get(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	p, err := fs.path(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		fs.log.Error("Failed to get object",
+			logger.String("key", key),
+			logger.Error(err))
+		return nil, 0, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, st.Size(), nil
+}
+
+func (fs *FSStore) Delete(ctx context.Context, key string) error {
+	p, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		fs.log.Error("Failed to delete object",
+			logger.String("key", key),
+			logger.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (fs *FSStore) GetUrl(ctx context.Context, key string) (string, error) {
+	p, err := fs.path(key)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(p); err != nil {
+		return "", err
+	}
+	if fs.signer != nil {
+		return fs.signer.Sign(http.MethodGet, key, 0, nil), nil
+	}
+	return fileUrl(p), nil
+}
+
+// Open returns the file behind key for serving it, callers close it
+func (fs *FSStore) Open(key string) (*os.File, error) {
+	p, err := fs.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (fs *FSStore) SaveLocally(ctx context.Context, key string, localPath string) error {
+	p, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err := writeFile(localPath, src); err != nil {
+		fs.log.Error("Failed to save object locally",
+			logger.String("key", key),
+			logger.String("path", localPath),
+			logger.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (fs *FSStore) UploadLocalFile(ctx context.Context, key string, localPath string, contentType string) (string, error) {
+	src, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	return fs.Put(ctx, key, src, -1)
+}
+
+func (fs *FSStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	p, err := fs.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	st, err := os.Stat(p)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         st.Size(),
+		ETag:         fmt.Sprintf("%x-%x", st.ModTime().UnixNano(), st.Size()),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		LastModified: st.ModTime().UTC(),
+	}, nil
+}
+
+// NewMultipartUpload only reserves a directory, parts are written there and
+// concatenated on completion
+func (fs *FSStore) NewMultipartUpload(ctx context.Context, key string, contentType string) (string, error) {
+	if _, err := fs.path(key); err != nil {
+		return "", err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	uploadID := hex.EncodeToString(b)
+	if err := os.MkdirAll(fs.uploadDir(uploadID), 0o755); err != nil {
+		return "", err
+	}
+	return uploadID, nil
+}
+
+func (fs *FSStore) PutPart(ctx context.Context, key string, uploadID string, number int, part io.Reader, size int64) (Part, error) {
+	if _, err := os.Stat(fs.uploadDir(uploadID)); err != nil {
+		return Part{}, err
+	}
+	h := md5.New()
+	n, err := writeFile(fs.partPath(uploadID, number), io.TeeReader(part, h))
+	if err != nil {
+		fs.log.Error("Failed to upload part",
+			logger.String("key", key),
+			logger.Int("part", number),
+			logger.Error(err))
+		return Part{}, err
+	}
+	if size >= 0 && n != size {
+		return Part{}, fmt.Errorf("part %d: wrote %d bytes, expected %d", number, n, size)
+	}
+	return Part{Number: number, ETag: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+func (fs *FSStore) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []Part) (string, error) {
+	readers := make([]io.Reader, 0, len(parts))
+	for _, p := range parts {
+		f, err := os.Open(fs.partPath(uploadID, p.Number))
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	if _, err := fs.Put(ctx, key, io.MultiReader(readers...), -1); err != nil {
+		return "", err
+	}
+	if err := os.RemoveAll(fs.uploadDir(uploadID)); err != nil {
+		fs.log.Warn("Failed to clean up multipart upload",
+			logger.String("uploadId", uploadID),
+			logger.Error(err))
+	}
+	return key, nil
+}
+
+func (fs *FSStore) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	return os.RemoveAll(fs.uploadDir(uploadID))
+}
+
+// PresignPut returns a signed url the api accepts a PUT on, or without a signer
+// the url of the file the object will be written to
+func (fs *FSStore) PresignPut(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	p, err := fs.path(key)
+	if err != nil {
+		return "", err
+	}
+	if fs.signer != nil {
+		return fs.signer.Sign(http.MethodPut, key, expiry, nil), nil
+	}
+	return fileUrl(p), nil
+}
+
+func (fs *FSStore) PresignPart(ctx context.Context, key string, uploadID string, number int, expiry time.Duration) (string, error) {
+	if fs.signer != nil {
+		query := url.Values{}
+		query.Set("partNumber", strconv.Itoa(number))
+		query.Set("uploadId", uploadID)
+		return fs.signer.Sign(http.MethodPut, key, expiry, query), nil
+	}
+	return fileUrl(fs.partPath(uploadID, number)), nil
+}
+
+// path maps key to a file under root, keys can't climb out of it
+func (fs *FSStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || clean == "/"+multipartDir || strings.HasPrefix(clean, "/"+multipartDir+"/") {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(fs.root, filepath.FromSlash(clean)), nil
+}
+
+func (fs *FSStore) uploadDir(uploadID string) string {
+	return filepath.Join(fs.root, multipartDir, filepath.Base(uploadID))
+}
+
+func (fs *FSStore) partPath(uploadID string, number int) string {
+	return filepath.Join(fs.uploadDir(uploadID), strconv.Itoa(number))
+}
+
+// writeFile writes r to a temp file next to p and renames it into place, so
+// readers never see a partial object
+func writeFile(p string, r io.Reader) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return n, err
+	}
+	if err := tmp.Close(); err != nil {
+		return n, err
+	}
+	return n, os.Rename(tmp.Name(), p)
+}
+
+func fileUrl(p string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(p)}).String()
+}
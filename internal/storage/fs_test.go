@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ak-ansari/mytube/internal/pkg/logger"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...logger.Field)   {}
+func (nopLogger) Info(string, ...logger.Field)    {}
+func (nopLogger) Success(string, ...logger.Field) {}
+func (nopLogger) Warn(string, ...logger.Field)    {}
+func (nopLogger) Error(string, ...logger.Field)   {}
+func (nopLogger) Fatal(string, ...logger.Field)   {}
+func (nopLogger) Flush()                          {}
+
+func newTestStore(t *testing.T) *FSStore {
+	t.Helper()
+	fs, err := NewFSStore(t.TempDir(), nil, nopLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestFSStorePutGetDelete(t *testing.T) {
+	ctx := context.Background()
+	fs := newTestStore(t)
+
+	data := []byte("some video bytes")
+	key, err := fs.Put(ctx, "originals/a/original.mp4", bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, size, err := fs.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(data)) || !bytes.Equal(got, data) {
+		t.Fatalf("Get = %q (%d bytes), want %q", got, size, data)
+	}
+
+	info, err := fs.Stat(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(data)) || info.ContentType != "video/mp4" {
+		t.Fatalf("Stat = %+v", info)
+	}
+
+	if err := fs.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := fs.Get(ctx, key); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Get after Delete: err = %v, want os.ErrNotExist", err)
+	}
+	// deleting what isn't there is not an error
+	if err := fs.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFSStorePutSizeMismatch(t *testing.T) {
+	ctx := context.Background()
+	fs := newTestStore(t)
+
+	if _, err := fs.Put(ctx, "short", strings.NewReader("abc"), 10); err == nil {
+		t.Fatal("Put of fewer bytes than the size: want an error")
+	}
+	if _, err := fs.Stat(ctx, "short"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("a short Put left an object behind: err = %v", err)
+	}
+}
+
+func TestFSStoreKeysStayUnderRoot(t *testing.T) {
+	fs := newTestStore(t)
+	for _, key := range []string{"", "/", multipartDir, multipartDir + "/x/1"} {
+		if _, err := fs.path(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("path(%q): err = %v, want ErrInvalidKey", key, err)
+		}
+	}
+	p, err := fs.path("../../etc/passwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(p, fs.root+string(os.PathSeparator)) {
+		t.Fatalf("path(../../etc/passwd) = %s, outside of %s", p, fs.root)
+	}
+}
+
+func TestFSStoreMultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	fs := newTestStore(t)
+
+	uploadID, err := fs.NewMultipartUpload(ctx, "big", "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := []string{"first-", "second-", "third"}
+	parts := make([]Part, len(chunks))
+	// parts can be uploaded in any order, completion joins them in the order given
+	for _, i := range []int{2, 0, 1} {
+		part, err := fs.PutPart(ctx, "big", uploadID, i+1, strings.NewReader(chunks[i]), int64(len(chunks[i])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[i] = part
+	}
+	if _, err := fs.CompleteMultipartUpload(ctx, "big", uploadID, parts); err != nil {
+		t.Fatal(err)
+	}
+
+	r, _, err := fs.Get(ctx, "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, _ := io.ReadAll(r)
+	if string(got) != strings.Join(chunks, "") {
+		t.Fatalf("completed object = %q", got)
+	}
+	if _, err := os.Stat(fs.uploadDir(uploadID)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("parts left behind after completion: err = %v", err)
+	}
+}
+
+func TestFSStoreAbortMultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	fs := newTestStore(t)
+
+	uploadID, err := fs.NewMultipartUpload(ctx, "aborted", "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.PutPart(ctx, "aborted", uploadID, 1, strings.NewReader("x"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.AbortMultipartUpload(ctx, "aborted", uploadID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.PutPart(ctx, "aborted", uploadID, 2, strings.NewReader("y"), 1); err == nil {
+		t.Fatal("PutPart after abort: want an error")
+	}
+}
@@ -2,7 +2,12 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/ak-ansari/mytube/internal/config"
@@ -13,6 +18,7 @@ import (
 
 type S3Store struct {
 	client *minio.Client
+	core   *minio.Core
 	bucket string
 	log    logger.Logger // use your interface, not *zap.Logger directly
 }
@@ -57,6 +63,7 @@ func NewS3Store(log logger.Logger) (*S3Store, error) {
 
 	s3 := &S3Store{
 		client: client,
+		core:   &minio.Core{Client: client},
 		bucket: s3Conf.MinioBucket,
 		log:    log,
 	}
@@ -77,7 +84,7 @@ func (s3 *S3Store) Put(ctx context.Context, key string, file io.Reader, size int
 	return res.Key, nil
 }
 
-func (s3 *S3Store) Get(ctx context.Context, key string) (io.Reader, int64, error) {
+func (s3 *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, int64, error) {
 	obj, err := s3.client.GetObject(ctx, s3.bucket, key, minio.GetObjectOptions{})
 	if err != nil {
 		s3.log.Error("Failed to get object",
@@ -88,10 +95,11 @@ func (s3 *S3Store) Get(ctx context.Context, key string) (io.Reader, int64, error
 
 	st, err := obj.Stat()
 	if err != nil {
+		obj.Close()
 		s3.log.Error("Failed to stat object",
 			logger.String("key", key),
 			logger.Error(err))
-		return nil, 0, err
+		return nil, 0, notExist(err)
 	}
 
 	s3.log.Success("Object retrieved successfully",
@@ -158,3 +166,112 @@ func (s3 *S3Store) UploadLocalFile(ctx context.Context, key string, path string,
 		logger.Int64("size", i.Size))
 	return i.Key, nil
 }
+
+func (s3 *S3Store) NewMultipartUpload(ctx context.Context, key string, contentType string) (string, error) {
+	options := minio.PutObjectOptions{}
+	if contentType != "" {
+		options.ContentType = contentType
+	}
+
+	uploadID, err := s3.core.NewMultipartUpload(ctx, s3.bucket, key, options)
+	if err != nil {
+		s3.log.Error("Failed to start multipart upload",
+			logger.String("key", key),
+			logger.Error(err))
+		return "", err
+	}
+	return uploadID, nil
+}
+
+func (s3 *S3Store) PutPart(ctx context.Context, key string, uploadID string, number int, part io.Reader, size int64) (Part, error) {
+	p, err := s3.core.PutObjectPart(ctx, s3.bucket, key, uploadID, number, part, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		s3.log.Error("Failed to upload part",
+			logger.String("key", key),
+			logger.Int("part", number),
+			logger.Error(err))
+		return Part{}, err
+	}
+	return Part{Number: p.PartNumber, ETag: p.ETag}, nil
+}
+
+func (s3 *S3Store) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []Part) (string, error) {
+	completed := make([]minio.CompletePart, 0, len(parts))
+	for _, p := range parts {
+		completed = append(completed, minio.CompletePart{PartNumber: p.Number, ETag: p.ETag})
+	}
+
+	i, err := s3.core.CompleteMultipartUpload(ctx, s3.bucket, key, uploadID, completed, minio.PutObjectOptions{})
+	if err != nil {
+		s3.log.Error("Failed to complete multipart upload",
+			logger.String("key", key),
+			logger.Error(err))
+		return "", err
+	}
+	s3.log.Success("Multipart upload completed",
+		logger.String("key", i.Key),
+		logger.Int("parts", len(parts)))
+	return i.Key, nil
+}
+
+func (s3 *S3Store) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	if err := s3.core.AbortMultipartUpload(ctx, s3.bucket, key, uploadID); err != nil {
+		s3.log.Error("Failed to abort multipart upload",
+			logger.String("key", key),
+			logger.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s3 *S3Store) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	st, err := s3.client.StatObject(ctx, s3.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		s3.log.Error("Failed to stat object",
+			logger.String("key", key),
+			logger.Error(err))
+		return ObjectInfo{}, notExist(err)
+	}
+	return ObjectInfo{
+		Key:          st.Key,
+		Size:         st.Size,
+		ETag:         st.ETag,
+		ContentType:  st.ContentType,
+		LastModified: st.LastModified,
+	}, nil
+}
+
+func (s3 *S3Store) PresignPut(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s3.client.PresignedPutObject(ctx, s3.bucket, key, expiry)
+	if err != nil {
+		s3.log.Error("Failed to generate presigned PUT URL",
+			logger.String("key", key),
+			logger.Error(err))
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (s3 *S3Store) PresignPart(ctx context.Context, key string, uploadID string, number int, expiry time.Duration) (string, error) {
+	params := url.Values{}
+	params.Set("partNumber", strconv.Itoa(number))
+	params.Set("uploadId", uploadID)
+
+	u, err := s3.client.Presign(ctx, http.MethodPut, s3.bucket, key, expiry, params)
+	if err != nil {
+		s3.log.Error("Failed to generate presigned part URL",
+			logger.String("key", key),
+			logger.Int("part", number),
+			logger.Error(err))
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// notExist makes a missing key match os.ErrNotExist, like the local store's errors
+func notExist(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %w", os.ErrNotExist, err)
+	}
+	return err
+}
@@ -2,14 +2,62 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/config"
+	"github.com/ak-ansari/mytube/internal/pkg/logger"
+)
+
+const (
+	BackendS3    = "s3"
+	BackendLocal = "local"
 )
 
+// Part identifies one uploaded chunk of a multipart upload
+type Part struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+}
+
+// ObjectInfo is what the store knows about a stored object
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	ContentType  string    `json:"contentType"`
+	LastModified time.Time `json:"lastModified"`
+}
+
 type ObjectStore interface {
 	Put(ctx context.Context, key string, file io.Reader, size int64) (string, error)
-	Get(ctx context.Context, key string) (io.Reader, int64, error)
+	// Get opens the object for reading, callers close it
+	Get(ctx context.Context, key string) (io.ReadCloser, int64, error)
 	Delete(ctx context.Context, key string) error
 	GetUrl(ctx context.Context, key string) (string, error)
 	SaveLocally(ctx context.Context, key string, path string) error
 	UploadLocalFile(ctx context.Context, key string, path string, mediaType string) (string, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+
+	// multipart uploads, used for resumable uploads
+	NewMultipartUpload(ctx context.Context, key string, contentType string) (string, error)
+	PutPart(ctx context.Context, key string, uploadID string, number int, part io.Reader, size int64) (Part, error)
+	CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []Part) (string, error)
+	AbortMultipartUpload(ctx context.Context, key string, uploadID string) error
+
+	// presigned urls let clients upload straight to the bucket
+	PresignPut(ctx context.Context, key string, expiry time.Duration) (string, error)
+	PresignPart(ctx context.Context, key string, uploadID string, number int, expiry time.Duration) (string, error)
+}
+
+// NewObjectStore builds the store selected by STORAGE.BACKEND, s3 when it isn't set
+func NewObjectStore(conf *config.Config, log logger.Logger) (ObjectStore, error) {
+	switch conf.Storage.Backend {
+	case "", BackendS3:
+		return NewS3Store(log)
+	case BackendLocal:
+		return NewLocalStore(conf.Storage, log)
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", conf.Storage.Backend)
 }
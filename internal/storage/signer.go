@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ObjectsPath is where the api serves the local store
+	ObjectsPath = "/objects"
+
+	defaultUrlExpiry = 12 * time.Hour
+)
+
+var (
+	ErrUrlExpired       = errors.New("url has expired")
+	ErrInvalidSignature = errors.New("invalid url signature")
+)
+
+// manifests are signed for their whole directory, players resolve the segments
+// relative to the manifest url and have no way to sign them on their own
+var manifestExts = map[string]bool{".m3u8": true, ".mpd": true}
+
+// URLSigner makes and checks the expiring urls the local store hands out. They
+// look like <base>/objects/<expires>/<signature>/<key>, the signature being an
+// HMAC-SHA256 of the method, the signed scope, the expiry and the query.
+type URLSigner struct {
+	secret  []byte
+	baseUrl string
+	expiry  time.Duration
+}
+
+func NewURLSigner(secret, baseUrl string, expiry time.Duration) *URLSigner {
+	if expiry <= 0 {
+		expiry = defaultUrlExpiry
+	}
+	return &URLSigner{
+		secret:  []byte(secret),
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		expiry:  expiry,
+	}
+}
+
+// Sign returns a url for method on key that is good for expiry, or the
+// signer's default when expiry is 0
+func (s *URLSigner) Sign(method, key string, expiry time.Duration, query url.Values) string {
+	if expiry <= 0 {
+		expiry = s.expiry
+	}
+	key = strings.TrimPrefix(path.Clean("/"+key), "/")
+	scope := key
+	if method == http.MethodGet && manifestExts[path.Ext(key)] {
+		scope = path.Dir(key) + "/"
+	}
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	u := s.baseUrl + ObjectsPath + "/" + expires + "/" + s.mac(method, scope, expires, query) + "/" + strings.Join(segments, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// Verify checks a request for key against the expiry and signature taken from
+// its url. A signature made for a manifest's directory covers everything in it.
+func (s *URLSigner) Verify(method, key, expires, signature string, query url.Values) error {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if time.Now().Unix() > exp {
+		return ErrUrlExpired
+	}
+	// a HEAD is allowed wherever a GET is
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+
+	key = strings.TrimPrefix(path.Clean("/"+key), "/")
+	scopes := []string{key}
+	if method == http.MethodGet {
+		for dir := path.Dir(key); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			scopes = append(scopes, dir+"/")
+		}
+	}
+	for _, scope := range scopes {
+		if hmac.Equal([]byte(signature), []byte(s.mac(method, scope, expires, query))) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func (s *URLSigner) mac(method, scope, expires string, query url.Values) string {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(method + "\n" + scope + "\n" + expires + "\n" + query.Encode()))
+	return hex.EncodeToString(h.Sum(nil))
+}
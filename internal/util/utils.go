@@ -1,20 +1,38 @@
 package util
 
+import "fmt"
+
 type Quality struct {
-	Height    int
-	Width     int
-	Label     string
-	Bandwidth int
+	Height    int    `json:"height"`
+	Width     int    `json:"width"`
+	Label     string `json:"label"`
+	Bandwidth int    `json:"bandwidth"`
+	// MaxBitrate and BufSize bound the encoder's rate, 0 leaves them to it
+	MaxBitrate int `json:"maxBitrate,omitempty"`
+	BufSize    int `json:"bufSize,omitempty"`
+	// Codec is set on the renditions of a video, empty on the rungs they come from
+	Codec string `json:"codec,omitempty"`
 }
 
+// Sizes are the rungs of the ladder for a 16:9 landscape source, Height being
+// the short side the label is named after
 var Sizes = []Quality{
-	{Label: "240p", Bandwidth: 400_000, Width: 426, Height: 240},      // ~0.4 Mbps
-	{Label: "360p", Bandwidth: 800_000, Width: 640, Height: 360},      // ~0.8 Mbps
-	{Label: "480p", Bandwidth: 1_400_000, Width: 854, Height: 480},    // ~1.4 Mbps
-	{Label: "720p", Bandwidth: 2_800_000, Width: 1280, Height: 720},   // ~2.8 Mbps
-	{Label: "1080p", Bandwidth: 5_000_000, Width: 1920, Height: 1080}, // ~5 Mbps
+	{Label: "240p", Bandwidth: 400_000, Width: 426, Height: 240},       // ~0.4 Mbps
+	{Label: "360p", Bandwidth: 800_000, Width: 640, Height: 360},       // ~0.8 Mbps
+	{Label: "480p", Bandwidth: 1_400_000, Width: 854, Height: 480},     // ~1.4 Mbps
+	{Label: "720p", Bandwidth: 2_800_000, Width: 1280, Height: 720},    // ~2.8 Mbps
+	{Label: "1080p", Bandwidth: 5_000_000, Width: 1920, Height: 1080},  // ~5 Mbps
+	{Label: "1440p", Bandwidth: 9_000_000, Width: 2560, Height: 1440},  // ~9 Mbps
+	{Label: "2160p", Bandwidth: 16_000_000, Width: 3840, Height: 2160}, // ~16 Mbps
 }
 
+// defaultMaxHeight caps the ladder when the source size isn't known
+const defaultMaxHeight = 1080
+
+// rungTolerance lets a rung through when the source is a few lines short of it,
+// e.g. 1280x718; the rung is then encoded at the source size
+const rungTolerance = 0.95
+
 func GetQualityMap() map[string]Quality {
 	qualityMap := make(map[string]Quality)
 
@@ -23,3 +41,57 @@ func GetQualityMap() map[string]Quality {
 	}
 	return qualityMap
 }
+
+// Ladder returns the renditions of rungs (sorted by height) worth encoding for
+// a width x height source with the given bitrate (0 when unknown). Rungs above
+// the source are skipped, sizes keep the source aspect ratio, portrait sources
+// get portrait renditions and no rendition asks for more bandwidth than the
+// source has.
+func Ladder(rungs []Quality, width, height int, bitrate int64) []Quality {
+	if len(rungs) == 0 {
+		rungs = Sizes
+	}
+	if width <= 0 || height <= 0 {
+		var out []Quality
+		for _, q := range rungs {
+			if q.Height <= defaultMaxHeight {
+				out = append(out, q)
+			}
+		}
+		return out
+	}
+
+	short, long := min(width, height), max(width, height)
+	var out []Quality
+	for _, q := range rungs {
+		if float64(short) < float64(q.Height)*rungTolerance {
+			break
+		}
+		out = append(out, rung(q, min(q.Height, short), short, long, width < height, bitrate))
+	}
+	if len(out) == 0 {
+		// smaller than the lowest rung, keep it as it is
+		lowest := rungs[0]
+		lowest.Label = fmt.Sprintf("%dp", even(short))
+		out = append(out, rung(lowest, short, short, long, width < height, bitrate))
+	}
+	return out
+}
+
+func rung(q Quality, outShort, short, long int, portrait bool, bitrate int64) Quality {
+	outShort = even(outShort)
+	outLong := even(int(float64(outShort)*float64(long)/float64(short) + 0.5))
+	if bitrate > 0 && int64(q.Bandwidth) > bitrate {
+		q.Bandwidth = int(bitrate)
+	}
+	q.Width, q.Height = outLong, outShort
+	if portrait {
+		q.Width, q.Height = outShort, outLong
+	}
+	return q
+}
+
+// even rounds n down to an even number, which h264 needs for both dimensions
+func even(n int) int {
+	return max(2, n-n%2)
+}
@@ -0,0 +1,88 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestForbidden(t *testing.T) {
+	tests := []struct {
+		ip        string
+		forbidden bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"::", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"224.0.0.1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"8.8.8.8", false},
+		{"93.184.216.34", false},
+		{"172.32.0.1", false},
+		{"2606:4700::1111", false},
+	}
+	for _, tt := range tests {
+		if got := Forbidden(netip.MustParseAddr(tt.ip)); got != tt.forbidden {
+			t.Errorf("Forbidden(%s) = %v, want %v", tt.ip, got, tt.forbidden)
+		}
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	tests := []struct {
+		host string
+		ok   bool
+	}{
+		{"example.com", true},
+		{"93.184.216.34", true},
+		{"localhost", false},
+		{"LOCALHOST.", false},
+		{"api.localhost", false},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"[::1]", false},
+		{"169.254.169.254", false},
+	}
+	for _, tt := range tests {
+		err := CheckHost(tt.host)
+		if tt.ok && err != nil {
+			t.Errorf("CheckHost(%s) = %v, want nil", tt.host, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("CheckHost(%s) = %v, want ErrForbiddenAddress", tt.host, err)
+		}
+	}
+}
+
+func TestDialerRefusesLoopback(t *testing.T) {
+	hit := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer srv.Close()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = Dialer(time.Second).DialContext
+	client := &http.Client{Transport: transport}
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, srv.URL, nil)
+	_, err := client.Do(req)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("posting to %s = %v, want ErrForbiddenAddress", srv.URL, err)
+	}
+	if hit {
+		t.Error("the request reached the server")
+	}
+}
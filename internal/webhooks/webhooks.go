@@ -0,0 +1,95 @@
+// Package webhooks holds what senders and receivers of webhook deliveries
+// agree on: the event types, the body and the signature.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EventUploaded = "video.uploaded"
+	EventValid    = "video.valid"
+	EventReady    = "video.ready"
+	EventFailed   = "video.failed"
+
+	HeaderEvent     = "X-Mytube-Event"
+	HeaderDelivery  = "X-Mytube-Delivery"
+	HeaderSignature = "X-Mytube-Signature"
+)
+
+// Events are the event types a webhook can subscribe to
+var Events = []string{EventUploaded, EventValid, EventReady, EventFailed}
+
+var ErrInvalidSignature = errors.New("webhooks: invalid signature")
+
+// Payload is the body of every delivery. ID is the same for every delivery and
+// replay of one event, receivers can use it to drop duplicates.
+type Payload struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// NewSecret returns a random signing secret
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the X-Mytube-Signature header of body sent at t,
+// t=<unix seconds>,v1=<hex hmac-sha256 of "<t>.<body>">
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, mac(secret, ts, body))
+}
+
+// Verify checks header against body and rejects signatures older than
+// tolerance, a zero tolerance accepts any age
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var ts string
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 && math.Abs(time.Since(time.Unix(sec, 0)).Seconds()) > tolerance.Seconds() {
+		return fmt.Errorf("%w: timestamp out of tolerance", ErrInvalidSignature)
+	}
+	want := mac(secret, ts, body)
+	for _, s := range sigs {
+		if hmac.Equal([]byte(s), []byte(want)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func mac(secret, ts string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,71 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// printf '1700000000.{}' | openssl dgst -sha256 -hmac whsec_test
+	at := time.Unix(1700000000, 0)
+	got := Sign("whsec_test", at, []byte("{}"))
+	want := "t=1700000000,v1=35495024f4ef3f94e5a93e22221544c4b75e9a42300cd965ab81cb85cd994e91"
+	if got != want {
+		t.Fatalf("Sign = %q, want %q", got, want)
+	}
+	if other := Sign("whsec_other", at, []byte("{}")); other == got {
+		t.Error("Sign ignores the secret")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	now := time.Now()
+	signed := Sign("whsec_test", now, body)
+	_, v1, _ := strings.Cut(signed, ",")
+	tests := []struct {
+		name      string
+		secret    string
+		header    string
+		body      []byte
+		tolerance time.Duration
+		ok        bool
+	}{
+		{"valid", "whsec_test", signed, body, time.Minute, true},
+		{"spaces", "whsec_test", strings.ReplaceAll(signed, ",", ", "), body, time.Minute, true},
+		{"wrong secret", "whsec_other", signed, body, time.Minute, false},
+		{"tampered body", "whsec_test", signed, []byte(`{"id":"2"}`), time.Minute, false},
+		{"stale", "whsec_test", Sign("whsec_test", now.Add(-time.Hour), body), body, time.Minute, false},
+		{"from the future", "whsec_test", Sign("whsec_test", now.Add(time.Hour), body), body, time.Minute, false},
+		{"stale without tolerance", "whsec_test", Sign("whsec_test", now.Add(-time.Hour), body), body, 0, true},
+		{"one of several signatures", "whsec_test", signed + ",v1=" + strings.Repeat("0", 64), body, time.Minute, true},
+		{"no timestamp", "whsec_test", v1, body, time.Minute, false},
+		{"no signature", "whsec_test", fmt.Sprintf("t=%d", now.Unix()), body, time.Minute, false},
+		{"garbage", "whsec_test", "garbage", body, time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, tt.tolerance)
+			if tt.ok && err != nil {
+				t.Errorf("Verify = %v, want nil", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Verify = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	a, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewSecret()
+	if !strings.HasPrefix(a, "whsec_") || len(a) != len("whsec_")+64 || a == b {
+		t.Errorf("NewSecret = %q, %q", a, b)
+	}
+}
@@ -2,29 +2,265 @@ package workers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
 
 	"github.com/ak-ansari/mytube/internal/jobs"
+	"github.com/ak-ansari/mytube/internal/m3u8"
+	"github.com/ak-ansari/mytube/internal/models"
 	"github.com/ak-ansari/mytube/internal/pkg/logger"
+	"github.com/ak-ansari/mytube/internal/services"
+	"github.com/ak-ansari/mytube/internal/storage"
 )
 
+// maxReportedProblems keeps the error of a badly broken video readable, every
+// object still gets its own verification result
+const maxReportedProblems = 20
+
+// a plain md5 ETag, multipart uploads and the local store use other formats
+var md5ETag = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Checksum verifies everything the pipeline stored for a video before it is
+// published: the original still hashes to what was uploaded, every object the
+// steps recorded is in the store with the size and checksums it was uploaded
+// with, and every playlist only points at objects that are there.
 type Checksum struct {
-	log logger.Logger
+	service *services.VideoService
+	store   storage.ObjectStore
+	log     logger.Logger
 }
 
-func NewChecksum(log logger.Logger) *Checksum {
+func NewChecksum(service *services.VideoService, store storage.ObjectStore, log logger.Logger) *Checksum {
 	return &Checksum{
-		log: log,
+		service: service,
+		store:   store,
+		log:     log,
+	}
+}
+
+// problem is one thing found wrong with a stored object
+type problem struct {
+	key      string
+	kind     models.ObjectKind
+	what     string
+	expected string
+	actual   string
+}
+
+func (p problem) String() string {
+	s := fmt.Sprintf("%s %s: %s", p.kind, p.key, p.what)
+	if p.expected != "" || p.actual != "" {
+		s += fmt.Sprintf(" (expected %s, got %s)", p.expected, p.actual)
 	}
+	return s
 }
 
 func (c *Checksum) Handle(ctx context.Context, payload jobs.JobPayload) error {
 	c.log.Info("Checksum validation started",
 		logger.String("videoId", payload.VideoID))
 
-	// TODO: implement real checksum validation here
+	v, err := c.service.GetVideo(ctx, payload.VideoID)
+	if err != nil {
+		c.log.Error("Failed to get video info",
+			logger.String("videoId", payload.VideoID),
+			logger.Error(err))
+		return err
+	}
+	objects, err := c.service.ListObjects(ctx, payload.VideoID)
+	if err != nil {
+		return err
+	}
 
-	c.log.Success("Checksum validation finished",
-		logger.String("videoId", payload.VideoID))
+	var problems []problem
+	p, err := c.verifyOriginal(ctx, v)
+	if err != nil {
+		return err
+	}
+	problems = append(problems, p...)
+	recorded := make(map[string]bool, len(objects))
+	for _, o := range objects {
+		recorded[o.Key] = true
+	}
+	problems = append(problems, c.missingRecords(v, recorded)...)
 
+	for _, o := range objects {
+		found, err := c.verifyObject(ctx, o, recorded)
+		if err != nil {
+			return err
+		}
+		var result *string
+		if len(found) > 0 {
+			parts := make([]string, len(found))
+			for i, f := range found {
+				parts[i] = f.String()
+			}
+			s := strings.Join(parts, "; ")
+			result = &s
+		}
+		if err := c.service.ObjectVerified(ctx, payload.VideoID, o.Key, result); err != nil {
+			return err
+		}
+		problems = append(problems, found...)
+	}
+
+	if len(problems) > 0 {
+		for _, p := range problems {
+			c.log.Error("Stored object failed verification",
+				logger.String("videoId", payload.VideoID),
+				logger.String("key", p.key),
+				logger.String("problem", p.String()))
+		}
+		// the store has what it has, retrying won't change it
+		return jobs.Permanent(fmt.Errorf("%d problems with the stored objects: %s", len(problems), report(problems)))
+	}
+
+	c.log.Success("Checksum validation finished",
+		logger.String("videoId", payload.VideoID),
+		logger.Int("objects", len(objects)))
 	return nil
 }
+
+// verifyOriginal hashes the original upload again and compares it with what
+// the upload recorded
+func (c *Checksum) verifyOriginal(ctx context.Context, v *models.Video) ([]problem, error) {
+	const kind = models.ObjectKind("original")
+	key := v.OriginalObjectKey
+	r, _, err := c.store.Get(ctx, key)
+	if errors.Is(err, os.ErrNotExist) {
+		return []problem{{key: key, kind: kind, what: "missing from the store"}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get original %s: %w", key, err)
+	}
+	defer r.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return nil, fmt.Errorf("read original %s: %w", key, err)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	var problems []problem
+	if v.SizeBytes != nil && *v.SizeBytes != size {
+		problems = append(problems, problem{key: key, kind: kind, what: "size mismatch",
+			expected: fmt.Sprint(*v.SizeBytes), actual: fmt.Sprint(size)})
+	}
+	if v.SHA256 != nil && *v.SHA256 != sum {
+		problems = append(problems, problem{key: key, kind: kind, what: "sha256 mismatch",
+			expected: *v.SHA256, actual: sum})
+	}
+	return problems, nil
+}
+
+// missingRecords are the objects the video points at that no step recorded
+func (c *Checksum) missingRecords(v *models.Video, recorded map[string]bool) []problem {
+	var problems []problem
+	expect := func(key string, kind models.ObjectKind) {
+		if !recorded[key] {
+			problems = append(problems, problem{key: key, kind: kind, what: "never recorded as uploaded"})
+		}
+	}
+	for _, q := range byBandwidth(c.service.Ladder(v), v.AvailableQualities) {
+		expect(c.service.GetTranscodingPath(v.ID.String(), q.Label, c.service.RenditionExt(v, q)), models.ObjectRendition)
+	}
+	if v.ManifestPath != nil {
+		expect(*v.ManifestPath, models.ObjectManifest)
+	}
+	if v.DashManifestPath != nil {
+		expect(*v.DashManifestPath, models.ObjectManifest)
+	}
+	return problems
+}
+
+// verifyObject compares the stored copy of o with what was recorded at upload.
+// Only errors reaching the store are returned, what is wrong with the object
+// comes back as problems.
+func (c *Checksum) verifyObject(ctx context.Context, o models.VideoObject, recorded map[string]bool) ([]problem, error) {
+	info, err := c.store.Stat(ctx, o.Key)
+	if errors.Is(err, os.ErrNotExist) {
+		return []problem{{key: o.Key, kind: o.Kind, what: "missing from the store"}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stat %s: %w", o.Key, err)
+	}
+
+	var problems []problem
+	if info.Size != o.SizeBytes {
+		problems = append(problems, problem{key: o.Key, kind: o.Kind, what: "size mismatch",
+			expected: fmt.Sprint(o.SizeBytes), actual: fmt.Sprint(info.Size)})
+	}
+	etag := strings.Trim(info.ETag, `"`)
+	if o.ETag != "" && strings.Trim(o.ETag, `"`) != etag {
+		problems = append(problems, problem{key: o.Key, kind: o.Kind, what: "etag changed since upload",
+			expected: o.ETag, actual: info.ETag})
+	}
+	if md5ETag.MatchString(etag) && etag != o.MD5 {
+		problems = append(problems, problem{key: o.Key, kind: o.Kind, what: "md5 mismatch",
+			expected: o.MD5, actual: etag})
+	}
+
+	if o.Kind == models.ObjectPlaylist && len(problems) == 0 {
+		p, err := c.verifyPlaylist(ctx, o, recorded)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, p...)
+	}
+	return problems, nil
+}
+
+// verifyPlaylist checks that every segment of a media playlist, and its init
+// segment, was uploaded next to it
+func (c *Checksum) verifyPlaylist(ctx context.Context, o models.VideoObject, recorded map[string]bool) ([]problem, error) {
+	r, _, err := c.store.Get(ctx, o.Key)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", o.Key, err)
+	}
+	defer r.Close()
+	pl, err := m3u8.ParseMedia(r)
+	if err != nil {
+		return []problem{{key: o.Key, kind: o.Kind, what: fmt.Sprintf("unreadable playlist: %v", err)}}, nil
+	}
+
+	uris := make([]string, 0, len(pl.Segments)+1)
+	if pl.Map != "" {
+		uris = append(uris, pl.Map)
+	}
+	for _, s := range pl.Segments {
+		uris = append(uris, s.URI)
+	}
+	var problems []problem
+	seen := map[string]bool{}
+	dir := path.Dir(o.Key)
+	for _, uri := range uris {
+		// I-frame playlists address byte ranges of the same segment many times
+		if seen[uri] {
+			continue
+		}
+		seen[uri] = true
+		if key := path.Join(dir, uri); !recorded[key] {
+			problems = append(problems, problem{key: o.Key, kind: o.Kind,
+				what: fmt.Sprintf("references %s which was never uploaded", key)})
+		}
+	}
+	return problems, nil
+}
+
+func report(problems []problem) string {
+	n := min(len(problems), maxReportedProblems)
+	parts := make([]string, 0, n+1)
+	for _, p := range problems[:n] {
+		parts = append(parts, p.String())
+	}
+	if len(problems) > n {
+		parts = append(parts, fmt.Sprintf("and %d more", len(problems)-n))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,193 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/ak-ansari/mytube/internal/encoding"
+	"github.com/ak-ansari/mytube/internal/jobs"
+	"github.com/ak-ansari/mytube/internal/media"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/pkg/logger"
+	"github.com/ak-ansari/mytube/internal/services"
+	"github.com/ak-ansari/mytube/internal/storage"
+	"github.com/ak-ansari/mytube/internal/util"
+)
+
+const dashManifestName = "manifest.mpd"
+
+// Dash packages the transcoded renditions of a video as MPEG-DASH
+type Dash struct {
+	service *services.VideoService
+	store   storage.ObjectStore
+	ffm     *media.FFM
+	log     logger.Logger
+}
+
+func NewDash(service *services.VideoService, store storage.ObjectStore, ffm *media.FFM, log logger.Logger) *Dash {
+	return &Dash{
+		service: service,
+		store:   store,
+		ffm:     ffm,
+		log:     log,
+	}
+}
+
+func (d *Dash) Handle(ctx context.Context, payload jobs.JobPayload) error {
+	d.log.Info("DASH packaging started",
+		logger.String("videoId", payload.VideoID))
+
+	v, err := d.service.GetVideo(ctx, payload.VideoID)
+	if err != nil {
+		d.log.Error("Failed to get video info",
+			logger.String("videoId", payload.VideoID),
+			logger.Error(err))
+		return err
+	}
+	if d.service.Profile(v).Packaging == encoding.PackagingCMAF {
+		// segment already wrote the MPD next to the HLS playlists
+		d.log.Info("DASH is packaged with the CMAF segments, nothing to do",
+			logger.String("videoId", payload.VideoID))
+		return nil
+	}
+	if len(v.AvailableQualities) == 0 {
+		return jobs.Permanent(fmt.Errorf("video %s has no renditions to package", payload.VideoID))
+	}
+
+	inputs, err := renditionInputs(ctx, d.service, v, byBandwidth(d.service.Ladder(v), v.AvailableQualities))
+	if err != nil {
+		d.log.Error("Failed to get download URL",
+			logger.String("videoId", payload.VideoID),
+			logger.Error(err))
+		return err
+	}
+
+	tempDir, err := os.MkdirTemp("", payload.VideoID+"-dash-*")
+	if err != nil {
+		d.log.Error("Failed to create temp dir",
+			logger.String("videoId", payload.VideoID),
+			logger.Error(err))
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := d.ffm.PackageDash(ctx, inputs, tempDir, dashManifestName, 4, newProgress(d.service, payload, v, d.log).Part(ctx, 0, 1)); err != nil {
+		d.log.Error("Failed to package DASH",
+			logger.String("videoId", payload.VideoID),
+			logger.Error(err))
+		return err
+	}
+
+	keys, err := uploadPackage(ctx, d.service, d.store, payload.VideoID, tempDir, d.service.GetDashDir(payload.VideoID), dashManifestName)
+	if err != nil {
+		d.log.Error("Failed to upload DASH files",
+			logger.String("videoId", payload.VideoID),
+			logger.Error(err))
+		return err
+	}
+
+	manifestPath := keys[0]
+	if err := d.service.UpdateDashManifest(ctx, payload.VideoID, manifestPath); err != nil {
+		d.log.Error("Failed to update DASH manifest in DB",
+			logger.String("videoId", payload.VideoID),
+			logger.String("path", manifestPath),
+			logger.Error(err))
+		return err
+	}
+
+	d.log.Success("DASH packaging finished",
+		logger.String("videoId", payload.VideoID),
+		logger.String("manifestPath", manifestPath))
+	return nil
+}
+
+var packageContentTypes = map[string]string{
+	".m4s":  "video/iso.segment",
+	".ts":   "video/mp2t",
+	".m3u8": "application/vnd.apple.mpegurl",
+	".mpd":  "application/dash+xml",
+}
+
+// uploadPackage sends the segments in localDir, then the media playlists, then
+// the manifests, so a player never finds a manifest pointing at files that
+// aren't there yet. It returns the keys of the manifests in the same order.
+func uploadPackage(ctx context.Context, service *services.VideoService, store storage.ObjectStore, videoId, localDir, remoteDir string, manifests ...string) ([]string, error) {
+	entries, err := os.ReadDir(localDir)
+	if err != nil {
+		return nil, err
+	}
+	isManifest := map[string]bool{}
+	for _, m := range manifests {
+		isManifest[m] = true
+	}
+	var segments, playlists []string
+	for _, e := range entries {
+		name := e.Name()
+		ext := filepath.Ext(name)
+		switch {
+		case e.IsDir(), isManifest[name], packageContentTypes[ext] == "":
+		case ext == ".m3u8":
+			playlists = append(playlists, name)
+		default:
+			segments = append(segments, name)
+		}
+	}
+
+	upload := func(name string) (string, error) {
+		kind := models.ObjectSegment
+		switch {
+		case isManifest[name]:
+			kind = models.ObjectManifest
+		case filepath.Ext(name) == ".m3u8":
+			kind = models.ObjectPlaylist
+		}
+		return uploadObject(ctx, service, store, videoId, kind, filepath.Join(remoteDir, name), filepath.Join(localDir, name), packageContentTypes[filepath.Ext(name)])
+	}
+	for _, name := range append(segments, playlists...) {
+		if _, err := upload(name); err != nil {
+			return nil, err
+		}
+	}
+	keys := make([]string, 0, len(manifests))
+	for _, name := range manifests {
+		key, err := upload(name)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// byBandwidth returns the renditions of ladder that are available, from low to
+// high bandwidth, they finish in any order when transcoding fans out
+func byBandwidth(ladder []util.Quality, available []string) []util.Quality {
+	var qualities []util.Quality
+	for _, q := range ladder {
+		if slices.Contains(available, q.Label) {
+			qualities = append(qualities, q)
+		}
+	}
+	sort.SliceStable(qualities, func(i, j int) bool {
+		return qualities[i].Bandwidth < qualities[j].Bandwidth
+	})
+	return qualities
+}
+
+// renditionInputs are the transcoded qualities of v ready to be packaged
+func renditionInputs(ctx context.Context, service *services.VideoService, v *models.Video, qualities []util.Quality) ([]media.PackageInput, error) {
+	inputs := make([]media.PackageInput, 0, len(qualities))
+	for _, q := range qualities {
+		key := service.GetTranscodingPath(v.ID.String(), q.Label, service.RenditionExt(v, q))
+		url, err := service.GetDownloadUrl(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("download url of %s: %w", q.Label, err)
+		}
+		inputs = append(inputs, media.PackageInput{Path: url, Codec: q.Codec})
+	}
+	return inputs, nil
+}
@@ -0,0 +1,94 @@
+package workers
+
+import (
+	"context"
+
+	"github.com/ak-ansari/mytube/internal/jobs"
+	"github.com/ak-ansari/mytube/internal/media"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/phash"
+	"github.com/ak-ansari/mytube/internal/pkg/logger"
+	"github.com/ak-ansari/mytube/internal/services"
+)
+
+const (
+	// fingerprintFrames caps the keyframes hashed per video, long videos get
+	// them spread further apart
+	fingerprintFrames = 300
+	// fingerprintInterval is the least time between two hashed keyframes, in seconds
+	fingerprintInterval = 1.0
+)
+
+// Fingerprint hashes keyframes of the original so re-encoded and trimmed
+// copies of a video can be found
+type Fingerprint struct {
+	service *services.VideoService
+	ffm     *media.FFM
+	log     logger.Logger
+}
+
+func NewFingerprint(service *services.VideoService, ffm *media.FFM, log logger.Logger) *Fingerprint {
+	return &Fingerprint{
+		service: service,
+		ffm:     ffm,
+		log:     log,
+	}
+}
+
+func (f *Fingerprint) Handle(ctx context.Context, payload jobs.JobPayload) error {
+	f.log.Info("Fingerprinting started",
+		logger.String("videoId", payload.VideoID))
+
+	v, err := f.service.GetVideo(ctx, payload.VideoID)
+	if err != nil {
+		f.log.Error("Failed to get video info",
+			logger.String("videoId", payload.VideoID),
+			logger.Error(err))
+		return err
+	}
+	url, err := f.service.GetDownloadUrl(ctx, v.OriginalObjectKey)
+	if err != nil {
+		f.log.Error("Failed to get video download URL",
+			logger.String("videoId", payload.VideoID),
+			logger.Error(err))
+		return err
+	}
+
+	interval := fingerprintInterval
+	if v.DurationSeconds != nil {
+		interval = max(interval, float64(*v.DurationSeconds)/fingerprintFrames)
+	}
+	frames, err := f.ffm.Keyframes(ctx, url, phash.Size, interval, fingerprintFrames)
+	if err != nil {
+		f.log.Error("Failed to extract keyframes",
+			logger.String("videoId", payload.VideoID),
+			logger.Error(err))
+		return err
+	}
+
+	prints := make([]models.Fingerprint, 0, len(frames))
+	for _, fr := range frames {
+		if phash.Flat(fr.Pixels) {
+			continue
+		}
+		prints = append(prints, models.Fingerprint{
+			VideoID:  v.ID,
+			Position: len(prints),
+			At:       fr.At,
+			PHash:    phash.PHash(fr.Pixels),
+			DHash:    phash.DHash(fr.Pixels),
+		})
+	}
+	if err := f.service.SaveFingerprints(ctx, payload.VideoID, prints); err != nil {
+		f.log.Error("Failed to save fingerprints",
+			logger.String("videoId", payload.VideoID),
+			logger.Error(err))
+		return err
+	}
+
+	f.log.Success("Fingerprinting finished",
+		logger.String("videoId", payload.VideoID),
+		logger.Int("keyframes", len(frames)),
+		logger.Int("fingerprints", len(prints)))
+	return nil
+}
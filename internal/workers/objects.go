@@ -0,0 +1,64 @@
+package workers
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/services"
+	"github.com/ak-ansari/mytube/internal/storage"
+	"github.com/google/uuid"
+)
+
+// uploadObject uploads the local file at path to key and records its size and
+// checksums, which the checksum step verifies the stored copy against
+func uploadObject(ctx context.Context, service *services.VideoService, store storage.ObjectStore, videoId string, kind models.ObjectKind, key, path, contentType string) (string, error) {
+	id, err := uuid.Parse(videoId)
+	if err != nil {
+		return "", fmt.Errorf("invalid videoId: %w", err)
+	}
+	size, sha, md5sum, err := hashFile(path)
+	if err != nil {
+		return "", err
+	}
+	stored, err := store.UploadLocalFile(ctx, key, path, contentType)
+	if err != nil {
+		return "", err
+	}
+	info, err := store.Stat(ctx, stored)
+	if err != nil {
+		return "", err
+	}
+	if info.Size != size {
+		return "", fmt.Errorf("uploaded %s is %d bytes, the local file %d", stored, info.Size, size)
+	}
+	err = service.RecordObject(ctx, models.VideoObject{
+		VideoID:   id,
+		Key:       stored,
+		Kind:      kind,
+		SizeBytes: size,
+		SHA256:    sha,
+		MD5:       md5sum,
+		ETag:      info.ETag,
+	})
+	return stored, err
+}
+
+func hashFile(path string) (size int64, sha, md5sum string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer f.Close()
+	s, m := sha256.New(), md5.New()
+	size, err = io.Copy(io.MultiWriter(s, m), f)
+	if err != nil {
+		return 0, "", "", err
+	}
+	return size, hex.EncodeToString(s.Sum(nil)), hex.EncodeToString(m.Sum(nil)), nil
+}
@@ -0,0 +1,63 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/pkg/logger"
+	"github.com/ak-ansari/mytube/internal/services"
+)
+
+const (
+	outboxBatch = 100
+	// outboxPollInterval catches what a lost notification would leave behind
+	// and the messages whose retry comes due
+	outboxPollInterval = 2 * time.Second
+)
+
+// OutboxRelay sends the outbox to the job queue and the event bus. It wakes up
+// when a transaction that wrote messages commits and polls in case it missed one.
+type OutboxRelay struct {
+	service *services.VideoService
+	log     logger.Logger
+}
+
+func NewOutboxRelay(service *services.VideoService, log logger.Logger) *OutboxRelay {
+	return &OutboxRelay{
+		service: service,
+		log:     log,
+	}
+}
+
+func (r *OutboxRelay) Start(ctx context.Context) {
+	notify, err := r.service.WatchOutbox(ctx)
+	if err != nil {
+		// polling alone still gets everything through
+		r.log.Warn("Failed to listen for outbox messages, polling",
+			logger.Error(err))
+	}
+	go func() {
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+		for {
+			n, err := r.service.RelayOutbox(ctx, outboxBatch)
+			if err != nil && ctx.Err() == nil {
+				r.log.Error("Failed to relay outbox",
+					logger.Error(err))
+			}
+			if n == outboxBatch && err == nil {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				r.log.Info("Outbox relay stopped")
+				return
+			case _, ok := <-notify:
+				if !ok {
+					notify = nil
+				}
+			case <-ticker.C:
+			}
+		}
+	}()
+}
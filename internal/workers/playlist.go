@@ -0,0 +1,133 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ak-ansari/mytube/internal/m3u8"
+	"github.com/ak-ansari/mytube/internal/media"
+)
+
+const audioGroup = "audio"
+
+// describeRendition builds the master playlist entries of the rendition whose
+// media playlist is dir/playlist. Bandwidth is measured on the segments that
+// were produced, codecs and frame rate come from probing source, the rendition
+// they were cut from. An I-frame playlist is written next to the media playlist.
+func describeRendition(ctx context.Context, ffm *media.FFM, source, dir, playlist string) (m3u8.Variant, *m3u8.IFrameVariant, error) {
+	pl, err := readPlaylist(dir, playlist)
+	if err != nil {
+		return m3u8.Variant{}, nil, err
+	}
+	peak, average, err := pl.Bandwidth(localSize(dir))
+	if err != nil {
+		return m3u8.Variant{}, nil, err
+	}
+	probe, err := ffm.Probe(ctx, source)
+	if err != nil {
+		return m3u8.Variant{}, nil, fmt.Errorf("probe %s: %w", playlist, err)
+	}
+	video, _ := probe.Stream("video")
+	audio, hasAudio := probe.Stream("audio")
+
+	variant := m3u8.Variant{
+		URI:              playlist,
+		Bandwidth:        peak,
+		AverageBandwidth: average,
+		Width:            video.Width,
+		Height:           video.Height,
+		Codecs:           codecs(video, audio),
+		FrameRate:        video.FrameRate(),
+	}
+	if hasAudio {
+		variant.Audio = audioGroup
+	}
+
+	iframes := &m3u8.IFramePlaylist{Map: pl.Map}
+	var init string
+	if pl.Map != "" {
+		init = filepath.Join(dir, pl.Map)
+	}
+	for _, seg := range pl.Segments {
+		end, ok, err := ffm.FirstKeyframe(ctx, filepath.Join(dir, seg.URI), init)
+		if err != nil {
+			return m3u8.Variant{}, nil, err
+		}
+		if ok {
+			iframes.Frames = append(iframes.Frames, m3u8.IFrame{URI: seg.URI, Duration: seg.Duration, Length: end})
+		}
+	}
+	if len(iframes.Frames) == 0 {
+		return variant, nil, nil
+	}
+	name := strings.TrimSuffix(playlist, ".m3u8") + "_iframes.m3u8"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(iframes.Encode()), 0644); err != nil {
+		return m3u8.Variant{}, nil, err
+	}
+	return variant, &m3u8.IFrameVariant{
+		URI:       name,
+		Bandwidth: iframes.Bandwidth(),
+		Width:     video.Width,
+		Height:    video.Height,
+		Codecs:    codecs(video),
+	}, nil
+}
+
+// audioMedia is the EXT-X-MEDIA entry of the audio the variants carry, uri is
+// empty when it is muxed into them
+func audioMedia(ctx context.Context, ffm *media.FFM, source, uri string) (*m3u8.Media, error) {
+	probe, err := ffm.Probe(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	audio, ok := probe.Stream("audio")
+	if !ok {
+		return nil, nil
+	}
+	lang := audio.Tags["language"]
+	if lang == "und" {
+		lang = ""
+	}
+	return &m3u8.Media{
+		Type:       "AUDIO",
+		GroupID:    audioGroup,
+		Name:       "default",
+		Language:   lang,
+		Default:    true,
+		AutoSelect: true,
+		Channels:   audio.Channels,
+		URI:        uri,
+	}, nil
+}
+
+func readPlaylist(dir, name string) (*m3u8.MediaPlaylist, error) {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return m3u8.ParseMedia(f)
+}
+
+func localSize(dir string) func(uri string) (int64, error) {
+	return func(uri string) (int64, error) {
+		info, err := os.Stat(filepath.Join(dir, uri))
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+}
+
+func codecs(streams ...media.ProbeStream) []string {
+	var out []string
+	for _, s := range streams {
+		if c := s.CodecString(); c != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
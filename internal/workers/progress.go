@@ -0,0 +1,58 @@
+package workers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/jobs"
+	"github.com/ak-ansari/mytube/internal/media"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/pkg/logger"
+	"github.com/ak-ansari/mytube/internal/services"
+)
+
+// progressInterval keeps ffmpeg's twice a second reports from turning into as many writes
+const progressInterval = 2 * time.Second
+
+// progress records the ffmpeg progress of one job on its step. A job that
+// runs ffmpeg more than once reports each run as a part of the whole.
+type progress struct {
+	service *services.VideoService
+	payload jobs.JobPayload
+	total   time.Duration
+	log     logger.Logger
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func newProgress(service *services.VideoService, payload jobs.JobPayload, v *models.Video, log logger.Logger) *progress {
+	p := &progress{service: service, payload: payload, log: log}
+	if v.DurationSeconds != nil {
+		p.total = time.Duration(*v.DurationSeconds) * time.Second
+	}
+	return p
+}
+
+// Part returns the callback of the part-th of parts ffmpeg runs
+func (p *progress) Part(ctx context.Context, part, parts int) media.ProgressFunc {
+	return func(pr media.Progress) {
+		percent := (float64(part) + pr.Percent(p.total)/100) / float64(parts) * 100
+
+		p.mu.Lock()
+		if !pr.Done && time.Since(p.last) < progressInterval {
+			p.mu.Unlock()
+			return
+		}
+		p.last = time.Now()
+		p.mu.Unlock()
+
+		if err := p.service.UpdateProgress(ctx, p.payload, percent, pr.Speed, pr.FPS); err != nil {
+			p.log.Warn("Failed to record progress",
+				logger.String("videoId", p.payload.VideoID),
+				logger.String("step", string(p.payload.Step)),
+				logger.Error(err))
+		}
+	}
+}
@@ -32,7 +32,7 @@ func (p *Publish) Handle(ctx context.Context, payload jobs.JobPayload) error {
 		return err
 	}
 
-	// TODO: Notify the user that video is processed
+	// marking it ready queued the video.ready webhook deliveries
 	p.log.Success("🔥 Publish process finished",
 		logger.String("videoId", payload.VideoID))
 
@@ -0,0 +1,53 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ak-ansari/mytube/internal/jobs"
+)
+
+// Handler runs one pipeline step of a video
+type Handler interface {
+	Handle(ctx context.Context, p jobs.JobPayload) error
+}
+
+// HandlerFunc lets a plain function be registered as a step
+type HandlerFunc func(ctx context.Context, p jobs.JobPayload) error
+
+func (f HandlerFunc) Handle(ctx context.Context, p jobs.JobPayload) error {
+	return f(ctx, p)
+}
+
+// Registry maps pipeline steps to the handlers that run them
+type Registry struct {
+	handlers map[jobs.Step]Handler
+}
+
+func NewRegistry() *Registry {
+	return &Registry{handlers: map[jobs.Step]Handler{}}
+}
+
+// Register adds h for step, registering a step twice is a programming error
+func (r *Registry) Register(step jobs.Step, h Handler) *Registry {
+	if _, ok := r.handlers[step]; ok {
+		panic(fmt.Sprintf("workers: step %s registered twice", step))
+	}
+	r.handlers[step] = h
+	return r
+}
+
+func (r *Registry) Lookup(step jobs.Step) (Handler, bool) {
+	h, ok := r.handlers[step]
+	return h, ok
+}
+
+// Check makes sure every step of p has a handler
+func (r *Registry) Check(p *jobs.Pipeline) error {
+	for _, step := range p.Steps() {
+		if _, ok := r.handlers[step]; !ok {
+			return fmt.Errorf("no handler registered for pipeline step %s", step)
+		}
+	}
+	return nil
+}
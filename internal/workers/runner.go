@@ -4,45 +4,39 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/ak-ansari/mytube/internal/jobs"
+	"github.com/ak-ansari/mytube/internal/models"
 	"github.com/ak-ansari/mytube/internal/pkg/logger"
 	"github.com/ak-ansari/mytube/internal/queue"
+	"github.com/ak-ansari/mytube/internal/services"
 )
 
 type Runner struct {
-	qName     string
-	q         queue.Queue
-	validate  *Validate
-	transcode *Transcode
-	segment   *Segment
-	checksum  *Checksum
-	publish   *Publish
-	thumbnail *Thumbnail
-	log       logger.Logger
+	qName      string
+	q          queue.Queue
+	dlq        queue.DeadLetterQueue
+	visibility time.Duration
+	retries    jobs.RetryPolicies
+	registry   *Registry
+	service    *services.VideoService
+	log        logger.Logger
 }
 
-func NewRunner(
-	q queue.Queue,
-	qName string,
-	validate *Validate,
-	transcode *Transcode,
-	segment *Segment,
-	checksum *Checksum,
-	publish *Publish,
-	thumbnail *Thumbnail,
-	log logger.Logger,
-) *Runner {
+func NewRunner(q queue.Queue, qName string, dlq queue.DeadLetterQueue, visibility time.Duration, retries jobs.RetryPolicies, registry *Registry, service *services.VideoService, log logger.Logger) *Runner {
+	if visibility <= 0 {
+		visibility = queue.DefaultVisibilityTimeout
+	}
 	return &Runner{
-		q:         q,
-		qName:     qName,
-		validate:  validate,
-		transcode: transcode,
-		segment:   segment,
-		checksum:  checksum,
-		publish:   publish,
-		thumbnail: thumbnail,
-		log:       log,
+		q:          q,
+		qName:      qName,
+		dlq:        dlq,
+		visibility: visibility,
+		retries:    retries,
+		registry:   registry,
+		service:    service,
+		log:        log,
 	}
 }
 
@@ -58,75 +52,196 @@ func (r *Runner) Start(ctx context.Context) {
 				default:
 				}
 
-				j, err := r.q.Dequeue(ctx, r.qName)
+				msg, err := r.q.Dequeue(ctx, r.qName)
 				if err != nil {
 					r.log.Error("Failed to dequeue job",
 						logger.Int("workerID", workerID),
 						logger.Error(err))
 					continue
 				}
-				if j == nil {
+				if msg == nil {
 					continue
 				}
+				r.handle(ctx, workerID, msg)
+			}
+		}(i)
+	}
+}
 
-				var payload jobs.JobPayload
-				if err := json.Unmarshal(j, &payload); err != nil {
-					r.log.Error("Failed to unmarshal job payload",
-						logger.Int("workerID", workerID),
-						logger.Error(err))
-					continue
-				}
+// handle runs one leased message and settles it: acked when the step is done,
+// handed back when the worker is shutting down, retried with backoff on failure
+// and dead-lettered once its retry policy is exhausted.
+func (r *Runner) handle(ctx context.Context, workerID int, msg *queue.Message) {
+	settleCtx := context.WithoutCancel(ctx)
+
+	var payload jobs.JobPayload
+	if err := json.Unmarshal(msg.Body, &payload); err != nil {
+		r.log.Error("Failed to unmarshal job payload",
+			logger.Int("workerID", workerID),
+			logger.String("messageId", msg.ID),
+			logger.Error(err))
+		r.bury(settleCtx, msg, payload, err)
+		return
+	}
+
+	policy := r.retries.For(payload.Step)
+	r.track(payload, r.service.StartStep(ctx, payload, msg.Attempts, policy.MaxAttempts))
+
+	stop := r.keepAlive(ctx, msg)
+	err := r.dispatch(ctx, payload)
+	stop()
+
+	// settle the message even if we are shutting down
+	switch {
+	case err == nil:
+		r.ack(settleCtx, msg)
+	case ctx.Err() != nil:
+		// interrupted, this try doesn't count
+		msg.Attempts--
+		now := time.Now()
+		r.track(payload, r.service.FailStep(settleCtx, payload, "interrupted by worker shutdown", &now))
+		if err := r.q.Nack(settleCtx, r.qName, msg, 0); err != nil {
+			r.log.Error("Failed to release job",
+				logger.String("messageId", msg.ID),
+				logger.Error(err))
+		}
+	default:
+		if jobs.IsPermanent(err) || policy.Exhausted(msg.Attempts) {
+			r.log.Error("Job failed for good",
+				logger.String("step", string(payload.Step)),
+				logger.String("variant", payload.Variant),
+				logger.String("videoId", payload.VideoID),
+				logger.Int("attempt", msg.Attempts),
+				logger.Error(err))
+			r.bury(settleCtx, msg, payload, err)
+			return
+		}
+
+		delay := policy.Backoff(msg.Attempts)
+		retryAt := time.Now().Add(delay)
+		r.track(payload, r.service.FailStep(settleCtx, payload, err.Error(), &retryAt))
+		r.log.Warn("Job handler failed, retrying",
+			logger.String("step", string(payload.Step)),
+			logger.String("variant", payload.Variant),
+			logger.String("videoId", payload.VideoID),
+			logger.Int("attempt", msg.Attempts),
+			logger.Int("maxAttempts", policy.MaxAttempts),
+			logger.String("retryIn", delay.String()),
+			logger.Error(err))
+		if err := r.q.Nack(settleCtx, r.qName, msg, delay); err != nil {
+			r.log.Error("Failed to schedule job retry",
+				logger.String("messageId", msg.ID),
+				logger.Error(err))
+		}
+	}
+}
 
-				if err := r.dispatch(ctx, payload); err != nil {
-					r.log.Error("Job handler failed",
-						logger.String("step", string(payload.Step)),
-						logger.String("videoId", payload.VideoID),
+// bury dead-letters msg and marks its video as failed, unless it was one
+// variant of a fanned out step whose other variants can still carry on
+func (r *Runner) bury(ctx context.Context, msg *queue.Message, payload jobs.JobPayload, cause error) {
+	if err := r.dlq.Bury(ctx, r.qName, msg, cause.Error()); err != nil {
+		// leave it unacked, it comes back after the visibility timeout
+		r.log.Error("Failed to dead-letter job",
+			logger.String("messageId", msg.ID),
+			logger.Error(err))
+		return
+	}
+	r.ack(ctx, msg)
+
+	if payload.VideoID == "" {
+		return
+	}
+	if payload.Variant != "" {
+		next, ok, err := r.service.FailVariant(ctx, payload, cause.Error())
+		r.track(payload, err)
+		if err == nil && ok {
+			r.log.Warn("Variant dropped, carrying on with the others",
+				logger.String("step", string(payload.Step)),
+				logger.String("variant", payload.Variant),
+				logger.String("videoId", payload.VideoID))
+			r.logNext(payload, next)
+			return
+		}
+	} else {
+		r.track(payload, r.service.FailStep(ctx, payload, cause.Error(), nil))
+	}
+	if err := r.service.UpdateStatus(ctx, payload.VideoID, models.StatusFailed); err != nil {
+		r.log.Error("Failed to mark video as failed",
+			logger.String("videoId", payload.VideoID),
+			logger.Error(err))
+	}
+}
+
+// track logs a failure to record step state, which never fails the job itself
+func (r *Runner) track(payload jobs.JobPayload, err error) {
+	if err != nil {
+		r.log.Warn("Failed to record step state",
+			logger.String("step", string(payload.Step)),
+			logger.String("variant", payload.Variant),
+			logger.String("videoId", payload.VideoID),
+			logger.Error(err))
+	}
+}
+
+func (r *Runner) ack(ctx context.Context, msg *queue.Message) {
+	if err := r.q.Ack(ctx, r.qName, msg); err != nil {
+		r.log.Error("Failed to ack job",
+			logger.String("messageId", msg.ID),
+			logger.Error(err))
+	}
+}
+
+// keepAlive extends the lease of msg while its step runs, so long transcodes
+// aren't handed to another worker. The returned func stops it.
+func (r *Runner) keepAlive(ctx context.Context, msg *queue.Message) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(r.visibility / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := r.q.Extend(ctx, r.qName, msg); err != nil {
+					r.log.Warn("Failed to extend job lease",
+						logger.String("messageId", msg.ID),
 						logger.Error(err))
 				}
 			}
-		}(i)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
 	}
 }
 
+// dispatch runs the step's handler, then records it as done and enqueues the
+// steps of the pipeline that were waiting on it
 func (r *Runner) dispatch(ctx context.Context, payload jobs.JobPayload) error {
-	handler, nextStep := r.getHandler(payload.Step)
-	if handler == nil {
-		return fmt.Errorf("no handler for step %s", payload.Step)
+	handler, ok := r.registry.Lookup(payload.Step)
+	if !ok {
+		return jobs.Permanent(fmt.Errorf("no handler for step %s", payload.Step))
 	}
-	if err := handler(ctx, payload); err != nil {
+	if err := handler.Handle(ctx, payload); err != nil {
 		return err
 	}
-	if nextStep != "" {
-		return r.enqueueNext(ctx, payload.VideoID, nextStep)
+
+	next, err := r.service.CompleteStep(ctx, payload)
+	if err != nil {
+		return err
 	}
+	r.logNext(payload, next)
 	return nil
 }
 
-func (r *Runner) getHandler(step jobs.Step) (func(ctx context.Context, p jobs.JobPayload) error, jobs.Step) {
-	switch step {
-	case jobs.StepValidate:
-		return r.validate.Handle, jobs.StepTranscode
-	case jobs.StepTranscode:
-		return r.transcode.Handle, jobs.StepSegment
-	case jobs.StepSegment:
-		return r.segment.Handle, jobs.StepChecksum
-	case jobs.StepChecksum:
-		return r.checksum.Handle, jobs.StepThumbs
-	case jobs.StepThumbs:
-		return r.thumbnail.Handle, jobs.StepPublish
-	case jobs.StepPublish:
-		return r.publish.Handle, ""
-	}
-	return nil, ""
-}
-
-func (r *Runner) enqueueNext(ctx context.Context, id string, step jobs.Step) error {
-	p, err := json.Marshal(jobs.JobPayload{VideoID: id, Step: step})
-	if err != nil {
-		return err
+func (r *Runner) logNext(payload jobs.JobPayload, next []jobs.Step) {
+	for _, step := range next {
+		r.log.Info("Enqueued next step",
+			logger.String("videoId", payload.VideoID),
+			logger.String("step", string(step)))
 	}
-	r.log.Info("Enqueuing next step",
-		logger.String("videoId", id),
-		logger.String("step", string(step)))
-	return r.q.Enqueue(ctx, r.qName, p)
 }
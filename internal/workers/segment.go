@@ -2,12 +2,16 @@ package workers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 
+	"github.com/ak-ansari/mytube/internal/encoding"
 	"github.com/ak-ansari/mytube/internal/jobs"
+	"github.com/ak-ansari/mytube/internal/m3u8"
 	"github.com/ak-ansari/mytube/internal/media"
+	"github.com/ak-ansari/mytube/internal/models"
 	"github.com/ak-ansari/mytube/internal/pkg/logger"
 	"github.com/ak-ansari/mytube/internal/services"
 	"github.com/ak-ansari/mytube/internal/storage"
@@ -43,31 +47,44 @@ func (s *Segment) Handle(ctx context.Context, payload jobs.JobPayload) error {
 		return err
 	}
 
-	// get quality to metadata mapping
-	qualityMap := util.GetQualityMap()
-
 	// directories to work with
 	remoteDir := s.service.GetHlsDir(payload.VideoID)
-	tempDir := filepath.Join(os.TempDir(), payload.VideoID)
-	if err := os.MkdirAll(tempDir, 0o755); err != nil {
+	tempDir, err := os.MkdirTemp("", payload.VideoID+"-segment-*")
+	if err != nil {
 		s.log.Error("Failed to create temp dir",
-			logger.String("path", tempDir),
+			logger.String("videoId", payload.VideoID),
 			logger.Error(err))
 		return err
 	}
 	defer os.RemoveAll(tempDir)
 
-	// manifest file init
-	manifest := "#EXTM3U\n"
+	qualities := byBandwidth(s.service.Ladder(v), v.AvailableQualities)
+	if len(qualities) == 0 {
+		return jobs.Permanent(fmt.Errorf("video %s has no renditions to package", payload.VideoID))
+	}
+	if s.service.Profile(v).Packaging == encoding.PackagingCMAF {
+		return s.packageCMAF(ctx, payload, v, qualities, tempDir, remoteDir)
+	}
+
+	inputs, err := renditionInputs(ctx, s.service, v, qualities)
+	if err != nil {
+		s.log.Error("Failed to get download URL",
+			logger.String("videoId", payload.VideoID),
+			logger.Error(err))
+		return err
+	}
+
+	master := &m3u8.Master{Version: 4, IndependentSegments: true}
+	progress := newProgress(s.service, payload, v, s.log)
 
 	// loop over each available quality and process segment generation
-	for _, quality := range v.AvailableQualities {
+	for i, q := range qualities {
+		quality := q.Label
 		s.log.Info("Creating segments",
 			logger.String("videoId", payload.VideoID),
 			logger.String("quality", quality))
 
-		q := qualityMap[quality]
-		if err := s.createSegments(ctx, tempDir, v.Filename, payload.VideoID, quality); err != nil {
+		if err := s.ffm.SegmentHLS(ctx, inputs[i].Path, tempDir, quality, 4, progress.Part(ctx, i, len(qualities))); err != nil {
 			s.log.Error("Failed to create segments",
 				logger.String("videoId", payload.VideoID),
 				logger.String("quality", quality),
@@ -75,20 +92,38 @@ func (s *Segment) Handle(ctx context.Context, payload jobs.JobPayload) error {
 			return err
 		}
 
-		if err := s.uploadHlsFiles(ctx, quality, tempDir, remoteDir); err != nil {
-			s.log.Error("Failed to upload HLS files",
+		variant, iframe, err := describeRendition(ctx, s.ffm, inputs[i].Path, tempDir, quality+".m3u8")
+		if err != nil {
+			s.log.Error("Failed to describe rendition",
 				logger.String("videoId", payload.VideoID),
 				logger.String("quality", quality),
 				logger.Error(err))
 			return err
 		}
+		master.Variants = append(master.Variants, variant)
+		if iframe != nil {
+			master.IFrames = append(master.IFrames, *iframe)
+		}
 
-		manifest += fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d\n%s.m3u8\n",
-			q.Bandwidth, q.Label)
+		if err := s.uploadHlsFiles(ctx, payload.VideoID, quality, tempDir, remoteDir); err != nil {
+			s.log.Error("Failed to upload HLS files",
+				logger.String("videoId", payload.VideoID),
+				logger.String("quality", quality),
+				logger.Error(err))
+			return err
+		}
+	}
 
+	// the audio is muxed into every rendition, the group only names it
+	audio, err := audioMedia(ctx, s.ffm, inputs[0].Path, "")
+	if err != nil {
+		return err
+	}
+	if audio != nil {
+		master.Media = append(master.Media, *audio)
 	}
 
-	manifestPath, err := s.uploadMasterPlaylist(ctx, tempDir, remoteDir, manifest)
+	manifestPath, err := s.uploadMasterPlaylist(ctx, payload.VideoID, tempDir, remoteDir, master.Encode())
 	if err != nil {
 		s.log.Error("Failed to upload master playlist",
 			logger.String("videoId", payload.VideoID),
@@ -111,21 +146,97 @@ func (s *Segment) Handle(ctx context.Context, payload jobs.JobPayload) error {
 	return nil
 }
 
-func (s *Segment) createSegments(ctx context.Context, tempDir, originalName, id, quality string) error {
-	ext := filepath.Ext(originalName)
-	key := s.service.GetTranscodingPath(id, quality, ext)
-	url, err := s.service.GetDownloadUrl(ctx, key)
+// packageCMAF packages every rendition once as fMP4 and records both the HLS
+// master playlist and the DASH manifest that share those segments
+func (s *Segment) packageCMAF(ctx context.Context, payload jobs.JobPayload, v *models.Video, qualities []util.Quality, tempDir, remoteDir string) error {
+	videoId := v.ID.String()
+	inputs, err := renditionInputs(ctx, s.service, v, qualities)
 	if err != nil {
+		s.log.Error("Failed to get download URL",
+			logger.String("videoId", videoId),
+			logger.Error(err))
 		return err
 	}
-
-	if err := s.ffm.SegmentHLS(ctx, url, tempDir, quality, 4); err != nil {
+	if err := s.ffm.PackageCMAF(ctx, inputs, tempDir, 4, newProgress(s.service, payload, v, s.log).Part(ctx, 0, 1)); err != nil {
+		s.log.Error("Failed to package CMAF",
+			logger.String("videoId", videoId),
+			logger.Error(err))
 		return err
 	}
+	// ffmpeg's master only has BANDWIDTH, write a complete one over it
+	master, err := cmafMaster(ctx, s.ffm, inputs, tempDir)
+	if err != nil {
+		s.log.Error("Failed to write master playlist",
+			logger.String("videoId", videoId),
+			logger.Error(err))
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, media.CMAFMaster), []byte(master.Encode()), 0644); err != nil {
+		return err
+	}
+	keys, err := uploadPackage(ctx, s.service, s.store, videoId, tempDir, remoteDir, media.CMAFMaster, media.CMAFManifest)
+	if err != nil {
+		s.log.Error("Failed to upload CMAF files",
+			logger.String("videoId", videoId),
+			logger.Error(err))
+		return err
+	}
+	if err := s.service.UpdateManifest(ctx, videoId, keys[0]); err != nil {
+		return err
+	}
+	if err := s.service.UpdateDashManifest(ctx, videoId, keys[1]); err != nil {
+		return err
+	}
+
+	s.log.Success("CMAF packaging finished",
+		logger.String("videoId", videoId),
+		logger.String("manifestPath", keys[0]),
+		logger.String("dashManifestPath", keys[1]))
 	return nil
 }
 
-func (s *Segment) uploadHlsFiles(ctx context.Context, quality, localDir, remoteDir string) error {
+// cmafMaster describes the playlists PackageCMAF wrote: media_<n>.m3u8 for
+// the n-th input's video, then one for the audio of the first input
+func cmafMaster(ctx context.Context, ffm *media.FFM, inputs []media.PackageInput, dir string) (*m3u8.Master, error) {
+	master := &m3u8.Master{Version: 6, IndependentSegments: true}
+	for i, in := range inputs {
+		variant, iframe, err := describeRendition(ctx, ffm, in.Path, dir, fmt.Sprintf("media_%d.m3u8", i))
+		if err != nil {
+			return nil, err
+		}
+		master.Variants = append(master.Variants, variant)
+		if iframe != nil {
+			master.IFrames = append(master.IFrames, *iframe)
+		}
+	}
+
+	audioPlaylist := fmt.Sprintf("media_%d.m3u8", len(inputs))
+	pl, err := readPlaylist(dir, audioPlaylist)
+	if errors.Is(err, os.ErrNotExist) {
+		return master, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	audio, err := audioMedia(ctx, ffm, inputs[0].Path, audioPlaylist)
+	if err != nil || audio == nil {
+		return master, err
+	}
+	master.Media = append(master.Media, *audio)
+
+	// the audio is a separate download, the variants' bandwidth has to include it
+	peak, average, err := pl.Bandwidth(localSize(dir))
+	if err != nil {
+		return nil, err
+	}
+	for i := range master.Variants {
+		master.Variants[i].Bandwidth += peak
+		master.Variants[i].AverageBandwidth += average
+	}
+	return master, nil
+}
+
+func (s *Segment) uploadHlsFiles(ctx context.Context, videoId, quality, localDir, remoteDir string) error {
 	pattern := filepath.Join(localDir, fmt.Sprintf("%s*", quality))
 	files, err := filepath.Glob(pattern)
 	if err != nil {
@@ -143,7 +254,11 @@ func (s *Segment) uploadHlsFiles(ctx context.Context, quality, localDir, remoteD
 			logger.String("quality", quality),
 			logger.String("file", f))
 
-		if _, err := s.store.UploadLocalFile(ctx, remotePath, f, ""); err != nil {
+		kind := models.ObjectSegment
+		if ext == ".m3u8" {
+			kind = models.ObjectPlaylist
+		}
+		if _, err := uploadObject(ctx, s.service, s.store, videoId, kind, remotePath, f, packageContentTypes[ext]); err != nil {
 			return err
 		}
 
@@ -154,7 +269,7 @@ func (s *Segment) uploadHlsFiles(ctx context.Context, quality, localDir, remoteD
 	return nil
 }
 
-func (s *Segment) uploadMasterPlaylist(ctx context.Context, localDir, remoteDir, master string) (string, error) {
+func (s *Segment) uploadMasterPlaylist(ctx context.Context, videoId, localDir, remoteDir, master string) (string, error) {
 	manifestName := "master.m3u8"
 	localPath := filepath.Join(localDir, manifestName)
 	if err := os.WriteFile(localPath, []byte(master), 0644); err != nil {
@@ -165,7 +280,7 @@ func (s *Segment) uploadMasterPlaylist(ctx context.Context, localDir, remoteDir,
 	s.log.Info("Uploading manifest file",
 		logger.String("path", remotePath))
 
-	key, err := s.store.UploadLocalFile(ctx, remotePath, localPath, "")
+	key, err := uploadObject(ctx, s.service, s.store, videoId, models.ObjectManifest, remotePath, localPath, packageContentTypes[".m3u8"])
 	if err != nil {
 		s.log.Error("Failed to upload manifest file",
 			logger.String("path", remotePath),
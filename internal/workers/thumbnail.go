@@ -7,6 +7,7 @@ import (
 
 	"github.com/ak-ansari/mytube/internal/jobs"
 	"github.com/ak-ansari/mytube/internal/media"
+	"github.com/ak-ansari/mytube/internal/models"
 	"github.com/ak-ansari/mytube/internal/pkg/logger"
 	"github.com/ak-ansari/mytube/internal/services"
 	"github.com/ak-ansari/mytube/internal/storage"
@@ -76,7 +77,7 @@ func (t *Thumbnail) Handle(ctx context.Context, payload jobs.JobPayload) error {
 		logger.String("videoId", payload.VideoID),
 		logger.String("remotePath", remotePath))
 
-	if _, err := t.store.UploadLocalFile(ctx, remotePath, outPath, "image/jpeg"); err != nil {
+	if _, err := uploadObject(ctx, t.service, t.store, payload.VideoID, models.ObjectThumbnail, remotePath, outPath, "image/jpeg"); err != nil {
 		t.log.Error("Failed to upload thumbnail",
 			logger.String("videoId", payload.VideoID),
 			logger.String("remotePath", remotePath),
@@ -2,10 +2,12 @@ package workers
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/ak-ansari/mytube/internal/encoding"
 	"github.com/ak-ansari/mytube/internal/jobs"
 	"github.com/ak-ansari/mytube/internal/media"
 	"github.com/ak-ansari/mytube/internal/models"
@@ -31,9 +33,12 @@ func NewTranscoder(service *services.VideoService, store storage.ObjectStore, ff
 	}
 }
 
+// Handle transcodes the rendition named by the payload's variant, or the whole
+// ladder in one go when the step isn't fanned out
 func (c *Transcode) Handle(ctx context.Context, payload jobs.JobPayload) error {
 	c.log.Info("Transcoding started",
-		logger.String("videoId", payload.VideoID))
+		logger.String("videoId", payload.VideoID),
+		logger.String("variant", payload.Variant))
 
 	v, err := c.service.GetVideo(ctx, payload.VideoID)
 	if err != nil {
@@ -46,10 +51,23 @@ func (c *Transcode) Handle(ctx context.Context, payload jobs.JobPayload) error {
 		logger.String("videoId", payload.VideoID),
 		logger.String("filename", v.Filename))
 
-	tempDir := filepath.Join(os.TempDir(), payload.VideoID)
-	if err := os.MkdirAll(tempDir, 0o755); err != nil {
+	// the profile recorded at upload, so reprocessing gives the same output
+	profile := c.service.Profile(v)
+	// never above the source, so a 360p upload doesn't get a fake 1080p
+	sizes := c.service.Ladder(v)
+	if payload.Variant != "" {
+		q, ok := findQuality(sizes, payload.Variant)
+		if !ok {
+			return jobs.Permanent(fmt.Errorf("rendition %s isn't in the ladder of this video", payload.Variant))
+		}
+		sizes = []util.Quality{q}
+	}
+
+	// every job gets its own dir, renditions of one video may run side by side
+	tempDir, err := os.MkdirTemp("", payload.VideoID+"-transcode-*")
+	if err != nil {
 		c.log.Error("Failed to create temp directory",
-			logger.String("path", tempDir),
+			logger.String("videoId", payload.VideoID),
 			logger.Error(err))
 		return err
 	}
@@ -65,46 +83,23 @@ func (c *Transcode) Handle(ctx context.Context, payload jobs.JobPayload) error {
 	}
 
 	availableQualities := []string{}
-	ext := filepath.Ext(v.Filename)
+	renditions := []models.Rendition{}
 
-	for _, s := range util.Sizes {
-		c.log.Info("Transcoding quality started",
-			logger.String("videoId", payload.VideoID),
-			logger.String("quality", s.Label))
-
-		outPath := filepath.Join(tempDir, s.Label+ext)
-		if err := c.ffm.TranscodeH264(ctx, url, outPath, s.Width, s.Height); err != nil {
-			c.log.Error("Failed transcoding",
-				logger.String("videoId", payload.VideoID),
-				logger.String("quality", s.Label),
-				logger.Error(err))
+	progress := newProgress(c.service, payload, v, c.log)
+	for i, s := range sizes {
+		if err := c.transcode(ctx, payload.VideoID, url, tempDir, c.service.RenditionExt(v, s), s, profile, progress.Part(ctx, i, len(sizes))); err != nil {
 			return err
 		}
-
-		key := c.service.GetTranscodingPath(payload.VideoID, s.Label, ext)
-		c.log.Info("Uploading transcoded file",
-			logger.String("videoId", payload.VideoID),
-			logger.String("quality", s.Label),
-			logger.String("remotePath", key))
-
-		if _, err := c.store.UploadLocalFile(ctx, key, outPath, "video/"+strings.TrimPrefix(ext, ".")); err != nil {
-			c.log.Error("Failed to upload transcoded file",
-				logger.String("videoId", payload.VideoID),
-				logger.String("quality", s.Label),
-				logger.String("remotePath", key),
-				logger.Error(err))
-			return err
-		}
-
-		c.log.Success("Transcoded file uploaded",
-			logger.String("videoId", payload.VideoID),
-			logger.String("quality", s.Label),
-			logger.String("remotePath", key))
-
 		availableQualities = append(availableQualities, s.Label)
+		renditions = append(renditions, models.Rendition{Quality: s.Label, Codec: s.Codec})
 	}
 
-	if err := c.service.UpdateQualities(ctx, payload.VideoID, availableQualities, models.StatusProcessing); err != nil {
+	if payload.Variant != "" {
+		err = c.service.AddQuality(ctx, payload.VideoID, renditions[0], models.StatusProcessing)
+	} else {
+		err = c.service.UpdateQualities(ctx, payload.VideoID, renditions, models.StatusProcessing)
+	}
+	if err != nil {
 		c.log.Error("Failed to update qualities in DB",
 			logger.String("videoId", payload.VideoID),
 			logger.Error(err))
@@ -113,7 +108,53 @@ func (c *Transcode) Handle(ctx context.Context, payload jobs.JobPayload) error {
 
 	c.log.Success("Transcoding finished",
 		logger.String("videoId", payload.VideoID),
-		logger.Any("availableQualities", availableQualities))
+		logger.Any("qualities", availableQualities))
 
 	return nil
 }
+
+// transcode encodes one rendition of url and uploads it
+func (c *Transcode) transcode(ctx context.Context, videoId, url, tempDir, ext string, s util.Quality, profile encoding.Profile, onProgress media.ProgressFunc) error {
+	c.log.Info("Transcoding quality started",
+		logger.String("videoId", videoId),
+		logger.String("quality", s.Label))
+
+	outPath := filepath.Join(tempDir, s.Label+ext)
+	if err := c.ffm.Transcode(ctx, url, outPath, s, profile, onProgress); err != nil {
+		c.log.Error("Failed transcoding",
+			logger.String("videoId", videoId),
+			logger.String("quality", s.Label),
+			logger.Error(err))
+		return err
+	}
+
+	key := c.service.GetTranscodingPath(videoId, s.Label, ext)
+	c.log.Info("Uploading transcoded file",
+		logger.String("videoId", videoId),
+		logger.String("quality", s.Label),
+		logger.String("remotePath", key))
+
+	if _, err := uploadObject(ctx, c.service, c.store, videoId, models.ObjectRendition, key, outPath, "video/"+strings.TrimPrefix(ext, ".")); err != nil {
+		c.log.Error("Failed to upload transcoded file",
+			logger.String("videoId", videoId),
+			logger.String("quality", s.Label),
+			logger.String("remotePath", key),
+			logger.Error(err))
+		return err
+	}
+
+	c.log.Success("Transcoded file uploaded",
+		logger.String("videoId", videoId),
+		logger.String("quality", s.Label),
+		logger.String("remotePath", key))
+	return nil
+}
+
+func findQuality(ladder []util.Quality, label string) (util.Quality, bool) {
+	for _, q := range ladder {
+		if q.Label == label {
+			return q, true
+		}
+	}
+	return util.Quality{}, false
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/ak-ansari/mytube/internal/jobs"
 	"github.com/ak-ansari/mytube/internal/media"
@@ -37,13 +39,14 @@ func (c *Validate) Handle(ctx context.Context, p jobs.JobPayload) error {
 	c.log.Info("Validation started",
 		logger.String("videoId", p.VideoID))
 
-	key, err := c.service.GetVideoKey(ctx, p.VideoID)
+	v, err := c.service.GetVideo(ctx, p.VideoID)
 	if err != nil {
-		c.log.Error("Failed to get video key",
+		c.log.Error("Failed to get video info",
 			logger.String("videoId", p.VideoID),
 			logger.Error(err))
 		return err
 	}
+	key := v.OriginalObjectKey
 
 	f, _, err := c.store.Get(ctx, key)
 	if err != nil {
@@ -53,6 +56,7 @@ func (c *Validate) Handle(ctx context.Context, p jobs.JobPayload) error {
 			logger.Error(err))
 		return err
 	}
+	defer f.Close()
 
 	temp, err := os.CreateTemp("", "video-*")
 	if err != nil {
@@ -83,6 +87,17 @@ func (c *Validate) Handle(ctx context.Context, p jobs.JobPayload) error {
 		return err
 	}
 
+	sum := hex.EncodeToString(h.Sum(nil))
+	// a direct upload recorded the sum the client declared, what reached the
+	// bucket has to match it
+	if v.SHA256 != nil && !strings.EqualFold(*v.SHA256, sum) {
+		c.log.Error("Original does not match its declared checksum",
+			logger.String("videoId", p.VideoID),
+			logger.String("declared", *v.SHA256),
+			logger.String("checksum", sum))
+		return jobs.Permanent(fmt.Errorf("original sha256 is %s, the upload declared %s", sum, *v.SHA256))
+	}
+
 	pr, err := c.ffm.Probe(ctx, temp.Name())
 	if err != nil {
 		c.log.Error("Failed to probe video",
@@ -91,20 +106,23 @@ func (c *Validate) Handle(ctx context.Context, p jobs.JobPayload) error {
 		return err
 	}
 
-	sum := hex.EncodeToString(h.Sum(nil))
-
 	var acodec, vcodec string
 	var wpx, hpx, dur int
+	var bitrate int64
 
 	for _, s := range pr.Streams {
 		if s.CodecType == "video" {
 			vcodec = s.CodecName
-			wpx = s.Width
-			hpx = s.Height
+			wpx, hpx = s.DisplaySize()
+			bitrate, _ = strconv.ParseInt(s.BitRate, 10, 64)
 		} else if s.CodecType == "audio" {
 			acodec = s.CodecName
 		}
 	}
+	// not every container reports it per stream
+	if bitrate == 0 {
+		bitrate, _ = strconv.ParseInt(pr.Format.BitRate, 10, 64)
+	}
 
 	if pr.Format.Duration != "" {
 		if d, err := parseDur(pr.Format.Duration); err == nil && d > 0 {
@@ -112,7 +130,7 @@ func (c *Validate) Handle(ctx context.Context, p jobs.JobPayload) error {
 		}
 	}
 
-	if err := c.service.UpdateMeta(ctx, p.VideoID, sum, dur, vcodec, acodec, wpx, hpx, models.StatusValid); err != nil {
+	if err := c.service.UpdateMeta(ctx, p.VideoID, sum, dur, vcodec, acodec, wpx, hpx, bitrate, models.StatusValid); err != nil {
 		c.log.Error("Failed to update video metadata",
 			logger.String("videoId", p.VideoID),
 			logger.Error(err))
@@ -126,7 +144,8 @@ func (c *Validate) Handle(ctx context.Context, p jobs.JobPayload) error {
 		logger.String("vcodec", vcodec),
 		logger.String("acodec", acodec),
 		logger.Int("width", wpx),
-		logger.Int("height", hpx))
+		logger.Int("height", hpx),
+		logger.Int64("bitrate", bitrate))
 
 	return nil
 }
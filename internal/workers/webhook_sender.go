@@ -0,0 +1,169 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/jobs"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/pkg/logger"
+	"github.com/ak-ansari/mytube/internal/services"
+	"github.com/ak-ansari/mytube/internal/webhooks"
+)
+
+const (
+	webhookPollInterval = time.Second
+	// what is kept of a response for the attempt log
+	webhookResponseLimit = 1024
+)
+
+// DefaultWebhookRetry spreads the attempts of a delivery over about a day
+var DefaultWebhookRetry = jobs.RetryPolicy{
+	MaxAttempts:    8,
+	InitialBackoff: 30 * time.Second,
+	MaxBackoff:     time.Hour,
+	Multiplier:     3,
+	Jitter:         0.2,
+}
+
+// WebhookSender posts the pending webhook deliveries. Any 2xx answer delivers
+// them, anything else is retried with backoff until the policy gives up.
+// Unless allowPrivate is set it refuses to connect inside the network, wherever
+// the url or its redirects resolve to.
+type WebhookSender struct {
+	service *services.VideoService
+	client  *http.Client
+	timeout time.Duration
+	retry   jobs.RetryPolicy
+	log     logger.Logger
+}
+
+func NewWebhookSender(service *services.VideoService, timeout time.Duration, retry jobs.RetryPolicy, allowPrivate bool, log logger.Logger) *WebhookSender {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+	if !allowPrivate {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		// a proxy would do the dialing, out of reach of the guard
+		transport.Proxy = nil
+		transport.DialContext = webhooks.Dialer(timeout).DialContext
+		client.Transport = transport
+	}
+	return &WebhookSender{
+		service: service,
+		client:  client,
+		timeout: timeout,
+		retry:   retry,
+		log:     log,
+	}
+}
+
+func (s *WebhookSender) Start(ctx context.Context) {
+	for i := 0; i < 2; i++ {
+		go func(senderID int) {
+			for {
+				sent, err := s.sendNext(ctx)
+				if err != nil {
+					s.log.Error("Failed to send webhook delivery",
+						logger.Int("senderID", senderID),
+						logger.Error(err))
+				}
+				if sent && err == nil {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					s.log.Info("Webhook sender stopped",
+						logger.Int("senderID", senderID))
+					return
+				case <-time.After(webhookPollInterval):
+				}
+			}
+		}(i)
+	}
+}
+
+// sendNext sends the next due delivery, it reports false when none was due
+func (s *WebhookSender) sendNext(ctx context.Context) (bool, error) {
+	// the lease outlives the request, a sender that dies mid-way only delays it
+	d, w, err := s.service.ClaimWebhookDelivery(ctx, 2*s.timeout)
+	if err != nil || d == nil {
+		return false, err
+	}
+
+	attempt := models.WebhookAttempt{DeliveryID: d.ID, Attempt: d.Attempts}
+	start := time.Now()
+	code, body, sendErr := s.post(ctx, d, w)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if code > 0 {
+		attempt.StatusCode = &code
+	}
+	if body != "" {
+		attempt.ResponseBody = &body
+	}
+	if sendErr == nil && (code < 200 || code > 299) {
+		sendErr = fmt.Errorf("endpoint answered %d", code)
+	}
+
+	status := models.DeliverySucceeded
+	retryAt := time.Now()
+	switch {
+	case sendErr == nil:
+		s.log.Info("Webhook delivered",
+			logger.String("deliveryId", d.ID.String()),
+			logger.String("event", d.EventType),
+			logger.Int("attempt", d.Attempts))
+	case s.retry.Exhausted(d.Attempts):
+		status = models.DeliveryFailed
+		s.log.Error("Webhook delivery failed for good",
+			logger.String("deliveryId", d.ID.String()),
+			logger.String("url", w.URL),
+			logger.Int("attempt", d.Attempts),
+			logger.Error(sendErr))
+	default:
+		status = models.DeliveryPending
+		delay := s.retry.Backoff(d.Attempts)
+		retryAt = retryAt.Add(delay)
+		s.log.Warn("Webhook delivery failed, retrying",
+			logger.String("deliveryId", d.ID.String()),
+			logger.String("url", w.URL),
+			logger.Int("attempt", d.Attempts),
+			logger.String("retryIn", delay.String()),
+			logger.Error(sendErr))
+	}
+	if sendErr != nil {
+		msg := sendErr.Error()
+		attempt.Error = &msg
+	}
+	// record it even if we are shutting down
+	return true, s.service.RecordWebhookAttempt(context.WithoutCancel(ctx), attempt, status, retryAt)
+}
+
+func (s *WebhookSender) post(ctx context.Context, d *models.WebhookDelivery, w *models.Webhook) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mytube-webhooks/1")
+	req.Header.Set(webhooks.HeaderEvent, d.EventType)
+	req.Header.Set(webhooks.HeaderDelivery, d.ID.String())
+	req.Header.Set(webhooks.HeaderSignature, webhooks.Sign(w.Secret, time.Now(), d.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	// drain the rest so the connection is reused
+	io.Copy(io.Discard, resp.Body)
+	// postgres text takes neither invalid utf-8 nor NUL
+	return resp.StatusCode, strings.ReplaceAll(strings.ToValidUTF8(string(body), "?"), "\x00", ""), nil
+}
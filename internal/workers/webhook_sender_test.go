@@ -0,0 +1,222 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ak-ansari/mytube/internal/jobs"
+	"github.com/ak-ansari/mytube/internal/models"
+	"github.com/ak-ansari/mytube/internal/pkg/logger"
+	"github.com/ak-ansari/mytube/internal/repository"
+	"github.com/ak-ansari/mytube/internal/services"
+	"github.com/ak-ansari/mytube/internal/webhooks"
+	"github.com/google/uuid"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...logger.Field)   {}
+func (nopLogger) Info(string, ...logger.Field)    {}
+func (nopLogger) Success(string, ...logger.Field) {}
+func (nopLogger) Warn(string, ...logger.Field)    {}
+func (nopLogger) Error(string, ...logger.Field)   {}
+func (nopLogger) Fatal(string, ...logger.Field)   {}
+func (nopLogger) Flush()                          {}
+
+// recorded is what the sender made of an attempt
+type recorded struct {
+	attempt models.WebhookAttempt
+	status  models.DeliveryStatus
+	retryAt time.Time
+}
+
+// webhookRepo hands out one delivery and keeps the attempts recorded for it
+type webhookRepo struct {
+	repository.WebhookRepository
+	mu       sync.Mutex
+	hook     models.Webhook
+	delivery *models.WebhookDelivery
+	attempts []recorded
+}
+
+func (r *webhookRepo) ClaimDelivery(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.delivery == nil || r.delivery.Status != models.DeliveryPending {
+		return nil, nil
+	}
+	r.delivery.Attempts++
+	d := *r.delivery
+	return &d, nil
+}
+
+func (r *webhookRepo) Get(ctx context.Context, id string) (*models.Webhook, error) {
+	if id != r.hook.ID.String() {
+		return nil, repository.ErrNotFound
+	}
+	return &r.hook, nil
+}
+
+func (r *webhookRepo) RecordAttempt(ctx context.Context, a models.WebhookAttempt, status models.DeliveryStatus, retryAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.delivery.Status = status
+	r.attempts = append(r.attempts, recorded{a, status, retryAt})
+	return nil
+}
+
+var testRetry = jobs.RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Minute,
+	MaxBackoff:     time.Hour,
+	Multiplier:     2,
+}
+
+func newTestSender(t *testing.T, url string, allowPrivate bool) (*WebhookSender, *webhookRepo) {
+	t.Helper()
+	hook := models.Webhook{ID: uuid.New(), URL: url, Secret: "whsec_test", Active: true}
+	repo := &webhookRepo{
+		hook: hook,
+		delivery: &models.WebhookDelivery{
+			ID:        uuid.New(),
+			WebhookID: hook.ID,
+			EventID:   uuid.New(),
+			EventType: webhooks.EventReady,
+			Payload:   []byte(`{"type":"video.ready"}`),
+			Status:    models.DeliveryPending,
+		},
+	}
+	service := services.NewVideoService(nil, nil, nil, repo, nil, nil, nil, nil, nil, nil, nil, nil, "", nil, nil, nil, allowPrivate)
+	return NewWebhookSender(service, time.Second, testRetry, allowPrivate, nopLogger{}), repo
+}
+
+func TestWebhookSenderSigns(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{r.Header, body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	s, repo := newTestSender(t, srv.URL, true)
+
+	sent, err := s.sendNext(context.Background())
+	if err != nil || !sent {
+		t.Fatalf("sendNext = %v, %v", sent, err)
+	}
+	got := <-requests
+	if got.header.Get(webhooks.HeaderEvent) != webhooks.EventReady {
+		t.Errorf("event header = %q", got.header.Get(webhooks.HeaderEvent))
+	}
+	if got.header.Get(webhooks.HeaderDelivery) != repo.delivery.ID.String() {
+		t.Errorf("delivery header = %q, want %s", got.header.Get(webhooks.HeaderDelivery), repo.delivery.ID)
+	}
+	if err := webhooks.Verify("whsec_test", got.header.Get(webhooks.HeaderSignature), got.body, time.Minute); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+	if len(repo.attempts) != 1 || repo.attempts[0].status != models.DeliverySucceeded {
+		t.Fatalf("attempts = %+v, want one succeeded", repo.attempts)
+	}
+	if a := repo.attempts[0].attempt; a.StatusCode == nil || *a.StatusCode != http.StatusNoContent || a.Error != nil {
+		t.Errorf("attempt = %+v, want a clean 204", a)
+	}
+
+	if sent, err := s.sendNext(context.Background()); sent || err != nil {
+		t.Errorf("sendNext with nothing due = %v, %v", sent, err)
+	}
+}
+
+func TestWebhookSenderRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	s, repo := newTestSender(t, srv.URL, true)
+
+	for i := 0; i < testRetry.MaxAttempts+1; i++ {
+		if _, err := s.sendNext(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls.Load() != int32(testRetry.MaxAttempts) {
+		t.Fatalf("endpoint called %d times, want %d", calls.Load(), testRetry.MaxAttempts)
+	}
+	for i, r := range repo.attempts {
+		attempt := i + 1
+		if r.attempt.Attempt != attempt {
+			t.Errorf("attempt %d recorded as %d", attempt, r.attempt.Attempt)
+		}
+		if r.attempt.ResponseBody == nil || *r.attempt.ResponseBody != "down for maintenance\n" {
+			t.Errorf("attempt %d kept response %v", attempt, r.attempt.ResponseBody)
+		}
+		if attempt == testRetry.MaxAttempts {
+			if r.status != models.DeliveryFailed {
+				t.Errorf("last attempt left the delivery %s, want failed", r.status)
+			}
+			continue
+		}
+		if r.status != models.DeliveryPending {
+			t.Errorf("attempt %d left the delivery %s, want pending", attempt, r.status)
+		}
+		// 1m, then 2m: no jitter, the wait is exact give or take the request
+		want := testRetry.Backoff(attempt)
+		if wait := time.Until(r.retryAt); wait > want || wait < want-time.Second {
+			t.Errorf("attempt %d retries in %s, want %s", attempt, wait, want)
+		}
+	}
+}
+
+func TestWebhookSenderRefusesPrivateAddresses(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer srv.Close()
+	s, repo := newTestSender(t, srv.URL, false)
+
+	if _, err := s.sendNext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 0 {
+		t.Error("the request reached a loopback endpoint")
+	}
+	if len(repo.attempts) != 1 || repo.attempts[0].attempt.Error == nil {
+		t.Fatalf("attempts = %+v, want one that failed", repo.attempts)
+	}
+	if repo.attempts[0].status != models.DeliveryPending {
+		t.Errorf("delivery left %s, want pending", repo.attempts[0].status)
+	}
+}
+
+func TestWebhookSenderStopsOnCancel(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	s, repo := newTestSender(t, srv.URL, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := s.sendNext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the attempt is recorded even though the context is gone
+	if len(repo.attempts) != 1 || !errors.Is(ctx.Err(), context.Canceled) {
+		t.Fatalf("attempts = %+v after cancel", repo.attempts)
+	}
+}
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS size_bytes BIGINT;
+
+-- +goose Down
+ALTER TABLE videos DROP COLUMN IF EXISTS size_bytes;
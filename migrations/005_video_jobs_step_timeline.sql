@@ -0,0 +1,25 @@
+-- +goose Up
+ALTER TABLE video_jobs
+  ADD COLUMN IF NOT EXISTS started_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS finished_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS duration_ms BIGINT;
+
+-- one row per step of a video, updated on every attempt
+CREATE UNIQUE INDEX IF NOT EXISTS uq_video_jobs_video_step ON video_jobs(video_id, step);
+
+-- these were listed under the Down section of 001 and never created
+CREATE INDEX IF NOT EXISTS idx_video_jobs_status ON video_jobs(status);
+CREATE INDEX IF NOT EXISTS idx_video_jobs_available_at ON video_jobs(available_at);
+
+ALTER TABLE video_jobs
+  ADD CONSTRAINT fk_video_jobs_video FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE video_jobs DROP CONSTRAINT IF EXISTS fk_video_jobs_video;
+DROP INDEX IF EXISTS idx_video_jobs_available_at;
+DROP INDEX IF EXISTS idx_video_jobs_status;
+DROP INDEX IF EXISTS uq_video_jobs_video_step;
+ALTER TABLE video_jobs
+  DROP COLUMN IF EXISTS duration_ms,
+  DROP COLUMN IF EXISTS finished_at,
+  DROP COLUMN IF EXISTS started_at;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- lets video_jobs double as the job queue when QUEUE.BACKEND is postgres
+ALTER TABLE video_jobs
+  ADD COLUMN IF NOT EXISTS queue TEXT NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS leased_until TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_video_jobs_ready ON video_jobs(queue, available_at)
+  WHERE status IN ('queued', 'retrying');
+CREATE INDEX IF NOT EXISTS idx_video_jobs_leased ON video_jobs(queue, leased_until)
+  WHERE status = 'running';
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_video_jobs_leased;
+DROP INDEX IF EXISTS idx_video_jobs_ready;
+ALTER TABLE video_jobs
+  DROP COLUMN IF EXISTS leased_until,
+  DROP COLUMN IF EXISTS queue;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- fanned out steps keep one row per variant, e.g. one per rendition for transcode
+ALTER TABLE video_jobs ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS uq_video_jobs_video_step;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_video_jobs_video_step_variant ON video_jobs(video_id, step, variant);
+
+-- +goose Down
+DROP INDEX IF EXISTS uq_video_jobs_video_step_variant;
+DELETE FROM video_jobs WHERE variant <> '';
+CREATE UNIQUE INDEX IF NOT EXISTS uq_video_jobs_video_step ON video_jobs(video_id, step);
+ALTER TABLE video_jobs DROP COLUMN IF EXISTS variant;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- probed by validate, caps the bitrate of the renditions
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS bitrate_bps BIGINT;
+
+-- +goose Down
+ALTER TABLE videos DROP COLUMN IF EXISTS bitrate_bps;
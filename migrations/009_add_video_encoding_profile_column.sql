@@ -0,0 +1,6 @@
+-- +goose Up
+-- snapshot of the encoding profile picked at upload, reprocessing uses it instead of the current config
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS encoding_profile JSONB;
+
+-- +goose Down
+ALTER TABLE videos DROP COLUMN IF EXISTS encoding_profile;
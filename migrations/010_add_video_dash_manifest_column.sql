@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS dash_manifest_path TEXT;
+
+-- +goose Down
+ALTER TABLE videos DROP COLUMN IF EXISTS dash_manifest_path;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- codec of every available quality, renditions can be encoded with more than one codec
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS renditions JSONB NOT NULL DEFAULT '[]';
+UPDATE videos SET renditions = (
+    SELECT COALESCE(jsonb_agg(jsonb_build_object('quality', q, 'codec', 'h264')), '[]')
+    FROM unnest(available_qualities) AS q
+) WHERE available_qualities IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE videos DROP COLUMN IF EXISTS renditions;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- progress of the running attempt as reported by ffmpeg
+ALTER TABLE video_jobs
+  ADD COLUMN IF NOT EXISTS progress REAL,
+  ADD COLUMN IF NOT EXISTS speed REAL,
+  ADD COLUMN IF NOT EXISTS fps REAL;
+
+-- +goose Down
+ALTER TABLE video_jobs
+  DROP COLUMN IF EXISTS fps,
+  DROP COLUMN IF EXISTS speed,
+  DROP COLUMN IF EXISTS progress;
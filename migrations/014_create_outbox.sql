@@ -0,0 +1,35 @@
+-- +goose Up
+-- messages written in the transaction of the change they announce, the relay
+-- publishes them to the job queue or the event bus once committed and deletes them
+CREATE TABLE IF NOT EXISTS outbox (
+  id BIGSERIAL PRIMARY KEY,
+  -- job or event
+  kind TEXT NOT NULL,
+  -- the queue of a job, the video of an event
+  topic TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  last_error TEXT,
+  available_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_available ON outbox(available_at, id);
+
+-- wakes the relay up when a transaction that wrote messages commits
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_outbox() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('outbox', '');
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER outbox_notify AFTER INSERT ON outbox
+  FOR EACH STATEMENT EXECUTE FUNCTION notify_outbox();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS outbox_notify ON outbox;
+DROP FUNCTION IF EXISTS notify_outbox();
+DROP TABLE IF EXISTS outbox;
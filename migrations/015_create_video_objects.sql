@@ -0,0 +1,23 @@
+-- +goose Up
+-- every object the pipeline stored for a video with the checksums taken before
+-- it was uploaded, the checksum step verifies the stored copies against them
+CREATE TABLE IF NOT EXISTS video_objects (
+  video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+  key TEXT NOT NULL,
+  -- rendition, segment, playlist, manifest or thumbnail
+  kind TEXT NOT NULL,
+  size_bytes BIGINT NOT NULL,
+  sha256 TEXT NOT NULL,
+  md5 TEXT NOT NULL,
+  -- as the store reported it right after the upload
+  etag TEXT NOT NULL DEFAULT '',
+  verified_at TIMESTAMPTZ,
+  -- what the last verification found wrong, NULL when it passed
+  problem TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (video_id, key)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS video_objects;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- a duplicate upload of a ready video shares its stored objects instead of
+-- being processed again: source_id points at the video that owns them and the
+-- owner counts the videos using them, itself included. An owner deleted while
+-- others still use its objects keeps its row, marked deleted, until the last
+-- of them goes.
+ALTER TABLE videos
+  ADD COLUMN IF NOT EXISTS source_id UUID REFERENCES videos(id),
+  ADD COLUMN IF NOT EXISTS ref_count INT NOT NULL DEFAULT 1,
+  ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_videos_sha256 ON videos (sha256) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_videos_source_id ON videos (source_id) WHERE source_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_videos_source_id;
+DROP INDEX IF EXISTS idx_videos_sha256;
+ALTER TABLE videos
+  DROP COLUMN IF EXISTS deleted_at,
+  DROP COLUMN IF EXISTS ref_count,
+  DROP COLUMN IF EXISTS source_id;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- perceptual hashes of keyframes, similar videos share frames whose hashes are
+-- a few bits apart. bands are the bytes of phash tagged with their position, two
+-- hashes less than 8 bits apart have one in common, which the GIN index finds.
+CREATE TABLE IF NOT EXISTS video_fingerprints (
+  video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+  position INT NOT NULL,
+  at_seconds DOUBLE PRECISION NOT NULL,
+  phash BIGINT NOT NULL,
+  dhash BIGINT NOT NULL,
+  bands INT[] NOT NULL,
+  PRIMARY KEY (video_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_fingerprints_bands ON video_fingerprints USING GIN (bands);
+
+-- +goose Down
+DROP TABLE IF EXISTS video_fingerprints;
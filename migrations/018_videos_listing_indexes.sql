@@ -0,0 +1,15 @@
+-- +goose Up
+-- GET /videos pages through videos by keyset, (sort key, id) after the last
+-- row of the previous page, every sort key has an index ending in id
+CREATE INDEX IF NOT EXISTS idx_videos_created_at_id ON videos (created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_videos_status_created_at_id ON videos (status, created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_videos_duration_id ON videos ((COALESCE(duration_seconds, 0)), id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_videos_size_id ON videos ((COALESCE(size_bytes, 0)), id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_videos_height ON videos (height) WHERE deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_videos_height;
+DROP INDEX IF EXISTS idx_videos_size_id;
+DROP INDEX IF EXISTS idx_videos_duration_id;
+DROP INDEX IF EXISTS idx_videos_status_created_at_id;
+DROP INDEX IF EXISTS idx_videos_created_at_id;
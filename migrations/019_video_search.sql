@@ -0,0 +1,39 @@
+-- +goose Up
+-- searchable metadata. search_vector is kept up to date by a trigger, the
+-- 'simple' configuration doesn't stem, so prefix matches work on what was typed
+ALTER TABLE videos
+  ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}',
+  ADD COLUMN IF NOT EXISTS search_vector TSVECTOR NOT NULL DEFAULT ''::tsvector;
+
+-- title weighs the most, then the tags, then the description
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION videos_search_vector() RETURNS trigger AS $$
+BEGIN
+  NEW.search_vector :=
+    setweight(to_tsvector('simple', NEW.title), 'A') ||
+    setweight(to_tsvector('simple', array_to_string(NEW.tags, ' ')), 'B') ||
+    setweight(to_tsvector('simple', NEW.description), 'C');
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER videos_search_vector BEFORE INSERT OR UPDATE OF title, description, tags ON videos
+  FOR EACH ROW EXECUTE FUNCTION videos_search_vector();
+
+-- videos uploaded so far are titled after their file
+UPDATE videos SET title = regexp_replace(filename, '\.[^.]*$', '');
+
+CREATE INDEX IF NOT EXISTS idx_videos_search_vector ON videos USING GIN (search_vector) WHERE deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_videos_search_vector;
+DROP TRIGGER IF EXISTS videos_search_vector ON videos;
+DROP FUNCTION IF EXISTS videos_search_vector();
+ALTER TABLE videos
+  DROP COLUMN IF EXISTS search_vector,
+  DROP COLUMN IF EXISTS tags,
+  DROP COLUMN IF EXISTS description,
+  DROP COLUMN IF EXISTS title;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- leases that serialize work on a key across processes, a lease lapses at
+-- expires_at unless its holder renews it so a crashed holder never keeps a key
+CREATE TABLE IF NOT EXISTS locks (
+  key TEXT PRIMARY KEY,
+  holder TEXT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS locks;
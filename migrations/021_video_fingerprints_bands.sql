@@ -0,0 +1,12 @@
+-- +goose Up
+-- 8 bands of a byte only guarantee a common band to hashes less than 8 bits
+-- apart, similar frames may be 10 apart. 11 bands of 5 and 6 bits, see phash.Bands.
+UPDATE video_fingerprints SET bands = ARRAY(
+  SELECT (i << 8) | ((phash >> (i*64/11)) & ((1::bigint << ((i+1)*64/11 - i*64/11)) - 1))::int
+  FROM generate_series(0, 10) AS i
+);
+
+-- +goose Down
+UPDATE video_fingerprints SET bands = ARRAY(
+  SELECT (i << 8) | ((phash >> (8*i)) & 255)::int FROM generate_series(0, 7) AS i
+);